@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"explorer/decode"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+// GetAbi 获取合约上传的abi
+func GetAbi(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	doc, err := store.Repo.GetAbi(address)
+	if err != nil {
+		panic(err)
+	}
+	docResponse(c, doc)
+}
+
+// SaveAbi 上传合约的abi，body是abi的json原文，已存在时覆盖
+func SaveAbi(c *gin.Context) {
+	address := c.Param("address")
+	body, err := io.ReadAll(c.Request.Body)
+	if !common.IsHexAddress(address) || err != nil {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	contractAbi, err := decode.ParseAbi(string(body))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	err = decode.SaveAbi(address, string(body), contractAbi)
+	if err != nil {
+		panic(err)
+	}
+	c.IndentedJSON(http.StatusOK, "ok")
+}
+
+// decodeTx 在tx文档后面加上解析出的decodedInput和decodedLogs，原有字段的顺序不变
+func decodeTx(source json.RawMessage) (json.RawMessage, error) {
+	var esTx store.ESTx
+	err := json.Unmarshal(source, &esTx)
+	if err != nil {
+		return nil, err
+	}
+	call, err := decode.DecodeInput(esTx.To, esTx.Data)
+	if err != nil {
+		return nil, err
+	}
+	events, err := decode.DecodeLogs(esTx.Logs)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := json.Marshal(map[string]interface{}{
+		"decodedInput": call,
+		"decodedLogs":  events,
+	})
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimRight(source, " \t\r\n")
+	if len(trimmed) < 2 || trimmed[len(trimmed)-1] != '}' {
+		return source, nil
+	}
+	// 去掉原文的右括号和新对象的左括号，拼成一个对象
+	spliced := append([]byte{}, trimmed[:len(trimmed)-1]...)
+	if len(bytes.TrimSpace(spliced)) > 1 {
+		spliced = append(spliced, ',')
+	}
+	return append(spliced, decoded[1:]...), nil
+}
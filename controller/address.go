@@ -1,11 +1,7 @@
 package controller
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"explorer/db"
-	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"explorer/store"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strings"
@@ -15,54 +11,24 @@ func GetAddressDetail(c *gin.Context) {
 	address := c.Param("address")
 	if address == "" {
 		c.IndentedJSON(http.StatusBadRequest, "")
+		return
 	}
-	blockReq := esapi.GetRequest{
-		Index:      "address",
-		DocumentID: address,
-	}
-	res, err := blockReq.Do(context.Background(), db.EsClient)
+	doc, err := store.Repo.GetAddress(address)
 	if err != nil {
 		panic(err)
 	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
-	}
-	c.IndentedJSON(res.StatusCode, response)
+	docResponse(c, doc)
 }
 func GetAddressesDetail(c *gin.Context) {
 	addresses := c.DefaultQuery("addresses", "")
 	if addresses == "" {
 		c.IndentedJSON(http.StatusBadRequest, "")
+		return
 	}
 	list := strings.Split(addresses, `,`)
-	body := map[string]interface{}{
-		"query": map[string]interface{}{
-			"ids": map[string]interface{}{
-				"values": list,
-			},
-		},
-	}
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(body)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, "")
-	}
-	blockReq := esapi.SearchRequest{
-		Index: []string{"address"},
-		Body:  &buf,
-	}
-	res, err := blockReq.Do(context.Background(), db.EsClient)
+	result, err := store.Repo.ListAddresses(list)
 	if err != nil {
 		panic(err)
 	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
-	}
-	c.IndentedJSON(res.StatusCode, response)
+	searchResponse(c, result)
 }
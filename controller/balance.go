@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"explorer/store"
+	"explorer/sync"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// balanceEnabled 没有开启SYNC_BALANCE时余额不会写入，直接返回501，不返回看起来像是没有余额的空结果
+func balanceEnabled(c *gin.Context) bool {
+	if !sync.BalanceEnabled() {
+		c.IndentedJSON(http.StatusNotImplemented, sync.ErrBalanceDisabled.Error())
+		return false
+	}
+	return true
+}
+
+// GetCurrentBalance 获取地址最后一次记录的余额
+func GetCurrentBalance(c *gin.Context) {
+	if !balanceEnabled(c) {
+		return
+	}
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	doc, err := store.Repo.FindBalance(address, math.MaxUint64)
+	if err != nil {
+		panic(err)
+	}
+	docResponse(c, doc)
+}
+
+// GetBalanceAt 获取地址在一个块之后的余额，也就是这个块之前(含)最后一次记录的余额
+func GetBalanceAt(c *gin.Context) {
+	if !balanceEnabled(c) {
+		return
+	}
+	address := c.Param("address")
+	number, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if address == "" || err != nil {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	doc, err := store.Repo.FindBalance(address, number)
+	if err != nil {
+		panic(err)
+	}
+	docResponse(c, doc)
+}
+
+// GetBalanceHistory 获取地址的余额历史，按高度倒序
+func GetBalanceHistory(c *gin.Context) {
+	if !balanceEnabled(c) {
+		return
+	}
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListBalances(address, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"encoding/json"
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+)
+
+// blobFee 一个块的blob gas价格，画价格走势只需要这些字段
+type blobFee struct {
+	Number        string `json:"number"`
+	Time          uint64 `json:"timestamp"`
+	BlobCount     int    `json:"blobCount"`
+	BlobGasUsed   string `json:"blobGasUsed"`
+	ExcessBlobGas string `json:"excessBlobGas"`
+	BlobGasPrice  string `json:"blobGasPrice"`
+}
+
+// GetBlobBlocks 有blob的块，按高度倒序，blobCount是块里的blob数量
+func GetBlobBlocks(c *gin.Context) {
+	result, err := store.Repo.ListBlobBlocks(getPage(c), true)
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetBlobFees 坎昆升级之后每个块的blob gas价格，按高度倒序，只返回blob相关的字段
+func GetBlobFees(c *gin.Context) {
+	result, err := store.Repo.ListBlobBlocks(getPage(c), false)
+	if err != nil {
+		panic(err)
+	}
+	for _, doc := range result.Hits {
+		var block store.ESBlock
+		err = json.Unmarshal(doc.Source, &block)
+		if err != nil {
+			panic(err)
+		}
+		doc.Source, err = json.Marshal(&blobFee{
+			Number:        block.Number,
+			Time:          block.Time,
+			BlobCount:     block.BlobCount,
+			BlobGasUsed:   block.BlobGasUsed,
+			ExcessBlobGas: block.ExcessBlobGas,
+			BlobGasPrice:  block.BlobGasPrice,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	searchResponse(c, result)
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetInternalTxsByTx 获取交易里的内部调用，按调用顺序排列
+func GetInternalTxsByTx(c *gin.Context) {
+	tx := c.Param("tx")
+	if tx == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListInternalTxsByTx(tx, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetInternalTxsByAddress 获取from或to是address的内部调用
+func GetInternalTxsByAddress(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListInternalTxsByAddress(address, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetNftInventory 获取地址当前持有的nft
+func GetNftInventory(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListNftInventory(address, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetNftHistory 获取一个nft的转账记录，也就是它的持有历史
+func GetNftHistory(c *gin.Context) {
+	token := c.Param("token")
+	tokenId := c.Param("tokenId")
+	if token == "" || tokenId == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenTransfersByTokenId(token, tokenId, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetNftHolders 获取一个nft合约的持有人，按持有的数量倒序
+func GetNftHolders(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListNftHolders(token, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetReorgs 获取区块重组记录
+func GetReorgs(c *gin.Context) {
+	result, err := store.Repo.ListReorgs(getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetReorgByTx 查询交易是否因为区块重组被回滚
+func GetReorgByTx(c *gin.Context) {
+	tx := c.Param("tx")
+	if tx == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListReorgsByTx(tx)
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
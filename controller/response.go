@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// getPage 读取size和page参数，默认第1页每页20条
+func getPage(c *gin.Context) store.Page {
+	defaultSize := 20
+	sizeStr := c.DefaultQuery("size", "20")
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil {
+		size = defaultSize
+	}
+	defaultPage := 1
+	pageStr := c.DefaultQuery("page", "1")
+	page, err := strconv.Atoi(pageStr)
+	if err != nil {
+		page = defaultPage
+	}
+	return store.Page{From: (page - 1) * size, Size: size}
+}
+
+// docResponse 按es get接口的格式返回文档，前端不需要关心存储后端
+func docResponse(c *gin.Context, doc *store.Doc) {
+	response := gin.H{
+		"_index": doc.Index,
+		"_type":  "_doc",
+		"_id":    doc.Id,
+		"found":  doc.Found,
+	}
+	if !doc.Found {
+		c.IndentedJSON(http.StatusNotFound, response)
+		return
+	}
+	response["_source"] = doc.Source
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// searchResponse 按es search接口的格式返回列表
+func searchResponse(c *gin.Context, result *store.SearchResult) {
+	hits := make([]gin.H, 0, len(result.Hits))
+	for _, doc := range result.Hits {
+		hits = append(hits, gin.H{
+			"_index":  doc.Index,
+			"_type":   "_doc",
+			"_id":     doc.Id,
+			"_score":  nil,
+			"_source": doc.Source,
+		})
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"timed_out": false,
+		"hits": gin.H{
+			"total": gin.H{
+				"value":    result.Total,
+				"relation": result.Relation,
+			},
+			"max_score": nil,
+			"hits":      hits,
+		},
+	})
+}
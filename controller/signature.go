@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"explorer/decode"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// selector是4个字节，topic0是32个字节
+var signatureIdPattern = regexp.MustCompile(`^0x([0-9a-fA-F]{8}|[0-9a-fA-F]{64})$`)
+
+// GetSignatures 获取selector或topic0对应的签名，包括内置的、本地文件里的和通过接口添加的
+func GetSignatures(c *gin.Context) {
+	id := c.Param("id")
+	if !signatureIdPattern.MatchString(id) {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	signatures, err := decode.LookupSignatures(id)
+	if err != nil {
+		panic(err)
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"id":         id,
+		"signatures": signatures,
+	})
+}
+
+// AddSignatures 添加签名，body每行一个签名，和签名文件的格式一样，返回规范化后的签名
+func AddSignatures(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	signatures, err := decode.ParseSignatures(string(body))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(signatures) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	err = decode.SaveSignatures(signatures)
+	if err != nil {
+		panic(err)
+	}
+	c.IndentedJSON(http.StatusOK, signatures)
+}
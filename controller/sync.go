@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"errors"
+	"explorer/store"
+	"explorer/sync"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// GetSyncStats 获取同步的吞吐量和队列长度
+func GetSyncStats(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, sync.GetStats())
+}
+
+// GetSyncStatus 获取已经完整写入的最后一个块和链上最新块
+func GetSyncStatus(c *gin.Context) {
+	status, err := sync.GetStatus()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.IndentedJSON(http.StatusOK, status)
+}
+
+// GetVerify 获取最近一次缺块校验的结果
+func GetVerify(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, sync.GetVerifyResult())
+}
+
+// StartVerify 手动校验并补齐[from, to]之间缺失的块，to不传时校验到同步进度
+func StartVerify(c *gin.Context) {
+	from, err := strconv.ParseUint(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := strconv.ParseUint(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	err = sync.StartVerify(from, to)
+	if errors.Is(err, sync.ErrVerifyRunning) {
+		c.IndentedJSON(http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, sync.ErrVerifyRange) || errors.Is(err, sync.ErrNoCheckpoint) {
+		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	c.IndentedJSON(http.StatusAccepted, sync.GetVerifyResult())
+}
+
+// GetDeadLetters 获取多次重试仍然同步失败的块
+func GetDeadLetters(c *gin.Context) {
+	result, err := store.Repo.ListDeadLetters(getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetTokenHolders 获取一个代币的持有人，按数量倒序
+func GetTokenHolders(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenHolders(token, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetTokenBalances 获取地址持有的所有代币的余额
+func GetTokenBalances(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenBalances(address, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
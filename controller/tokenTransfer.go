@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"explorer/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetTokenTransfersByToken 获取一个代币的转账
+func GetTokenTransfersByToken(c *gin.Context) {
+	token := c.Param("token")
+	if token == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenTransfersByToken(token, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetTokenTransfersByAddress 获取from或to是address的代币转账
+func GetTokenTransfersByAddress(c *gin.Context) {
+	address := c.Param("address")
+	if address == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenTransfersByAddress(address, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
+
+// GetTokenTransfersByTx 获取交易里的代币转账，按日志顺序排列
+func GetTokenTransfersByTx(c *gin.Context) {
+	tx := c.Param("tx")
+	if tx == "" {
+		c.IndentedJSON(http.StatusBadRequest, "")
+		return
+	}
+	result, err := store.Repo.ListTokenTransfersByTx(tx, getPage(c))
+	if err != nil {
+		panic(err)
+	}
+	searchResponse(c, result)
+}
@@ -1,261 +1,104 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"explorer/db"
-	"explorer/sync"
-	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"explorer/store"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strconv"
 )
 
 func GetTx(c *gin.Context) {
 	tx := c.Param("tx")
 	if tx == "" {
 		c.IndentedJSON(http.StatusBadRequest, "")
+		return
 	}
-	req := esapi.GetRequest{
-		Index:      "tx",
-		DocumentID: tx,
-	}
-	res, err := req.Do(context.Background(), db.EsClient)
+	doc, err := store.Repo.GetTx(tx)
 	if err != nil {
 		panic(err)
 	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
+	if doc.Found {
+		doc.Source, err = decodeTx(doc.Source)
+		if err != nil {
+			panic(err)
+		}
 	}
-	c.IndentedJSON(res.StatusCode, response)
+	docResponse(c, doc)
 }
 
-// GetTxs 获取所有的tx 如果指定block则获取所有block的tx
+// GetTxs 获取所有的tx 如果指定block则获取所有block的tx，指定finality则按确认状态过滤
 func GetTxs(c *gin.Context) {
 	blockStr := c.DefaultQuery("block", "")
-	defaultSize := 20
-	sizeStr := c.DefaultQuery("size", "20")
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		size = defaultSize
-	}
-	defaultPage := 1
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = defaultPage
-	}
-	from := (page - 1) * size
-	body := map[string]interface{}{}
-	if blockStr != "" {
-		body = map[string]interface{}{
-			"sort": [1]interface{}{
-				map[string]interface{}{
-					"timestamp": map[string]interface{}{
-						"order": "desc",
-					},
-				},
-			},
-			"query": map[string]interface{}{
-				"match": map[string]interface{}{
-					"number": blockStr,
-				},
-			},
-		}
-	} else {
-		body = map[string]interface{}{
-			"sort": [1]interface{}{
-				map[string]interface{}{
-					"timestamp": map[string]interface{}{
-						"order": "desc",
-					},
-				},
-			},
-		}
-	}
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(body)
+	finality := c.DefaultQuery("finality", "")
+	result, err := store.Repo.ListTxs(getPage(c), blockStr, finality)
 	if err != nil {
 		panic(err)
 	}
-	req := esapi.SearchRequest{
-		Index: []string{"tx"},
-		Size:  &size,
-		From:  &from,
-		Body:  &buf,
-	}
-
-	res, err := req.Do(context.Background(), db.EsClient)
-	if err != nil {
-		panic(err)
-	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
+	for _, doc := range result.Hits {
+		doc.Source, err = decodeTx(doc.Source)
+		if err != nil {
+			panic(err)
+		}
 	}
-
-	c.IndentedJSON(res.StatusCode, response)
+	searchResponse(c, result)
 }
 
 func GetTxByAddress(c *gin.Context) {
 	address := c.Param("address")
 	if address == "" {
 		c.IndentedJSON(http.StatusBadRequest, "")
+		return
 	}
-	defaultSize := 20
-	sizeStr := c.DefaultQuery("size", "20")
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		size = defaultSize
-	}
-	defaultPage := 1
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = defaultPage
-	}
-	from := (page - 1) * size
-	body := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": [2]interface{}{
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"to.keyword": map[string]interface{}{
-								"value": address,
-							},
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"from.keyword": map[string]interface{}{
-								"value": address,
-							},
-						},
-					},
-				},
-			},
-		},
-		"sort": [1]interface{}{
-			map[string]interface{}{
-				"timestamp": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-	}
-
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(body)
-	if err != nil {
-		panic(err)
-	}
-	req := esapi.SearchRequest{
-		Index: []string{"tx"},
-		Size:  &size,
-		From:  &from,
-		Body:  &buf,
-	}
-
-	res, err := req.Do(context.Background(), db.EsClient)
-	if err != nil {
-		panic(err)
-	}
-	defer res.Body.Close()
-	var response any
-	err = json.NewDecoder(res.Body).Decode(&response)
+	result, err := store.Repo.ListTxsByAddress(address, getPage(c))
 	if err != nil {
 		panic(err)
 	}
-	// byt, err := io.ReadAll(res.Body)
-	// str := string(byt)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// if res.StatusCode > 300 {
-	// 	c.IndentedJSON(res.StatusCode, str)
-	// }
-	// fmt.Println(str)
-	// response := []byte(``)
-	// err = json.Unmarshal(response, &str)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	c.IndentedJSON(res.StatusCode, response)
+	searchResponse(c, result)
 }
 
 func RefreshAddress(c *gin.Context) {
 	address := c.Param("address")
 	if address == "" {
 		c.IndentedJSON(http.StatusBadRequest, "")
+		return
 	}
 
 	code, err := db.EthClient.CodeAt(context.Background(), common.HexToAddress(address), nil)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
 	}
-	req := esapi.GetRequest{
-		Index:      "address",
-		DocumentID: address,
-	}
-	res, err := req.Do(context.Background(), db.EsClient)
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, err.Error())
-	}
-	defer res.Body.Close()
-	var response sync.ESAddress
-	err = json.NewDecoder(res.Body).Decode(&response)
+	doc, err := store.Repo.GetAddress(address)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
 	}
-	codeStr := string(code[:])
-	if codeStr == "" && response.Type == 2 {
-		// 修改为 地址
-		body := map[string]interface{}{
-			"type": 1,
-		}
-		var buf bytes.Buffer
-		err = json.NewEncoder(&buf).Encode(body)
+	var response store.ESAddress
+	if doc.Found {
+		err = json.Unmarshal(doc.Source, &response)
 		if err != nil {
 			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
-		updateReq := esapi.UpdateRequest{
-			Index:      "address",
-			DocumentID: address,
-			Body:       &buf,
-		}
-		res, err = updateReq.Do(context.Background(), db.EsClient)
-		if err != nil {
-			c.IndentedJSON(http.StatusBadRequest, err.Error())
-		}
-		defer res.Body.Close()
 	}
-	if codeStr != "" && response.Type == 1 {
-		body := map[string]interface{}{
-			"type": 2,
-		}
-		var buf bytes.Buffer
-		err = json.NewEncoder(&buf).Encode(body)
+	codeStr := string(code[:])
+	if codeStr == "" && response.Type == store.AddressTypeContract {
+		// 修改为 地址
+		err = store.Repo.UpdateAddressType(address, store.AddressTypeAccount)
 		if err != nil {
 			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
-		updateReq := esapi.UpdateRequest{
-			Index:      "address",
-			DocumentID: address,
-			Body:       &buf,
-		}
-		res, err = updateReq.Do(context.Background(), db.EsClient)
+	}
+	if codeStr != "" && response.Type == store.AddressTypeAccount {
+		err = store.Repo.UpdateAddressType(address, store.AddressTypeContract)
 		if err != nil {
 			c.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
-		defer res.Body.Close()
 	}
 	result := "address"
 	if codeStr != "" {
@@ -264,126 +107,18 @@ func RefreshAddress(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, result)
 }
 func GetContracts(c *gin.Context) {
-	defaultSize := 20
-	sizeStr := c.DefaultQuery("size", "20")
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		size = defaultSize
-	}
-	defaultPage := 1
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = defaultPage
-	}
-	from := (page - 1) * size
-	body := map[string]interface{}{
-		"sort": [1]interface{}{
-			map[string]interface{}{
-				"timestamp": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must_not": [1]interface{}{
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"contractAddress.keyword": map[string]interface{}{
-								"value": "",
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(body)
-	if err != nil {
-		panic(err)
-	}
-	req := esapi.SearchRequest{
-		Index: []string{"tx"},
-		Size:  &size,
-		From:  &from,
-		Body:  &buf,
-	}
-	res, err := req.Do(context.Background(), db.EsClient)
+	result, err := store.Repo.ListContractCreations(getPage(c))
 	if err != nil {
 		panic(err)
 	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
-	}
-
-	c.IndentedJSON(res.StatusCode, response)
-
+	searchResponse(c, result)
 }
 func GetContractTxs(c *gin.Context) {
-	defaultSize := 20
-	sizeStr := c.DefaultQuery("size", "20")
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		size = defaultSize
-	}
-	defaultPage := 1
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = defaultPage
-	}
-	from := (page - 1) * size
-	body := map[string]interface{}{
-		"sort": [1]interface{}{
-			map[string]interface{}{
-				"timestamp": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"filter": [1]interface{}{
-					map[string]interface{}{
-						"range": map[string]interface{}{
-							"logLength": map[string]interface{}{
-								"gt": 0,
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	var buf bytes.Buffer
-	err = json.NewEncoder(&buf).Encode(body)
+	result, err := store.Repo.ListContractTxs(getPage(c))
 	if err != nil {
 		panic(err)
 	}
-	req := esapi.SearchRequest{
-		Index: []string{"tx"},
-		Size:  &size,
-		From:  &from,
-		Body:  &buf,
-	}
-	res, err := req.Do(context.Background(), db.EsClient)
-	if err != nil {
-		panic(err)
-	}
-	defer res.Body.Close()
-	var response any
-	err2 := json.NewDecoder(res.Body).Decode(&response)
-	if err2 != nil {
-		panic(err2)
-	}
-
-	c.IndentedJSON(res.StatusCode, response)
-
+	searchResponse(c, result)
 }
 
 //
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"log"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var BoltClient *bolt.DB
+
+// 内嵌存储的bucket，Index结尾的是按查询条件排序的二级索引，value为空或者是主键
+var (
+	BlockBucket               = []byte("block")
+	BlockHashIndex            = []byte("blockHash")
+	TxBucket                  = []byte("tx")
+	TxTimeIndex               = []byte("txTime")
+	TxAddressIndex            = []byte("txAddress")
+	TxBlockIndex              = []byte("txBlock")
+	ContractCreationIndex     = []byte("contractCreation")
+	ContractTxIndex           = []byte("contractTx")
+	InternalTxBucket          = []byte("internalTx")
+	InternalTxTxIndex         = []byte("internalTxTx")
+	InternalTxAddressIndex    = []byte("internalTxAddress")
+	InternalTxBlockIndex      = []byte("internalTxBlock")
+	TokenTransferBucket       = []byte("tokenTransfer")
+	TokenTransferTxIndex      = []byte("tokenTransferTx")
+	TokenTransferTokenIndex   = []byte("tokenTransferToken")
+	TokenTransferAddressIndex = []byte("tokenTransferAddress")
+	TokenTransferBlockIndex   = []byte("tokenTransferBlock")
+	TokenTransferTokenIdIndex = []byte("tokenTransferTokenId")
+	TokenBalanceBucket        = []byte("tokenBalance")
+	TokenBalanceHolderIndex   = []byte("tokenBalanceHolder")
+	TokenBalanceTokenIndex    = []byte("tokenBalanceToken")
+	TokenBalanceAmountIndex   = []byte("tokenBalanceAmount")
+	BalanceBucket             = []byte("balance")
+	BalanceAddressIndex       = []byte("balanceAddress")
+	BalanceBlockIndex         = []byte("balanceBlock")
+	AbiBucket                 = []byte("abi")
+	SignatureBucket           = []byte("signature")
+	SignatureIdIndex          = []byte("signatureId")
+	AddressBucket             = []byte("address")
+	ReorgBucket               = []byte("reorg")
+	ReorgTxIndex              = []byte("reorgTx")
+	SyncBucket                = []byte("sync")
+	DeadLetterBucket          = []byte("deadletter")
+)
+
+// EMBEDDED_DB_PATH 内嵌存储的文件路径，默认是当前目录下的explorer.db
+func InitBoltClient() {
+	path := os.Getenv("EMBEDDED_DB_PATH")
+	if path == "" {
+		path = "explorer.db"
+	}
+	bc, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("Error open the embedded db %s: %s", path, err)
+	}
+	err = bc.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{BlockBucket, BlockHashIndex, TxBucket, TxTimeIndex, TxAddressIndex, TxBlockIndex,
+			ContractCreationIndex, ContractTxIndex, InternalTxBucket, InternalTxTxIndex, InternalTxAddressIndex, InternalTxBlockIndex,
+			TokenTransferBucket, TokenTransferTxIndex, TokenTransferTokenIndex, TokenTransferAddressIndex, TokenTransferBlockIndex,
+			TokenTransferTokenIdIndex, TokenBalanceBucket, TokenBalanceHolderIndex, TokenBalanceTokenIndex,
+			TokenBalanceAmountIndex, BalanceBucket, BalanceAddressIndex, BalanceBlockIndex, AbiBucket,
+			SignatureBucket, SignatureIdIndex, AddressBucket, ReorgBucket, ReorgTxIndex, SyncBucket, DeadLetterBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Error create the embedded db buckets: %s", err)
+	}
+	BoltClient = bc
+}
@@ -1,14 +1,32 @@
 package db
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/elastic/go-elasticsearch/v7"
 )
 
 var EsClient *elasticsearch.Client
 
+// 索引名都是别名，实际的索引是带版本号的 block_v1、tx_v1 等，迁移时切换别名
+var (
+	BlockIndex         = "block"
+	TxIndex            = "tx"
+	AddressIndex       = "address"
+	ReorgIndex         = "reorg"
+	SyncIndex          = "sync"
+	DeadLetterIndex    = "deadletter"
+	InternalTxIndex    = "internaltx"
+	TokenTransferIndex = "tokentransfer"
+	TokenBalanceIndex  = "tokenbalance"
+	BalanceIndex       = "balance"
+	AbiIndex           = "abi"
+	SignatureIndex     = "signature"
+)
+
 func InitEsClient() {
 
 	ElasticsearchPath := os.Getenv("ELASTICSEARCH_PATH")
@@ -27,49 +45,38 @@ func InitEsClient() {
 	if res.IsError() {
 		log.Fatalf("Error: %s", res.String())
 	}
-	blockResponse, err := ec.Indices.Exists([]string{"block"})
-	if err != nil {
-		log.Fatalf("Error exists the block index: %s", err)
-	}
-	if blockResponse.StatusCode == 404 {
-		var createIndexResponse, err = ec.Indices.Create("block")
-		if err != nil {
-			log.Fatalf("Error create the block index: %s", err)
-		}
-		if createIndexResponse.IsError() {
-			log.Fatalf("Error create the block index: %s", err)
-		}
-	}
-	defer blockResponse.Body.Close()
-	txResponse, err := ec.Indices.Exists([]string{"tx"})
-	if err != nil {
-		log.Fatalf("Error exists the tx index: %s", err)
+	putTemplates(ec)
+	for _, index := range []string{BlockIndex, TxIndex, AddressIndex, ReorgIndex, SyncIndex, DeadLetterIndex, InternalTxIndex, TokenTransferIndex, TokenBalanceIndex, BalanceIndex, AbiIndex, SignatureIndex} {
+		initIndex(ec, index)
+		putMappings(ec, index)
 	}
-	if txResponse.StatusCode == 404 {
-		var createIndexResponse, err = ec.Indices.Create("tx")
-		if err != nil {
-			log.Fatalf("Error create the tx index: %s", err)
-		}
-		if createIndexResponse.IsError() {
-			log.Fatalf("Error create the tx index: %s", err)
-		}
-	}
-	defer txResponse.Body.Close()
+	LegacyBlockIndex = isLegacyIndex(ec, BlockIndex, "number")
+}
+
+// VersionedIndex 别名对应的第version版索引
+func VersionedIndex(alias string, version int) string {
+	return fmt.Sprintf("%s_v%d", alias, version)
+}
 
-	addressResponse, err := ec.Indices.Exists([]string{"address"})
+// initIndex 别名(或旧版本的同名索引)不存在时创建第一版索引并指向别名
+func initIndex(ec *elasticsearch.Client, alias string) {
+	existsResponse, err := ec.Indices.Exists([]string{alias})
 	if err != nil {
-		log.Fatalf("Error exists the tx index: %s", err)
+		log.Fatalf("Error exists the %s index: %s", alias, err)
 	}
-	if addressResponse.StatusCode == 404 {
-		var createIndexResponse, err = ec.Indices.Create("address")
+	defer existsResponse.Body.Close()
+	if existsResponse.StatusCode == 404 {
+		index := VersionedIndex(alias, 1)
+		body := fmt.Sprintf(`{"aliases": {%q: {}}}`, alias)
+		createIndexResponse, err := ec.Indices.Create(index, ec.Indices.Create.WithBody(strings.NewReader(body)))
 		if err != nil {
-			log.Fatalf("Error create the tx index: %s", err)
+			log.Fatalf("Error create the %s index: %s", index, err)
 		}
+		defer createIndexResponse.Body.Close()
 		if createIndexResponse.IsError() {
-			log.Fatalf("Error create the tx index: %s", err)
+			log.Fatalf("Error create the %s index: %s", index, createIndexResponse.String())
 		}
 	}
-	defer addressResponse.Body.Close()
 }
 
 type Shards struct {
@@ -2,25 +2,46 @@ package db
 
 import (
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"log"
 	"os"
+	"strings"
 )
 
 var EthClient *ethclient.Client
 
+// RpcClient 底层的rpc连接，用于ethclient没有封装的方法和批量请求
+var RpcClient *rpc.Client
+
+// SubscribeClient 支持订阅的连接(websocket或ipc)，没有配置时为nil，同步退回轮询
+var SubscribeClient *ethclient.Client
+
 func InitEthClient() {
+	// CHAIN_HTTP_URL 可以是http、websocket地址，也可以是ipc文件路径(例如 /home/chain/rpc/geth.ipc)
 	ChainHttpUrl := os.Getenv("CHAIN_HTTP_URL")
-	// todo 这里应该连接ipc更快
-	// _path := "/home/chain/rpc/geth.ipc"
 	_path := ChainHttpUrl
-	// bootClient, err := rpc.Dial(_path)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	gcl, err := ethclient.Dial(_path)
+	rpcClient, err := rpc.Dial(_path)
 	if err != nil {
 		log.Fatalf("Error: %s", "create eth client failed")
 		os.Exit(1)
 	}
-	EthClient = gcl
+	RpcClient = rpcClient
+	EthClient = ethclient.NewClient(rpcClient)
+	if !isHttpUrl(_path) {
+		SubscribeClient = EthClient
+		return
+	}
+	// http连接不能订阅，另外配置websocket或ipc地址用于订阅新块
+	ChainWsUrl := os.Getenv("CHAIN_WS_URL")
+	if ChainWsUrl != "" {
+		subscribeClient, err := ethclient.Dial(ChainWsUrl)
+		if err != nil {
+			log.Fatalf("Error: %s", "create eth subscribe client failed")
+		}
+		SubscribeClient = subscribeClient
+	}
+}
+
+func isHttpUrl(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
 }
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// 各个索引的模板，修改mapping时需要同时增加模板里的version
+//
+//go:embed mappings/*.json
+var mappings embed.FS
+
+// putTemplates 创建或更新索引模板，只对之后新建的索引生效
+func putTemplates(ec *elasticsearch.Client) {
+	entries, err := mappings.ReadDir("mappings")
+	if err != nil {
+		log.Fatalf("Error read the index templates: %s", err)
+	}
+	for _, entry := range entries {
+		body, err := mappings.ReadFile("mappings/" + entry.Name())
+		if err != nil {
+			log.Fatalf("Error read the index template %s: %s", entry.Name(), err)
+		}
+		name := "explorer-" + strings.TrimSuffix(entry.Name(), ".json")
+		res, err := ec.Indices.PutIndexTemplate(name, bytes.NewReader(body))
+		if err != nil {
+			log.Fatalf("Error put the index template %s: %s", name, err)
+		}
+		if res.IsError() {
+			res.Body.Close()
+			log.Fatalf("Error put the index template %s: %s", name, res.String())
+		}
+		res.Body.Close()
+	}
+}
+
+// putMappings 把模板里的mapping加到别名指向的现有索引上，模板只对新建的索引生效，
+// 不加的话旧索引里新增的字段(例如tx的revert)会按动态mapping创建，类型冲突时写入失败
+//
+// 已有字段的类型不能修改，冲突时只打印日志，需要用 ./main migrate -index 重建索引
+func putMappings(ec *elasticsearch.Client, alias string) {
+	body, err := mappings.ReadFile("mappings/" + alias + ".json")
+	if err != nil {
+		return
+	}
+	var template struct {
+		Template struct {
+			Mappings json.RawMessage `json:"mappings"`
+		} `json:"template"`
+	}
+	err = json.Unmarshal(body, &template)
+	if err != nil || len(template.Template.Mappings) == 0 {
+		log.Fatalf("Error read the index template %s: %v", alias, err)
+	}
+	res, err := ec.Indices.PutMapping(bytes.NewReader(template.Template.Mappings), ec.Indices.PutMapping.WithIndex(alias))
+	if err != nil {
+		log.Fatalf("Error put the %s mapping: %s", alias, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Printf("Warning: the %s mapping conflicts with the template, run ./main migrate -index %s: %s", alias, alias, res.String())
+	}
+}
+
+// LegacyBlockIndex block索引是旧版本按动态mapping创建的，number是text不能排序，迁移之前按timestamp排序
+var LegacyBlockIndex bool
+
+// isLegacyIndex 别名指向的索引里field不是long时认为是旧版本按动态mapping创建的索引
+func isLegacyIndex(ec *elasticsearch.Client, alias string, field string) bool {
+	res, err := ec.Indices.GetFieldMapping([]string{field}, ec.Indices.GetFieldMapping.WithIndex(alias))
+	if err != nil {
+		log.Fatalf("Error get the %s mapping: %s", alias, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Fatalf("Error get the %s mapping: %s", alias, res.String())
+	}
+	var indices map[string]struct {
+		Mappings map[string]struct {
+			Mapping map[string]struct {
+				Type string `json:"type"`
+			} `json:"mapping"`
+		} `json:"mappings"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&indices)
+	if err != nil {
+		log.Fatalf("Error decode the %s mapping: %s", alias, err)
+	}
+	for index, mapping := range indices {
+		if mapping.Mappings[field].Mapping[field].Type != "long" {
+			log.Printf("Warning: %s of the index %s is not a long, sort by timestamp until ./main migrate -index %s", field, index, alias)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+-- hash和地址列都保存小写，和es的lowercase normalizer一致
+-- doc是接口返回的完整文档，其余列用于查询和排序
+
+CREATE TABLE blocks (
+    number      BIGINT PRIMARY KEY,
+    hash        TEXT    NOT NULL,
+    parent_hash TEXT    NOT NULL,
+    timestamp   BIGINT  NOT NULL,
+    txns        INTEGER NOT NULL,
+    finality    TEXT    NOT NULL DEFAULT '',
+    doc         JSONB   NOT NULL
+);
+CREATE INDEX blocks_hash_idx ON blocks (hash);
+CREATE INDEX blocks_timestamp_idx ON blocks (timestamp);
+CREATE INDEX blocks_finality_idx ON blocks (finality, number);
+
+CREATE TABLE txs (
+    hash             TEXT PRIMARY KEY,
+    block_number     BIGINT  NOT NULL,
+    block_hash       TEXT    NOT NULL,
+    tx_index         INTEGER NOT NULL,
+    timestamp        BIGINT  NOT NULL,
+    from_address     TEXT    NOT NULL,
+    to_address       TEXT    NOT NULL,
+    contract_address TEXT    NOT NULL,
+    log_length       INTEGER NOT NULL,
+    finality         TEXT    NOT NULL DEFAULT '',
+    doc              JSONB   NOT NULL
+);
+CREATE INDEX txs_block_number_idx ON txs (block_number);
+CREATE INDEX txs_block_hash_idx ON txs (block_hash);
+CREATE INDEX txs_timestamp_idx ON txs (timestamp DESC, block_number DESC, tx_index DESC);
+CREATE INDEX txs_from_idx ON txs (from_address, timestamp DESC);
+CREATE INDEX txs_to_idx ON txs (to_address, timestamp DESC);
+CREATE INDEX txs_contract_idx ON txs (timestamp DESC) WHERE contract_address <> '';
+CREATE INDEX txs_log_idx ON txs (timestamp DESC) WHERE log_length > 0;
+CREATE INDEX txs_finality_idx ON txs (finality, timestamp DESC);
+
+CREATE TABLE logs (
+    tx_hash      TEXT    NOT NULL REFERENCES txs (hash) ON DELETE CASCADE,
+    log_index    INTEGER NOT NULL,
+    block_number BIGINT  NOT NULL,
+    address      TEXT    NOT NULL,
+    topic0       TEXT,
+    topic1       TEXT,
+    topic2       TEXT,
+    topic3       TEXT,
+    data         BYTEA   NOT NULL,
+    PRIMARY KEY (tx_hash, log_index)
+);
+CREATE INDEX logs_address_idx ON logs (address, block_number);
+CREATE INDEX logs_topic0_idx ON logs (topic0, block_number);
+
+-- address和es的_id一样区分大小写
+CREATE TABLE addresses (
+    address TEXT PRIMARY KEY,
+    type    SMALLINT NOT NULL,
+    doc     JSONB    NOT NULL
+);
+
+CREATE TABLE reorgs (
+    id        BIGSERIAL PRIMARY KEY,
+    number    BIGINT NOT NULL,
+    timestamp BIGINT NOT NULL,
+    tx_hashes TEXT[] NOT NULL,
+    doc       JSONB  NOT NULL
+);
+CREATE INDEX reorgs_timestamp_idx ON reorgs (timestamp);
+CREATE INDEX reorgs_tx_hashes_idx ON reorgs USING GIN (tx_hashes);
+
+CREATE TABLE sync_state (
+    id  TEXT PRIMARY KEY,
+    doc JSONB NOT NULL
+);
+
+CREATE TABLE dead_letters (
+    number    BIGINT PRIMARY KEY,
+    timestamp BIGINT NOT NULL,
+    doc       JSONB  NOT NULL
+);
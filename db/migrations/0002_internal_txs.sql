@@ -0,0 +1,17 @@
+-- 合约发起的内部调用，交易删除时一起删除
+CREATE TABLE internal_txs (
+    id           TEXT PRIMARY KEY,
+    tx_hash      TEXT    NOT NULL REFERENCES txs (hash) ON DELETE CASCADE,
+    block_number BIGINT  NOT NULL,
+    timestamp    BIGINT  NOT NULL,
+    tx_index     INTEGER NOT NULL,
+    call_index   INTEGER NOT NULL,
+    type         TEXT    NOT NULL,
+    from_address TEXT    NOT NULL,
+    to_address   TEXT    NOT NULL,
+    error        TEXT    NOT NULL,
+    doc          JSONB   NOT NULL
+);
+CREATE INDEX internal_txs_tx_idx ON internal_txs (tx_hash, call_index);
+CREATE INDEX internal_txs_from_idx ON internal_txs (from_address, timestamp DESC);
+CREATE INDEX internal_txs_to_idx ON internal_txs (to_address, timestamp DESC);
@@ -0,0 +1,16 @@
+-- 从日志解析出的代币转账，交易删除时一起删除
+CREATE TABLE token_transfers (
+    id           TEXT PRIMARY KEY,
+    tx_hash      TEXT    NOT NULL REFERENCES txs (hash) ON DELETE CASCADE,
+    block_number BIGINT  NOT NULL,
+    log_index    INTEGER NOT NULL,
+    standard     TEXT    NOT NULL,
+    token        TEXT    NOT NULL,
+    from_address TEXT    NOT NULL,
+    to_address   TEXT    NOT NULL,
+    doc          JSONB   NOT NULL
+);
+CREATE INDEX token_transfers_tx_idx ON token_transfers (tx_hash, log_index);
+CREATE INDEX token_transfers_token_idx ON token_transfers (token, block_number DESC, log_index DESC);
+CREATE INDEX token_transfers_from_idx ON token_transfers (from_address, block_number DESC, log_index DESC);
+CREATE INDEX token_transfers_to_idx ON token_transfers (to_address, block_number DESC, log_index DESC);
@@ -0,0 +1,18 @@
+-- nft转账按tokenId查询持有历史，TransferBatch里的转账按batch_index排列
+ALTER TABLE token_transfers ADD COLUMN token_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE token_transfers ADD COLUMN batch_index INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX token_transfers_token_id_idx ON token_transfers (token, token_id, block_number DESC, log_index DESC, batch_index DESC);
+
+-- 每个地址持有的代币数量，nft按tokenId分别记录，数量为0时删除
+CREATE TABLE token_balances (
+    id           TEXT PRIMARY KEY,
+    standard     TEXT           NOT NULL,
+    token        TEXT           NOT NULL,
+    token_id     TEXT           NOT NULL,
+    holder       TEXT           NOT NULL,
+    amount       NUMERIC(78, 0) NOT NULL,
+    block_number BIGINT,
+    doc          JSONB          NOT NULL
+);
+CREATE INDEX token_balances_holder_idx ON token_balances (holder, block_number DESC);
+CREATE INDEX token_balances_token_idx ON token_balances (token, holder);
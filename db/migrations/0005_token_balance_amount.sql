@@ -0,0 +1,2 @@
+-- erc20的余额也写入token_balances，按数量倒序查询代币的持有人
+CREATE INDEX token_balances_amount_idx ON token_balances (token, amount DESC);
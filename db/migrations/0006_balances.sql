@@ -0,0 +1,11 @@
+-- 地址在出现的块之后的原生币余额，孤块删除时按block_hash删除
+CREATE TABLE balances (
+    id           TEXT PRIMARY KEY,
+    address      TEXT           NOT NULL,
+    block_number BIGINT         NOT NULL,
+    block_hash   TEXT           NOT NULL,
+    balance      NUMERIC(78, 0) NOT NULL,
+    doc          JSONB          NOT NULL
+);
+CREATE INDEX balances_address_idx ON balances (address, block_number DESC);
+CREATE INDEX balances_block_hash_idx ON balances (block_hash);
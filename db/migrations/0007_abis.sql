@@ -0,0 +1,5 @@
+-- 通过接口上传的合约abi，address是小写地址
+CREATE TABLE abis (
+    address TEXT PRIMARY KEY,
+    doc     JSONB NOT NULL
+);
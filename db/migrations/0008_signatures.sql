@@ -0,0 +1,9 @@
+-- 通过接口添加的方法和事件签名，selector和topic都是小写
+CREATE TABLE signatures (
+    signature TEXT PRIMARY KEY,
+    selector  TEXT  NOT NULL,
+    topic     TEXT  NOT NULL,
+    doc       JSONB NOT NULL
+);
+CREATE INDEX signatures_selector_idx ON signatures (selector);
+CREATE INDEX signatures_topic_idx ON signatures (topic);
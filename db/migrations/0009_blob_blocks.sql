@@ -0,0 +1,3 @@
+-- 4844 坎昆升级之后的块和有blob的块，没有blob的块不保存blobCount
+CREATE INDEX blocks_excess_blob_gas_idx ON blocks (number DESC) WHERE doc ? 'excessBlobGas';
+CREATE INDEX blocks_blob_idx ON blocks (number DESC) WHERE doc ? 'blobCount';
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+var PgClient *sql.DB
+
+func InitPgClient() {
+	PostgresUrl := os.Getenv("POSTGRES_URL")
+	pc, err := sql.Open("postgres", PostgresUrl)
+	if err != nil {
+		log.Fatalf("Error creating the postgres client: %s", err)
+	}
+	err = pc.Ping()
+	if err != nil {
+		log.Fatalf("Error connecting the postgres: %s", err)
+	}
+	PgClient = pc
+	migrateSchema(pc)
+}
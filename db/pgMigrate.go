@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// postgres的表结构，按文件名前面的版本号依次执行，已经执行过的不会再执行
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrateSchema 执行还没有执行过的migration，每个文件在一个事务里
+func migrateSchema(pc *sql.DB) {
+	_, err := pc.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		log.Fatalf("Error create the schema_migrations table: %s", err)
+	}
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		log.Fatalf("Error read the migrations: %s", err)
+	}
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			log.Fatalf("Error parse the migration version %s: %s", entry.Name(), err)
+		}
+		var applied bool
+		err = pc.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+		if err != nil {
+			log.Fatalf("Error read the schema_migrations: %s", err)
+		}
+		if applied {
+			continue
+		}
+		body, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			log.Fatalf("Error read the migration %s: %s", entry.Name(), err)
+		}
+		tx, err := pc.Begin()
+		if err != nil {
+			log.Fatalf("Error begin the migration %s: %s", entry.Name(), err)
+		}
+		_, err = tx.Exec(string(body))
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Fatalf("Error apply the migration %s: %s", entry.Name(), err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			log.Fatalf("Error commit the migration %s: %s", entry.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package decode
+
+import (
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Arg 解析出的一个参数，revert数据的参数也保存在tx里，所以定义在store
+type Arg = store.ESArg
+
+// Call 解析出的交易调用，Guessed为true时是按签名库猜测的
+type Call struct {
+	Method    string `json:"method"`
+	Signature string `json:"signature"`
+	Args      []*Arg `json:"args"`
+	Guessed   bool   `json:"guessed"`
+}
+
+// Event 解析出的一条日志，Guessed为true时是按签名库猜测的
+type Event struct {
+	LogIndex  uint   `json:"logIndex"`
+	Address   string `json:"address"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Args      []*Arg `json:"args"`
+	Guessed   bool   `json:"guessed"`
+}
+
+// DecodeInput 按to地址的abi解析交易的input，abi里没有这个方法时按签名库猜测，都没有匹配时返回nil
+func DecodeInput(to string, input []byte) (*Call, error) {
+	if to == "" || len(input) < 4 {
+		return nil, nil
+	}
+	abis, err := candidateAbis(to)
+	if err != nil {
+		return nil, err
+	}
+	for _, contractAbi := range abis {
+		method, err := contractAbi.MethodById(input[:4])
+		if err != nil {
+			continue
+		}
+		call := decodeCall(method, input)
+		if call != nil {
+			return call, nil
+		}
+	}
+	return guessCall(input)
+}
+
+func decodeCall(method *abi.Method, input []byte) *Call {
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil
+	}
+	return &Call{
+		Method:    method.RawName,
+		Signature: method.Sig,
+		Args:      buildArgs(method.Inputs, values),
+	}
+}
+
+// DecodeLogs 按日志合约地址的abi解析日志，abi里没有的事件按签名库猜测，都没有匹配的日志不返回
+func DecodeLogs(logs []*types.Log) ([]*Event, error) {
+	events := make([]*Event, 0, len(logs))
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		abis, err := candidateAbis(log.Address.String())
+		if err != nil {
+			return nil, err
+		}
+		var event *Event
+		for _, contractAbi := range abis {
+			event = decodeLog(contractAbi, log)
+			if event != nil {
+				break
+			}
+		}
+		if event == nil {
+			event, err = guessEvent(log)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// decodeLog 按一个abi解析日志，topic0相同的事件(例如erc20和erc721的Transfer)通过indexed参数的数量区分
+func decodeLog(contractAbi *abi.ABI, log *types.Log) *Event {
+	event, err := contractAbi.EventByID(log.Topics[0])
+	if err != nil {
+		return nil
+	}
+	return decodeEvent(event, log)
+}
+
+func decodeEvent(event *abi.Event, log *types.Log) *Event {
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(indexed) != len(log.Topics)-1 {
+		return nil
+	}
+	nonIndexed, err := event.Inputs.NonIndexed().Unpack(log.Data)
+	if err != nil {
+		return nil
+	}
+	values := make([]interface{}, 0, len(event.Inputs))
+	topic := 1
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			values = append(values, nonIndexed[0])
+			nonIndexed = nonIndexed[1:]
+			continue
+		}
+		// 动态类型的indexed参数在topic里只有hash
+		out := map[string]interface{}{}
+		err = abi.ParseTopicsIntoMap(out, abi.Arguments{input}, log.Topics[topic:topic+1])
+		if err != nil {
+			return nil
+		}
+		values = append(values, out[input.Name])
+		topic++
+	}
+	return &Event{
+		LogIndex:  log.Index,
+		Address:   log.Address.String(),
+		Name:      event.RawName,
+		Signature: event.Sig,
+		Args:      buildArgs(event.Inputs, values),
+	}
+}
+
+func buildArgs(arguments abi.Arguments, values []interface{}) []*Arg {
+	args := make([]*Arg, 0, len(arguments))
+	for i, argument := range arguments {
+		args = append(args, &Arg{
+			Name:  argument.Name,
+			Type:  argument.Type.String(),
+			Value: formatValue(reflect.ValueOf(values[i])),
+		})
+	}
+	return args
+}
+
+var (
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	addressType = reflect.TypeOf(common.Address{})
+	hashType    = reflect.TypeOf(common.Hash{})
+)
+
+// formatValue 把abi解析出的go值转成适合json的值
+func formatValue(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	switch value.Type() {
+	case bigIntType:
+		if value.IsNil() {
+			return nil
+		}
+		return value.Interface().(*big.Int).String()
+	case addressType:
+		return value.Interface().(common.Address).String()
+	case hashType:
+		return value.Interface().(common.Hash).String()
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(value.Int()).String()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(value.Uint()).String()
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			return hexutil.Encode(data)
+		}
+		values := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, formatValue(value.Index(i)))
+		}
+		return values
+	case reflect.Struct:
+		// tuple解析成的匿名struct，json tag是abi里的参数名
+		fields := map[string]interface{}{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			fields[name] = formatValue(value.Field(i))
+		}
+		return fields
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return formatValue(value.Elem())
+	}
+	return value.Interface()
+}
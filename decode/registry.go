@@ -0,0 +1,135 @@
+package decode
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置的标准abi，没有上传abi的合约按这些解析
+//
+//go:embed abis/*.json
+var standardFiles embed.FS
+
+var standardAbis = func() []*abi.ABI {
+	entries, err := standardFiles.ReadDir("abis")
+	if err != nil {
+		panic(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	abis := make([]*abi.ABI, 0, len(names))
+	for _, name := range names {
+		data, err := standardFiles.ReadFile("abis/" + name)
+		if err != nil {
+			panic(err)
+		}
+		contractAbi, err := ParseAbi(string(data))
+		if err != nil {
+			panic(name + ": " + err.Error())
+		}
+		abis = append(abis, contractAbi)
+	}
+	return abis
+}()
+
+// 解析过的上传abi的缓存，没有上传abi的地址缓存nil，超过上限时整个清空
+const maxCachedAbis = 10000
+
+var (
+	cacheLock sync.Mutex
+	abiCache  = map[string]*abi.ABI{}
+)
+
+// ParseAbi 解析abi的json原文，上传时用来校验
+func ParseAbi(abiJson string) (*abi.ABI, error) {
+	if !json.Valid([]byte(abiJson)) {
+		return nil, errors.New("abi不是合法的json")
+	}
+	contractAbi, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		return nil, err
+	}
+	return &contractAbi, nil
+}
+
+// SaveAbi 保存合约的abi，覆盖之前上传的abi，contractAbi是ParseAbi解析abiJson的结果，直接放进缓存
+func SaveAbi(address string, abiJson string, contractAbi *abi.ABI) error {
+	if !common.IsHexAddress(address) {
+		return errors.New("地址格式错误:" + address)
+	}
+	err := store.Repo.SaveAbi(&store.ESAbi{
+		Address: address,
+		Abi:     abiJson,
+		Time:    uint64(time.Now().Unix()),
+	})
+	if err != nil {
+		return err
+	}
+	cacheLock.Lock()
+	if len(abiCache) >= maxCachedAbis {
+		abiCache = map[string]*abi.ABI{}
+	}
+	abiCache[strings.ToLower(address)] = contractAbi
+	cacheLock.Unlock()
+	return nil
+}
+
+// contractAbi 读取地址上传的abi，没有上传时返回nil
+func contractAbi(address string) (*abi.ABI, error) {
+	key := strings.ToLower(address)
+	cacheLock.Lock()
+	cached, ok := abiCache[key]
+	cacheLock.Unlock()
+	if ok {
+		return cached, nil
+	}
+	doc, err := store.Repo.GetAbi(address)
+	if err != nil {
+		return nil, err
+	}
+	var contractAbi *abi.ABI
+	if doc.Found {
+		var esAbi store.ESAbi
+		err = json.Unmarshal(doc.Source, &esAbi)
+		if err != nil {
+			return nil, err
+		}
+		contractAbi, err = ParseAbi(esAbi.Abi)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cacheLock.Lock()
+	if len(abiCache) >= maxCachedAbis {
+		abiCache = map[string]*abi.ABI{}
+	}
+	abiCache[key] = contractAbi
+	cacheLock.Unlock()
+	return contractAbi, nil
+}
+
+// candidateAbis 解析一个地址的调用和日志时依次尝试的abi，上传的abi优先
+func candidateAbis(address string) ([]*abi.ABI, error) {
+	if address == "" {
+		return standardAbis, nil
+	}
+	contractAbi, err := contractAbi(address)
+	if err != nil {
+		return nil, err
+	}
+	if contractAbi == nil {
+		return standardAbis, nil
+	}
+	return append([]*abi.ABI{contractAbi}, standardAbis...), nil
+}
@@ -0,0 +1,118 @@
+package decode
+
+import (
+	"bytes"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+)
+
+// solidity内置的Error(string)和Panic(uint256)
+var (
+	errorError = abi.NewError("Error", abi.Arguments{{Name: "message", Type: mustNewType("string")}})
+	panicError = abi.NewError("Panic", abi.Arguments{{Name: "code", Type: mustNewType("uint256")}})
+)
+
+// panicMessages solidity的panic code的含义
+var panicMessages = map[uint64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "conversion to invalid enum value",
+	0x22: "access to incorrectly encoded storage byte array",
+	0x31: "pop() on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to zero-initialized internal function",
+}
+
+func mustNewType(t string) abi.Type {
+	newType, err := abi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return newType
+}
+
+// DecodeRevert 解析失败交易的revert数据，to是交易调用的合约，自定义错误先按它的abi解析，再按签名库猜测
+//
+// message是节点返回的错误，没有revert数据时原样保存
+func DecodeRevert(to string, data []byte, message string) (*store.ESRevert, error) {
+	revert := &store.ESRevert{Data: hexutil.Encode(data)}
+	if len(data) == 0 {
+		revert.Kind = store.RevertKindEmpty
+		revert.Message = message
+		return revert, nil
+	}
+	if len(data) < 4 {
+		revert.Kind = store.RevertKindUnknown
+		return revert, nil
+	}
+	revert.Selector = hexutil.Encode(data[:4])
+	switch {
+	case bytes.Equal(data[:4], errorError.ID[:4]):
+		values, err := errorError.Inputs.Unpack(data[4:])
+		if err == nil {
+			revert.Kind = store.RevertKindError
+			revert.Message, _ = values[0].(string)
+			revert.Signature = errorError.Sig
+			revert.Args = buildArgs(errorError.Inputs, values)
+			return revert, nil
+		}
+	case bytes.Equal(data[:4], panicError.ID[:4]):
+		values, err := panicError.Inputs.Unpack(data[4:])
+		if err == nil {
+			revert.Kind = store.RevertKindPanic
+			revert.Message = panicMessage(values[0].(*big.Int))
+			revert.Signature = panicError.Sig
+			revert.Args = buildArgs(panicError.Inputs, values)
+			return revert, nil
+		}
+	}
+	abis, err := candidateAbis(to)
+	if err != nil {
+		return nil, err
+	}
+	for _, contractAbi := range abis {
+		for _, customError := range contractAbi.Errors {
+			if !bytes.Equal(customError.ID[:4], data[:4]) {
+				continue
+			}
+			values, err := customError.Inputs.Unpack(data[4:])
+			if err != nil {
+				continue
+			}
+			revert.Kind = store.RevertKindCustom
+			revert.Message = customError.Name
+			revert.Signature = customError.Sig
+			revert.Args = buildArgs(customError.Inputs, values)
+			return revert, nil
+		}
+	}
+	call, err := guessCall(data)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil {
+		revert.Kind = store.RevertKindCustom
+		revert.Message = call.Method
+		revert.Signature = call.Signature
+		revert.Args = call.Args
+		revert.Guessed = true
+		return revert, nil
+	}
+	revert.Kind = store.RevertKindUnknown
+	return revert, nil
+}
+
+// panicMessage panic code的含义，未知的code返回十六进制的code
+func panicMessage(code *big.Int) string {
+	if code.IsUint64() {
+		if message, ok := panicMessages[code.Uint64()]; ok {
+			return message
+		}
+	}
+	return "unknown panic code " + hexutil.EncodeBig(code)
+}
@@ -0,0 +1,140 @@
+package decode
+
+import (
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+// 测试用的合约，abi里有一个自定义错误
+const revertTestContract = "0x00000000000000000000000000000000000000aa"
+
+const revertTestAbi = `[{"type":"error","name":"InsufficientBalance","inputs":[
+	{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}]`
+
+// revertData 按错误的定义编码revert数据
+func revertData(t *testing.T, abiError abi.Error, args ...interface{}) []byte {
+	t.Helper()
+	data, err := abiError.Inputs.Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(append([]byte{}, abiError.ID[:4]...), data...)
+}
+
+func TestDecodeRevert(t *testing.T) {
+	store.Repo = store.NewMemoryRepository()
+	err := store.Repo.SaveAbi(&store.ESAbi{Address: revertTestContract, Abi: revertTestAbi})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := ParseSignatures("Unauthorized(address)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Repo.SaveSignatures(signatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contractAbi, err := ParseAbi(revertTestAbi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthorized := abi.NewError("Unauthorized", abi.Arguments{{Type: mustNewType("address")}})
+	caller := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	tests := []struct {
+		name      string
+		to        string
+		data      []byte
+		message   string
+		kind      string
+		want      string
+		signature string
+		args      []interface{}
+		guessed   bool
+	}{
+		{
+			name:    "empty",
+			data:    nil,
+			message: "out of gas",
+			kind:    store.RevertKindEmpty,
+			want:    "out of gas",
+		},
+		{
+			name: "shorter than selector",
+			data: []byte{0x08, 0xc3},
+			kind: store.RevertKindUnknown,
+		},
+		{
+			name:      "error string",
+			data:      revertData(t, errorError, "insufficient allowance"),
+			kind:      store.RevertKindError,
+			want:      "insufficient allowance",
+			signature: "Error(string)",
+			args:      []interface{}{"insufficient allowance"},
+		},
+		{
+			name:      "panic overflow",
+			data:      revertData(t, panicError, big.NewInt(0x11)),
+			kind:      store.RevertKindPanic,
+			want:      "arithmetic overflow or underflow",
+			signature: "Panic(uint256)",
+			args:      []interface{}{"17"},
+		},
+		{
+			name:      "panic unknown code",
+			data:      revertData(t, panicError, big.NewInt(0x99)),
+			kind:      store.RevertKindPanic,
+			want:      "unknown panic code 0x99",
+			signature: "Panic(uint256)",
+			args:      []interface{}{"153"},
+		},
+		{
+			name:      "contract abi",
+			to:        revertTestContract,
+			data:      revertData(t, contractAbi.Errors["InsufficientBalance"], big.NewInt(1), big.NewInt(2)),
+			kind:      store.RevertKindCustom,
+			want:      "InsufficientBalance",
+			signature: "InsufficientBalance(uint256,uint256)",
+			args:      []interface{}{"1", "2"},
+		},
+		{
+			name:      "guessed from signatures",
+			to:        revertTestContract,
+			data:      revertData(t, unauthorized, caller),
+			kind:      store.RevertKindCustom,
+			want:      "Unauthorized",
+			signature: "Unauthorized(address)",
+			args:      []interface{}{caller.String()},
+			guessed:   true,
+		},
+		{
+			name: "unknown selector",
+			data: []byte{0xde, 0xad, 0xbe, 0xef},
+			kind: store.RevertKindUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revert, err := DecodeRevert(tt.to, tt.data, tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revert.Kind != tt.kind || revert.Message != tt.want || revert.Signature != tt.signature || revert.Guessed != tt.guessed {
+				t.Fatalf("DecodeRevert() = %+v, want kind %s message %q signature %q guessed %v",
+					revert, tt.kind, tt.want, tt.signature, tt.guessed)
+			}
+			if len(revert.Args) != len(tt.args) {
+				t.Fatalf("got %d args, want %d", len(revert.Args), len(tt.args))
+			}
+			for i, arg := range revert.Args {
+				if arg.Value != tt.args[i] {
+					t.Errorf("arg %d = %v, want %v", i, arg.Value, tt.args[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package decode
+
+import (
+	_ "embed"
+	"errors"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置的常用方法和事件签名，每行一个，#开头的是注释
+//
+//go:embed signatures.txt
+var bundledSignatures string
+
+// 按selector或topic0查找的本地签名(内置的和SIGNATURE_FILE里的)，值是规范化的签名，先加载的在前
+var (
+	localLock       sync.RWMutex
+	localSignatures = map[string][]string{}
+)
+
+// 通过接口添加的签名的缓存，没有签名的id缓存空列表，超过上限时整个清空
+const maxCachedSignatures = 10000
+
+var (
+	storedLock       sync.Mutex
+	storedSignatures = map[string][]string{}
+)
+
+// 同一个id最多读取的签名数量
+const maxSignatureCandidates = 100
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+	// uint和int是uint256和int256的别名，计算selector时要用完整的类型
+	integerAliasPattern = regexp.MustCompile(`^(u?int)(\[|$)`)
+)
+
+func init() {
+	signatures, err := ParseSignatures(bundledSignatures)
+	if err != nil {
+		panic(err)
+	}
+	addLocalSignatures(signatures)
+}
+
+// InitSignatures 加载SIGNATURE_FILE指定的本地签名文件，格式和内置的签名一样，没有设置时只用内置的签名
+func InitSignatures() (int, error) {
+	path := os.Getenv("SIGNATURE_FILE")
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	signatures, err := ParseSignatures(string(data))
+	if err != nil {
+		return 0, errors.New(path + ": " + err.Error())
+	}
+	addLocalSignatures(signatures)
+	return len(signatures), nil
+}
+
+// SaveSignatures 保存通过接口添加的签名
+func SaveSignatures(signatures []*store.ESSignature) error {
+	now := uint64(time.Now().Unix())
+	for _, signature := range signatures {
+		signature.Time = now
+	}
+	err := store.Repo.SaveSignatures(signatures)
+	if err != nil {
+		return err
+	}
+	storedLock.Lock()
+	for _, signature := range signatures {
+		delete(storedSignatures, signature.Selector)
+		delete(storedSignatures, signature.Topic)
+	}
+	storedLock.Unlock()
+	return nil
+}
+
+// LookupSignatures selector或topic0对应的所有签名，本地的在前，通过接口添加的按签名排序
+func LookupSignatures(id string) ([]string, error) {
+	id = strings.ToLower(id)
+	localLock.RLock()
+	local := localSignatures[id]
+	localLock.RUnlock()
+	stored, err := lookupStoredSignatures(id)
+	if err != nil {
+		return nil, err
+	}
+	signatures := append([]string{}, local...)
+	for _, signature := range stored {
+		if !containsString(local, signature) {
+			signatures = append(signatures, signature)
+		}
+	}
+	return signatures, nil
+}
+
+func lookupStoredSignatures(id string) ([]string, error) {
+	storedLock.Lock()
+	cached, ok := storedSignatures[id]
+	storedLock.Unlock()
+	if ok {
+		return cached, nil
+	}
+	result, err := store.Repo.ListSignatures(id, store.Page{Size: maxSignatureCandidates})
+	if err != nil {
+		return nil, err
+	}
+	signatures := make([]string, 0, len(result.Hits))
+	for _, doc := range result.Hits {
+		signatures = append(signatures, doc.Id)
+	}
+	sort.Strings(signatures)
+	storedLock.Lock()
+	if len(storedSignatures) >= maxCachedSignatures {
+		storedSignatures = map[string][]string{}
+	}
+	storedSignatures[id] = signatures
+	storedLock.Unlock()
+	return signatures, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func addLocalSignatures(signatures []*store.ESSignature) {
+	localLock.Lock()
+	defer localLock.Unlock()
+	for _, signature := range signatures {
+		for _, id := range []string{signature.Selector, signature.Topic} {
+			if !containsString(localSignatures[id], signature.Signature) {
+				localSignatures[id] = append(localSignatures[id], signature.Signature)
+			}
+		}
+	}
+}
+
+// ParseSignatures 解析每行一个的签名，跳过空行和#开头的注释，返回规范化后的签名，重复的签名只返回一次
+func ParseSignatures(text string) ([]*store.ESSignature, error) {
+	var signatures []*store.ESSignature
+	seen := map[string]bool{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, arguments, err := parseSignature(line)
+		if err != nil {
+			return nil, errors.New("第" + strconv.Itoa(i+1) + "行: " + err.Error())
+		}
+		signature := newSignature(name, arguments)
+		if seen[signature.Signature] {
+			continue
+		}
+		seen[signature.Signature] = true
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
+
+// newSignature 规范化签名，计算4字节selector和topic0
+func newSignature(name string, arguments abi.Arguments) *store.ESSignature {
+	method := abi.NewMethod(name, name, abi.Function, "", false, false, arguments, nil)
+	hash := crypto.Keccak256([]byte(method.Sig))
+	return &store.ESSignature{
+		Signature: method.Sig,
+		Selector:  hexutil.Encode(hash[:4]),
+		Topic:     hexutil.Encode(hash),
+	}
+}
+
+// parseSignature 解析transfer(address,uint256)这样的签名，tuple写成(uint256,address)
+func parseSignature(text string) (string, abi.Arguments, error) {
+	text = strings.Join(strings.Fields(text), "")
+	open := strings.Index(text, "(")
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return "", nil, errors.New("签名格式错误:" + text)
+	}
+	name := text[:open]
+	if !identifierPattern.MatchString(name) {
+		return "", nil, errors.New("方法名格式错误:" + text)
+	}
+	types, err := splitTypes(text[open+1 : len(text)-1])
+	if err != nil {
+		return "", nil, errors.New(err.Error() + ":" + text)
+	}
+	arguments := make(abi.Arguments, 0, len(types))
+	for _, t := range types {
+		marshaling, err := typeMarshaling("", t)
+		if err != nil {
+			return "", nil, errors.New(err.Error() + ":" + text)
+		}
+		argumentType, err := abi.NewType(marshaling.Type, "", marshaling.Components)
+		if err != nil {
+			return "", nil, errors.New(err.Error() + ":" + text)
+		}
+		arguments = append(arguments, abi.Argument{Type: argumentType})
+	}
+	return name, arguments, nil
+}
+
+// splitTypes 按最外层的逗号拆分参数类型
+func splitTypes(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var types []string
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("括号不匹配")
+			}
+		case ',':
+			if depth == 0 {
+				types = append(types, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("括号不匹配")
+	}
+	types = append(types, list[start:])
+	for _, t := range types {
+		if t == "" {
+			return nil, errors.New("参数类型为空")
+		}
+	}
+	return types, nil
+}
+
+// typeMarshaling 把一个参数类型转成abi.NewType的参数，tuple的成员按顺序命名
+func typeMarshaling(name string, t string) (abi.ArgumentMarshaling, error) {
+	if !strings.HasPrefix(t, "(") {
+		return abi.ArgumentMarshaling{Name: name, Type: integerAliasPattern.ReplaceAllString(t, "${1}256${2}")}, nil
+	}
+	closing := strings.LastIndex(t, ")")
+	types, err := splitTypes(t[1:closing])
+	if err != nil {
+		return abi.ArgumentMarshaling{}, err
+	}
+	if len(types) == 0 {
+		return abi.ArgumentMarshaling{}, errors.New("tuple没有成员")
+	}
+	components := make([]abi.ArgumentMarshaling, 0, len(types))
+	for i, component := range types {
+		marshaling, err := typeMarshaling("arg"+strconv.Itoa(i), component)
+		if err != nil {
+			return abi.ArgumentMarshaling{}, err
+		}
+		components = append(components, marshaling)
+	}
+	return abi.ArgumentMarshaling{Name: name, Type: "tuple" + t[closing+1:], Components: components}, nil
+}
+
+// guessCall 按签名库猜测input调用的方法，依次尝试同一个selector的签名，返回第一个能解析参数的
+func guessCall(input []byte) (*Call, error) {
+	signatures, err := LookupSignatures(hexutil.Encode(input[:4]))
+	if err != nil {
+		return nil, err
+	}
+	for _, signature := range signatures {
+		name, arguments, err := parseSignature(signature)
+		if err != nil {
+			continue
+		}
+		method := abi.NewMethod(name, name, abi.Function, "", false, false, arguments, nil)
+		call := decodeCall(&method, input)
+		if call != nil {
+			call.Guessed = true
+			return call, nil
+		}
+	}
+	return nil, nil
+}
+
+// guessEvent 按签名库猜测日志的事件，签名里没有indexed的信息，按惯例假设前面的参数是indexed
+func guessEvent(log *types.Log) (*Event, error) {
+	signatures, err := LookupSignatures(log.Topics[0].Hex())
+	if err != nil {
+		return nil, err
+	}
+	for _, signature := range signatures {
+		name, arguments, err := parseSignature(signature)
+		if err != nil || len(arguments) < len(log.Topics)-1 {
+			continue
+		}
+		for i := range arguments {
+			arguments[i].Indexed = i < len(log.Topics)-1
+		}
+		event := abi.NewEvent(name, name, false, arguments)
+		decoded := decodeEvent(&event, log)
+		if decoded != nil {
+			decoded.Guessed = true
+			return decoded, nil
+		}
+	}
+	return nil, nil
+}
+
+// MethodName 按签名库猜测input调用的方法名，同步交易时使用，猜不到时返回空
+func MethodName(input []byte) (string, error) {
+	if len(input) < 4 {
+		return "", nil
+	}
+	call, err := guessCall(input)
+	if err != nil || call == nil {
+		return "", err
+	}
+	return call.Method, nil
+}
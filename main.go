@@ -2,17 +2,60 @@ package main
 
 import (
 	"explorer/db"
+	"explorer/decode"
 	"explorer/log"
+	"explorer/migrate"
 	"explorer/route"
+	"explorer/store"
 	"explorer/sync"
+	"go.uber.org/zap"
 	"os"
 )
 
 func main() {
-	db.InitEsClient()
+	store.InitStore()
 	db.InitEthClient()
 	log.InitLogger()
+	count, err := decode.InitSignatures()
+	if err != nil {
+		log.Logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if count > 0 {
+		log.Logger.Info("加载本地签名文件", zap.Int("signatures", count))
+	}
+	// ./main migrate ... 迁移索引后退出
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate.Run(os.Args[2:])
+		if err != nil {
+			log.Logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	// ./main balances 按已经写入的代币转账重建代币余额后退出，重建期间需要停止同步
+	if len(os.Args) > 1 && os.Args[1] == "balances" {
+		count, err := store.Repo.RebuildTokenBalances()
+		if err != nil {
+			log.Logger.Error(err.Error())
+			os.Exit(1)
+		}
+		log.Logger.Info("重建代币余额完成", zap.Int("balances", count))
+		return
+	}
+	// ./main fees ... 重新计算已同步交易的手续费后退出
+	if len(os.Args) > 1 && os.Args[1] == "fees" {
+		err = sync.RecomputeFees(os.Args[2:])
+		if err != nil {
+			log.Logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	ExplorerServerPort := os.Getenv("EXPLORER_SERVER_PORT")
+	if ExplorerServerPort == "" {
+		ExplorerServerPort = "8080"
+	}
 	router := route.InitRouter()
 	go sync.Sync()
 	router.Run("0.0.0.0:" + ExplorerServerPort)
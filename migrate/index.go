@@ -0,0 +1,581 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"explorer/db"
+	"explorer/log"
+	"explorer/sync"
+	"flag"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"go.uber.org/zap"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 追赶时往回多复制一段时间的数据，覆盖期间被更新的文档(例如finality)
+const catchUpMargin = 3600
+
+// 从链上重建时，剩余的块少于这个数就切换别名
+const catchUpBlocks = 100
+
+var versionPattern = regexp.MustCompile(`_v(\d+)$`)
+
+// Run 执行迁移命令
+//
+//	./main migrate -index block,tx          从旧索引复制到新版本索引后切换别名
+//	./main migrate -from-chain              从链上重建block、tx、address后切换别名
+//	./main migrate -index tx -delete-old    切换后删除旧索引，旧版本的同名索引必须加上这个参数
+func Run(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	indexFlag := flags.String("index", strings.Join([]string{db.BlockIndex, db.TxIndex, db.AddressIndex}, ","), "需要迁移的别名，逗号分隔")
+	fromChain := flags.Bool("from-chain", false, "从链上重新同步block、tx、address，而不是从es复制")
+	deleteOld := flags.Bool("delete-old", false, "切换别名后删除旧索引")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if db.EsClient == nil {
+		return errors.New("只有es存储后端需要迁移索引")
+	}
+	if *fromChain {
+		return migrateFromChain(*deleteOld)
+	}
+	var aliases []string
+	for _, alias := range strings.Split(*indexFlag, ",") {
+		aliases = append(aliases, strings.TrimSpace(alias))
+	}
+	err = checkLegacy(aliases, *deleteOld)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		err := migrateFromEs(alias, *deleteOld)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentIndex 获取别名指向的索引，旧版本直接使用同名索引时返回legacy为true
+func currentIndex(alias string) (string, bool, error) {
+	res, err := db.EsClient.Indices.GetAlias(db.EsClient.Indices.GetAlias.WithName(alias))
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		existsRes, err := db.EsClient.Indices.Exists([]string{alias})
+		if err != nil {
+			return "", false, err
+		}
+		defer existsRes.Body.Close()
+		if existsRes.StatusCode == 200 {
+			return alias, true, nil
+		}
+		return "", false, errors.New("索引不存在:" + alias)
+	}
+	if res.IsError() {
+		return "", false, errors.New("http:es读取别名出错:" + res.String())
+	}
+	var aliases map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&aliases)
+	if err != nil {
+		return "", false, err
+	}
+	if len(aliases) != 1 {
+		return "", false, errors.New("别名指向了多个索引:" + alias)
+	}
+	for index := range aliases {
+		return index, false, nil
+	}
+	return "", false, nil
+}
+
+// nextIndex 新版本索引的名字
+func nextIndex(alias string, current string) string {
+	version := 1
+	match := versionPattern.FindStringSubmatch(current)
+	if match != nil {
+		version, _ = strconv.Atoi(match[1])
+	}
+	return db.VersionedIndex(alias, version+1)
+}
+
+// createIndex 创建索引，mapping由索引模板提供
+func createIndex(index string) error {
+	res, err := db.EsClient.Indices.Create(index)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es创建索引出错:" + res.String())
+	}
+	return nil
+}
+
+// reindex 用es的_reindex把source复制到dest，query为nil时复制全部
+func reindex(source string, dest string, query map[string]interface{}, opType string) error {
+	sourceBody := map[string]interface{}{
+		"index": source,
+	}
+	if query != nil {
+		sourceBody["query"] = query
+	}
+	body := map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    sourceBody,
+		"dest": map[string]interface{}{
+			"index":   dest,
+			"op_type": opType,
+		},
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return err
+	}
+	waitForCompletion := false
+	req := esapi.ReindexRequest{
+		Body:              &buf,
+		WaitForCompletion: &waitForCompletion,
+	}
+	res, err := req.Do(context.Background(), db.EsClient)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es reindex出错:" + res.String())
+	}
+	var task struct {
+		Task string `json:"task"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&task)
+	if err != nil {
+		return err
+	}
+	return waitTask(task.Task, source, dest)
+}
+
+type esTaskRes struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status struct {
+			Total   int64 `json:"total"`
+			Created int64 `json:"created"`
+			Updated int64 `json:"updated"`
+		} `json:"status"`
+	} `json:"task"`
+	Error    map[string]interface{} `json:"error"`
+	Response struct {
+		Failures []interface{} `json:"failures"`
+	} `json:"response"`
+}
+
+// waitTask 等待reindex任务完成
+func waitTask(taskId string, source string, dest string) error {
+	for {
+		res, err := db.EsClient.Tasks.Get(taskId)
+		if err != nil {
+			return err
+		}
+		var task esTaskRes
+		err = json.NewDecoder(res.Body).Decode(&task)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if task.Error != nil {
+			return fmt.Errorf("reindex %s -> %s 出错: %v", source, dest, task.Error)
+		}
+		if task.Completed {
+			if len(task.Response.Failures) > 0 {
+				return fmt.Errorf("reindex %s -> %s 部分失败: %v", source, dest, task.Response.Failures[0])
+			}
+			return nil
+		}
+		log.Logger.Info("reindex进度",
+			zap.String("source", source),
+			zap.String("dest", dest),
+			zap.Int64("total", task.Task.Status.Total),
+			zap.Int64("done", task.Task.Status.Created+task.Task.Status.Updated),
+		)
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// maxTimestamp 索引里最大的timestamp，没有timestamp字段时返回false
+func maxTimestamp(index string) (int64, bool, error) {
+	body := `{"size": 0, "aggs": {"max": {"max": {"field": "timestamp"}}}}`
+	size := 0
+	req := esapi.SearchRequest{
+		Index: []string{index},
+		Size:  &size,
+		Body:  strings.NewReader(body),
+	}
+	res, err := req.Do(context.Background(), db.EsClient)
+	if err != nil {
+		return 0, false, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return 0, false, nil
+	}
+	var aggRes struct {
+		Aggregations struct {
+			Max struct {
+				Value *float64 `json:"value"`
+			} `json:"max"`
+		} `json:"aggregations"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&aggRes)
+	if err != nil {
+		return 0, false, err
+	}
+	if aggRes.Aggregations.Max.Value == nil {
+		return 0, false, nil
+	}
+	return int64(*aggRes.Aggregations.Max.Value), true, nil
+}
+
+// catchUp 复制开始迁移之后写入旧索引的文档，有timestamp的只复制最近的部分
+func catchUp(source string, dest string, opType string) error {
+	since, ok, err := maxTimestamp(dest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return reindex(source, dest, nil, opType)
+	}
+	query := map[string]interface{}{
+		"range": map[string]interface{}{
+			"timestamp": map[string]interface{}{
+				"gte": since - catchUpMargin,
+			},
+		},
+	}
+	return reindex(source, dest, query, opType)
+}
+
+// replayReorgs 迁移开始之后的区块重组只删除了旧索引里孤块的数据，已经复制到新索引的部分按块hash再删除一次
+func replayReorgs(index string, since int64) error {
+	res, err := db.EsClient.Indices.Refresh(db.EsClient.Indices.Refresh.WithIndex(db.ReorgIndex, index))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es refresh出错:" + res.String())
+	}
+	body := fmt.Sprintf(`{"_source": ["oldHashes"], "query": {"range": {"timestamp": {"gte": %d}}}}`, since)
+	size := 10000
+	req := esapi.SearchRequest{
+		Index: []string{db.ReorgIndex},
+		Size:  &size,
+		Body:  strings.NewReader(body),
+	}
+	res, err = req.Do(context.Background(), db.EsClient)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es读取重组记录出错:" + res.String())
+	}
+	var searchRes struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					OldHashes []string `json:"oldHashes"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&searchRes)
+	if err != nil {
+		return err
+	}
+	var hashes []string
+	for _, hit := range searchRes.Hits.Hits {
+		hashes = append(hashes, hit.Source.OldHashes...)
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"blockHash": hashes,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	refresh := true
+	deleteReq := esapi.DeleteByQueryRequest{
+		Index:     []string{index},
+		Body:      &buf,
+		Conflicts: "proceed",
+		Refresh:   &refresh,
+	}
+	deleteRes, err := deleteReq.Do(context.Background(), db.EsClient)
+	if err != nil {
+		return err
+	}
+	defer deleteRes.Body.Close()
+	if deleteRes.IsError() {
+		return errors.New("http:es删除孤块数据出错:" + deleteRes.String())
+	}
+	log.Logger.Info("重放区块重组", zap.String("index", index), zap.Int("blocks", len(hashes)))
+	return nil
+}
+
+// checkLegacy 别名不能和索引同名，旧版本的同名索引只能在切换别名时删除，必须加上-delete-old确认
+func checkLegacy(aliases []string, deleteOld bool) error {
+	for _, alias := range aliases {
+		_, legacy, err := currentIndex(alias)
+		if err != nil {
+			return err
+		}
+		if legacy && !deleteOld {
+			return errors.New("旧版本的同名索引在切换别名时会被删除，确认后加上 -delete-old 重新执行:" + alias)
+		}
+	}
+	return nil
+}
+
+// blockWrites 禁止或恢复索引的写入，旧版本的同名索引在最后一次追赶前禁止写入，追赶之后不会再有新数据
+func blockWrites(index string, block bool) error {
+	body := fmt.Sprintf(`{"index": {"blocks.write": %t}}`, block)
+	res, err := db.EsClient.Indices.PutSettings(strings.NewReader(body), db.EsClient.Indices.PutSettings.WithIndex(index))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es修改索引写入设置出错:" + res.String())
+	}
+	return nil
+}
+
+// swapAliases 原子地把别名切换到新索引，旧版本的同名索引会被删除，调用方需要确认-delete-old
+func swapAliases(swaps map[string][2]string) error {
+	var actions []interface{}
+	for alias, indices := range swaps {
+		current, index := indices[0], indices[1]
+		if current == alias {
+			actions = append(actions, map[string]interface{}{
+				"remove_index": map[string]interface{}{
+					"index": current,
+				},
+			})
+		} else {
+			actions = append(actions, map[string]interface{}{
+				"remove": map[string]interface{}{
+					"index": current,
+					"alias": alias,
+				},
+			})
+		}
+		actions = append(actions, map[string]interface{}{
+			"add": map[string]interface{}{
+				"index": index,
+				"alias": alias,
+			},
+		})
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(map[string]interface{}{
+		"actions": actions,
+	})
+	if err != nil {
+		return err
+	}
+	res, err := db.EsClient.Indices.UpdateAliases(&buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es切换别名出错:" + res.String())
+	}
+	return nil
+}
+
+func deleteIndex(index string) error {
+	res, err := db.EsClient.Indices.Delete([]string{index})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("http:es删除索引出错:" + res.String())
+	}
+	return nil
+}
+
+// migrateFromEs 新建下一版索引，复制并追赶数据后切换别名
+func migrateFromEs(alias string, deleteOld bool) error {
+	current, legacy, err := currentIndex(alias)
+	if err != nil {
+		return err
+	}
+	index := nextIndex(alias, current)
+	// 重组记录的时间是写入时间，往回多看一段，多删的只会是孤块的数据
+	since := time.Now().Unix() - catchUpMargin
+	log.Logger.Info("开始迁移", zap.String("alias", alias), zap.String("from", current), zap.String("to", index))
+	err = createIndex(index)
+	if err != nil {
+		return err
+	}
+	err = reindex(current, index, nil, "index")
+	if err != nil {
+		return err
+	}
+	// 复制期间同步还在写旧索引，切换前再追赶一次
+	err = catchUp(current, index, "index")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		// 同名索引切换时就被删除，没法在切换后追赶，先禁止写入再追赶最后一次
+		// 这期间同步写入失败的块进入死信，由校验任务补齐
+		err = blockWrites(current, true)
+		if err != nil {
+			return err
+		}
+		err = catchUp(current, index, "index")
+		if err == nil {
+			err = replayReorgs(index, since)
+		}
+		if err == nil {
+			err = swapAliases(map[string][2]string{alias: {current, index}})
+		}
+		if err != nil {
+			blockWrites(current, false)
+			return err
+		}
+	} else {
+		err = replayReorgs(index, since)
+		if err != nil {
+			return err
+		}
+		err = swapAliases(map[string][2]string{alias: {current, index}})
+		if err != nil {
+			return err
+		}
+		// 切换前最后写入旧索引的文档，不覆盖切换后写入新索引的
+		err = catchUp(current, index, "create")
+		if err != nil {
+			return err
+		}
+		// 切换后的重组只删除了新索引里的数据，追赶时可能又从旧索引复制回来
+		err = replayReorgs(index, since)
+		if err != nil {
+			return err
+		}
+		if deleteOld {
+			err = deleteIndex(current)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	log.Logger.Info("迁移完成", zap.String("alias", alias), zap.String("index", index))
+	return nil
+}
+
+// migrateFromChain 从链上把block、tx、address同步到新版本索引，追上同步进度后一起切换别名
+func migrateFromChain(deleteOld bool) error {
+	aliases := []string{db.BlockIndex, db.TxIndex, db.AddressIndex}
+	swaps := map[string][2]string{}
+	since := time.Now().Unix() - catchUpMargin
+	err := checkLegacy(aliases, deleteOld)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		current, _, err := currentIndex(alias)
+		if err != nil {
+			return err
+		}
+		index := nextIndex(alias, current)
+		err = createIndex(index)
+		if err != nil {
+			return err
+		}
+		swaps[alias] = [2]string{current, index}
+	}
+	// 这个进程里的写入都指向新索引
+	db.BlockIndex = swaps[db.BlockIndex][1]
+	db.TxIndex = swaps[db.TxIndex][1]
+	db.AddressIndex = swaps[db.AddressIndex][1]
+
+	from := uint64(0)
+	for {
+		to, ok, err := sync.GetCheckpointNumber()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("还没有同步进度，不需要从链上重建")
+		}
+		if from <= to {
+			err = sync.Reindex(from, to)
+			if err != nil {
+				return err
+			}
+		}
+		remaining := to + 1 - from
+		from = to + 1
+		if remaining < catchUpBlocks {
+			break
+		}
+	}
+	// 同步进程的重组只删除了旧索引里的孤块，这里已经同步过的要再删除一次
+	for _, indices := range swaps {
+		err = replayReorgs(indices[1], since)
+		if err != nil {
+			return err
+		}
+	}
+	err = swapAliases(swaps)
+	if err != nil {
+		return err
+	}
+	// 切换前同步进程写入的最后几个块
+	to, _, err := sync.GetCheckpointNumber()
+	if err != nil {
+		return err
+	}
+	if from <= to {
+		err = sync.Reindex(from, to)
+		if err != nil {
+			return err
+		}
+	}
+	for alias, indices := range swaps {
+		err = replayReorgs(indices[1], since)
+		if err != nil {
+			return err
+		}
+		if deleteOld && indices[0] != alias {
+			err = deleteIndex(indices[0])
+			if err != nil {
+				return err
+			}
+		}
+		log.Logger.Info("迁移完成", zap.String("alias", alias), zap.String("index", indices[1]))
+	}
+	return nil
+}
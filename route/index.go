@@ -1,8 +1,12 @@
 package route
 
 import (
+	"crypto/subtle"
 	"explorer/controller"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"strings"
 )
 
 func CORSMiddleware() gin.HandlerFunc {
@@ -20,9 +24,29 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware 会修改数据或者触发后台任务的接口需要在Authorization里带上 Bearer ADMIN_TOKEN
+// 没有配置ADMIN_TOKEN时这些接口不可用
+func AdminMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, "没有配置ADMIN_TOKEN，管理接口不可用")
+			return
+		}
+		authorization := c.GetHeader("Authorization")
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if token == authorization || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "管理接口的token不正确")
+			return
+		}
+		c.Next()
+	}
+}
+
 func InitRouter() *gin.Engine {
 	router := gin.Default()
 	router.Use(CORSMiddleware())
+	admin := AdminMiddleware(os.Getenv("ADMIN_TOKEN"))
 	router.GET("/block/:block", controller.GetBlock)
 	router.GET("/tx/:tx", controller.GetTx)
 	router.GET("/blocks", controller.GetBlocks)
@@ -34,5 +58,31 @@ func InitRouter() *gin.Engine {
 	router.GET("/address/:address", controller.GetTxByAddress)
 	router.POST("/refresh/:address", controller.RefreshAddress)
 	router.GET("/block/hash/:hash", controller.GetBlockByHash)
+	router.GET("/blobs/blocks", controller.GetBlobBlocks)
+	router.GET("/blobs/fees", controller.GetBlobFees)
+	router.GET("/internal/tx/:tx", controller.GetInternalTxsByTx)
+	router.GET("/internal/address/:address", controller.GetInternalTxsByAddress)
+	router.GET("/transfers/token/:token", controller.GetTokenTransfersByToken)
+	router.GET("/transfers/address/:address", controller.GetTokenTransfersByAddress)
+	router.GET("/transfers/tx/:tx", controller.GetTokenTransfersByTx)
+	router.GET("/balance/current/:address", controller.GetCurrentBalance)
+	router.GET("/balance/at/:address/:number", controller.GetBalanceAt)
+	router.GET("/balance/history/:address", controller.GetBalanceHistory)
+	router.GET("/balances/token/:token", controller.GetTokenHolders)
+	router.GET("/balances/address/:address", controller.GetTokenBalances)
+	router.GET("/nft/inventory/:address", controller.GetNftInventory)
+	router.GET("/nft/history/:token/:tokenId", controller.GetNftHistory)
+	router.GET("/nft/holders/:token", controller.GetNftHolders)
+	router.GET("/abi/:address", controller.GetAbi)
+	router.POST("/abi/:address", admin, controller.SaveAbi)
+	router.GET("/signatures/:id", controller.GetSignatures)
+	router.POST("/signatures", admin, controller.AddSignatures)
+	router.GET("/reorgs", controller.GetReorgs)
+	router.GET("/reorg/tx/:tx", controller.GetReorgByTx)
+	router.GET("/sync/stats", controller.GetSyncStats)
+	router.GET("/sync/status", controller.GetSyncStatus)
+	router.GET("/sync/verify", controller.GetVerify)
+	router.POST("/sync/verify", admin, controller.StartVerify)
+	router.GET("/sync/deadletters", controller.GetDeadLetters)
 	return router
 }
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"errors"
+	"explorer/log"
+	"math/big"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// mint和burn时转账的from或to是零地址，零地址不记录余额
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// balanceDelta 一批转账对一个余额的改变
+type balanceDelta struct {
+	Id       string
+	Standard string
+	Token    string
+	TokenId  string
+	Holder   string
+	Amount   *big.Int
+	// 转账里最大的高度，回滚时为空
+	Number string
+	// 每个转账的改变，es按转账的id保证每个转账只计算一次
+	Parts []*balancePart
+}
+
+// balancePart 一个转账对一个余额的改变
+type balancePart struct {
+	TransferId string
+	Amount     *big.Int
+}
+
+// balanceId 余额文档的id，地址都是小写
+func balanceId(token string, tokenId string, holder string) string {
+	return strings.ToLower(token) + "-" + tokenId + "-" + strings.ToLower(holder)
+}
+
+// tracksBalance 记录余额的代币标准，erc20的tokenId为空
+func tracksBalance(transfer *ESTokenTransfer) bool {
+	switch transfer.Standard {
+	case TokenStandardERC20, TokenStandardERC721, TokenStandardERC1155:
+		return true
+	}
+	return false
+}
+
+// isNft nft的余额按tokenId分别记录
+func isNft(standard string) bool {
+	return standard == TokenStandardERC721 || standard == TokenStandardERC1155
+}
+
+// compareAmount 比较两个十进制的数量，格式错误的当作0
+func compareAmount(a string, b string) int {
+	x, _ := new(big.Int).SetString(a, 10)
+	y, _ := new(big.Int).SetString(b, 10)
+	if x == nil {
+		x = new(big.Int)
+	}
+	if y == nil {
+		y = new(big.Int)
+	}
+	return x.Cmp(y)
+}
+
+// balanceSet 按余额合并转账的改变
+type balanceSet struct {
+	deltas  []*balanceDelta
+	indexes map[string]int
+	// 为false时不记录每个转账的改变，重建余额时不需要
+	parts bool
+}
+
+func newBalanceSet(parts bool) *balanceSet {
+	return &balanceSet{indexes: map[string]int{}, parts: parts}
+}
+
+// add 加上一个转账的改变，revert为true时加上回滚这个转账的改变
+func (s *balanceSet) add(transfer *ESTokenTransfer, revert bool) error {
+	if !tracksBalance(transfer) {
+		return nil
+	}
+	amount, ok := new(big.Int).SetString(transfer.Amount, 10)
+	if !ok {
+		return errors.New("转账数量格式错误:" + transfer.Id)
+	}
+	if revert {
+		amount.Neg(amount)
+	}
+	s.addHolder(transfer, transfer.From, new(big.Int).Neg(amount), revert)
+	s.addHolder(transfer, transfer.To, amount, revert)
+	return nil
+}
+
+func (s *balanceSet) addHolder(transfer *ESTokenTransfer, holder string, amount *big.Int, revert bool) {
+	if strings.EqualFold(holder, zeroAddress) || holder == "" {
+		return
+	}
+	id := balanceId(transfer.Token, transfer.TokenId, holder)
+	i, ok := s.indexes[id]
+	if !ok {
+		i = len(s.deltas)
+		s.indexes[id] = i
+		s.deltas = append(s.deltas, &balanceDelta{
+			Id:       id,
+			Standard: transfer.Standard,
+			Token:    transfer.Token,
+			TokenId:  transfer.TokenId,
+			Holder:   holder,
+			Amount:   new(big.Int),
+		})
+	}
+	delta := s.deltas[i]
+	delta.Amount.Add(delta.Amount, amount)
+	if !revert && (delta.Number == "" || compareNumber(transfer.Number, delta.Number) > 0) {
+		delta.Number = transfer.Number
+	}
+	if !s.parts {
+		return
+	}
+	// 同一个转账的from和to是连续加上的，转给自己时合并成一个
+	if n := len(delta.Parts); n > 0 && delta.Parts[n-1].TransferId == transfer.Id {
+		delta.Parts[n-1].Amount.Add(delta.Parts[n-1].Amount, amount)
+	} else {
+		delta.Parts = append(delta.Parts, &balancePart{TransferId: transfer.Id, Amount: new(big.Int).Set(amount)})
+	}
+}
+
+// changed 改变不为0的余额，转给自己的转账不改变余额
+func (s *balanceSet) changed() []*balanceDelta {
+	var changed []*balanceDelta
+	for _, delta := range s.deltas {
+		if delta.Amount.Sign() != 0 {
+			changed = append(changed, delta)
+		}
+	}
+	return changed
+}
+
+// balanceDeltas 按余额合并一批转账的改变，revert为true时计算回滚这些转账的改变
+func balanceDeltas(transfers []*ESTokenTransfer, revert bool) ([]*balanceDelta, error) {
+	set := newBalanceSet(true)
+	for _, transfer := range transfers {
+		err := set.add(transfer, revert)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set.changed(), nil
+}
+
+// rebuildBalances 按全部的转账重新累加余额，scan把所有转账依次交给add。
+// 为负数的余额说明缺少之前的转账，记录日志后仍然保存，之后补上的转账还要在它上面计算
+func rebuildBalances(scan func(add func(transfer *ESTokenTransfer) error) error) ([]*ESTokenBalance, error) {
+	set := newBalanceSet(false)
+	err := scan(func(transfer *ESTokenTransfer) error {
+		return set.add(transfer, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var balances []*ESTokenBalance
+	for _, delta := range set.changed() {
+		if delta.Amount.Sign() < 0 {
+			logNegativeBalance(delta.Id, delta.Amount.String())
+		}
+		balance := newBalance(delta)
+		balance.Amount, balance.Number = delta.Amount.String(), delta.Number
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// logNegativeBalance 余额为负数说明有转账没有计算进余额，例如开始记录余额之前已经写入的转账，
+// 查询时不返回这些余额，需要用 ./main balances 重建
+func logNegativeBalance(id string, amount string) {
+	log.Logger.Error("代币余额为负数，需要执行 ./main balances 重建余额", zap.String("id", id), zap.String("amount", amount))
+}
+
+// balanceTransfers 每个余额涉及的转账id，包括改变为0的
+func balanceTransfers(transfers []*ESTokenTransfer) map[string][]string {
+	ids := map[string][]string{}
+	for _, transfer := range transfers {
+		if !tracksBalance(transfer) {
+			continue
+		}
+		for _, holder := range [2]string{transfer.From, transfer.To} {
+			if strings.EqualFold(holder, zeroAddress) || holder == "" {
+				continue
+			}
+			id := balanceId(transfer.Token, transfer.TokenId, holder)
+			if n := len(ids[id]); n > 0 && ids[id][n-1] == transfer.Id {
+				continue
+			}
+			ids[id] = append(ids[id], transfer.Id)
+		}
+	}
+	return ids
+}
+
+// compareNumber 比较两个十进制的高度
+func compareNumber(a string, b string) int {
+	if len(a) != len(b) {
+		if len(a) > len(b) {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// apply 把改变加到余额上，返回改变后的余额是否为0
+func (b *ESTokenBalance) apply(delta *balanceDelta) (bool, error) {
+	amount := new(big.Int)
+	if b.Amount != "" {
+		_, ok := amount.SetString(b.Amount, 10)
+		if !ok {
+			return false, errors.New("余额格式错误:" + b.Id)
+		}
+	}
+	amount.Add(amount, delta.Amount)
+	b.Amount = amount.String()
+	if amount.Sign() < 0 {
+		logNegativeBalance(b.Id, b.Amount)
+	}
+	if delta.Number != "" {
+		b.Number = delta.Number
+	}
+	return amount.Sign() == 0, nil
+}
+
+// newBalance 余额不存在时按改变创建
+func newBalance(delta *balanceDelta) *ESTokenBalance {
+	return &ESTokenBalance{
+		Id:       delta.Id,
+		Standard: delta.Standard,
+		Token:    delta.Token,
+		TokenId:  delta.TokenId,
+		Holder:   delta.Holder,
+	}
+}
@@ -0,0 +1,221 @@
+package store
+
+import "testing"
+
+const (
+	testToken = "0x00000000000000000000000000000000000000AA"
+	testAlice = "0x00000000000000000000000000000000000000Bb"
+	testBob   = "0x00000000000000000000000000000000000000cc"
+)
+
+func testTransfer(id string, standard string, from string, to string, tokenId string, amount string, number string) *ESTokenTransfer {
+	return &ESTokenTransfer{Id: id, Standard: standard, Token: testToken, From: from, To: to, TokenId: tokenId, Amount: amount, Number: number}
+}
+
+func TestTracksBalance(t *testing.T) {
+	tests := []struct {
+		standard string
+		want     bool
+	}{
+		{TokenStandardERC20, true},
+		{TokenStandardERC721, true},
+		{TokenStandardERC1155, true},
+		{"", false},
+		{"erc777", false},
+	}
+	for _, tt := range tests {
+		if got := tracksBalance(&ESTokenTransfer{Standard: tt.standard}); got != tt.want {
+			t.Errorf("tracksBalance(%q) = %v, want %v", tt.standard, got, tt.want)
+		}
+	}
+}
+
+func TestBalanceDeltas(t *testing.T) {
+	aliceId := balanceId(testToken, "", testAlice)
+	bobId := balanceId(testToken, "", testBob)
+	tests := []struct {
+		name      string
+		transfers []*ESTokenTransfer
+		revert    bool
+		// 余额id对应的改变和高度
+		want    map[string][2]string
+		wantErr bool
+	}{
+		{
+			name: "mint then transfer",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t1", TokenStandardERC20, zeroAddress, testAlice, "", "100", "9"),
+				testTransfer("t2", TokenStandardERC20, testAlice, testBob, "", "30", "10"),
+			},
+			want: map[string][2]string{aliceId: {"70", "10"}, bobId: {"30", "10"}},
+		},
+		{
+			name: "revert",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t2", TokenStandardERC20, testAlice, testBob, "", "30", "10"),
+			},
+			revert: true,
+			want:   map[string][2]string{aliceId: {"30", ""}, bobId: {"-30", ""}},
+		},
+		{
+			name: "self transfer and round trip cancel out",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t1", TokenStandardERC20, testAlice, testAlice, "", "5", "10"),
+				testTransfer("t2", TokenStandardERC20, testAlice, testBob, "", "7", "10"),
+				testTransfer("t3", TokenStandardERC20, testBob, testAlice, "", "7", "11"),
+			},
+			want: map[string][2]string{},
+		},
+		{
+			name: "nft by token id",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t1", TokenStandardERC721, testAlice, testBob, "1", "1", "10"),
+				testTransfer("t2", TokenStandardERC1155, zeroAddress, testBob, "2", "4", "12"),
+			},
+			want: map[string][2]string{
+				balanceId(testToken, "1", testAlice): {"-1", "10"},
+				balanceId(testToken, "1", testBob):   {"1", "10"},
+				balanceId(testToken, "2", testBob):   {"4", "12"},
+			},
+		},
+		{
+			name: "untracked standard",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t1", "", testAlice, testBob, "", "1", "10"),
+			},
+			want: map[string][2]string{},
+		},
+		{
+			name: "malformed amount",
+			transfers: []*ESTokenTransfer{
+				testTransfer("t1", TokenStandardERC20, testAlice, testBob, "", "0x10", "10"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas, err := balanceDeltas(tt.transfers, tt.revert)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(deltas) != len(tt.want) {
+				t.Fatalf("got %d deltas, want %d", len(deltas), len(tt.want))
+			}
+			for _, delta := range deltas {
+				want, ok := tt.want[delta.Id]
+				if !ok {
+					t.Fatalf("unexpected delta %s", delta.Id)
+				}
+				if delta.Amount.String() != want[0] || delta.Number != want[1] {
+					t.Errorf("delta %s = %s at %q, want %s at %q", delta.Id, delta.Amount, delta.Number, want[0], want[1])
+				}
+			}
+		})
+	}
+}
+
+func TestBalanceDeltaParts(t *testing.T) {
+	deltas, err := balanceDeltas([]*ESTokenTransfer{
+		testTransfer("t1", TokenStandardERC20, testAlice, testBob, "", "3", "10"),
+		testTransfer("t2", TokenStandardERC20, testAlice, testAlice, "", "9", "10"),
+		testTransfer("t3", TokenStandardERC20, testAlice, testBob, "", "4", "11"),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delta := range deltas {
+		if delta.Id != balanceId(testToken, "", testAlice) {
+			continue
+		}
+		// 转给自己的转账合并成一个为0的改变
+		want := []string{"t1:-3", "t2:0", "t3:-4"}
+		if len(delta.Parts) != len(want) {
+			t.Fatalf("got %d parts, want %d", len(delta.Parts), len(want))
+		}
+		for i, part := range delta.Parts {
+			if got := part.TransferId + ":" + part.Amount.String(); got != want[i] {
+				t.Errorf("part %d = %s, want %s", i, got, want[i])
+			}
+		}
+		return
+	}
+	t.Fatal("missing delta for alice")
+}
+
+func TestBalanceTransfers(t *testing.T) {
+	ids := balanceTransfers([]*ESTokenTransfer{
+		testTransfer("t1", TokenStandardERC20, zeroAddress, testAlice, "", "1", "10"),
+		testTransfer("t2", TokenStandardERC20, testAlice, testAlice, "", "1", "10"),
+		testTransfer("t3", "", testAlice, testBob, "", "1", "10"),
+	})
+	if len(ids) != 1 {
+		t.Fatalf("got %d balances, want 1", len(ids))
+	}
+	got := ids[balanceId(testToken, "", testAlice)]
+	if len(got) != 2 || got[0] != "t1" || got[1] != "t2" {
+		t.Errorf("alice transfers = %v, want [t1 t2]", got)
+	}
+}
+
+func TestRebuildBalances(t *testing.T) {
+	transfers := []*ESTokenTransfer{
+		testTransfer("t1", TokenStandardERC20, zeroAddress, testAlice, "", "100", "9"),
+		testTransfer("t2", TokenStandardERC20, testAlice, testBob, "", "100", "10"),
+		// 缺少之前的转账，bob的余额是负数
+		testTransfer("t3", TokenStandardERC721, testBob, testAlice, "7", "1", "11"),
+	}
+	balances, err := rebuildBalances(func(add func(transfer *ESTokenTransfer) error) error {
+		for _, transfer := range transfers {
+			err := add(transfer)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		balanceId(testToken, "", testBob):    "100",
+		balanceId(testToken, "7", testBob):   "-1",
+		balanceId(testToken, "7", testAlice): "1",
+	}
+	if len(balances) != len(want) {
+		t.Fatalf("got %d balances, want %d", len(balances), len(want))
+	}
+	for _, balance := range balances {
+		if want[balance.Id] != balance.Amount {
+			t.Errorf("balance %s = %s, want %s", balance.Id, balance.Amount, want[balance.Id])
+		}
+	}
+}
+
+func TestAmountSortKey(t *testing.T) {
+	// 2^53+1和2^53转成double后相等，补齐后的字符串仍然有序
+	amounts := []string{"9007199254740993", "9007199254740992", "1000000000000000000000000", "5", "0"}
+	sorted := []string{"1000000000000000000000000", "9007199254740993", "9007199254740992", "5", "0"}
+	keys := map[string]string{}
+	for _, amount := range amounts {
+		key := amountSortKey(amount)
+		if len(key) != amountSortDigits {
+			t.Fatalf("amountSortKey(%s) = %s, want %d digits", amount, key, amountSortDigits)
+		}
+		keys[amount] = key
+	}
+	for i := 1; i < len(sorted); i++ {
+		if keys[sorted[i-1]] <= keys[sorted[i]] {
+			t.Errorf("amountSortKey(%s) <= amountSortKey(%s)", sorted[i-1], sorted[i])
+		}
+	}
+	if key := amountSortKey("-5"); key >= keys["0"] {
+		t.Errorf("amountSortKey(-5) = %s, want less than zero", key)
+	}
+}
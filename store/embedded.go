@@ -0,0 +1,1439 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"explorer/db"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 和es的track_total_hits一样，总数超过这个值时只返回下限
+const embeddedTotalLimit = 10000
+
+// embeddedRepository 用bbolt保存在本地文件里，不需要外部数据库，用于开发链和CI
+//
+// 主数据按id保存文档原文，列表查询通过db里定义的二级索引按key倒序遍历
+type embeddedRepository struct {
+	client *bolt.DB
+}
+
+func NewEmbeddedRepository(client *bolt.DB) Repository {
+	return &embeddedRepository{client: client}
+}
+
+// embeddedTxKey 维护二级索引需要的tx字段
+type embeddedTxKey struct {
+	Hash             string `json:"hash"`
+	Number           string `json:"number"`
+	Time             uint64 `json:"timestamp"`
+	TransactionIndex uint   `json:"transactionIndex"`
+	From             string `json:"from"`
+	To               string `json:"to"`
+	ContractAddress  string `json:"contractAddress"`
+	LogLength        uint64 `json:"logLength"`
+}
+
+func uint64Key(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+func uint32Key(n uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, n)
+	return key
+}
+
+func joinKey(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// sortKey tx按时间、高度、块内顺序排序的key，后面接上hash保证唯一
+func (k *embeddedTxKey) sortKey() ([]byte, error) {
+	number, err := strconv.ParseUint(k.Number, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(k.TransactionIndex))
+	return joinKey(uint64Key(k.Time), uint64Key(number), index, []byte(strings.ToLower(k.Hash))), nil
+}
+
+func (k *embeddedTxKey) blockKey() ([]byte, error) {
+	number, err := strconv.ParseUint(k.Number, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(k.TransactionIndex))
+	return joinKey(uint64Key(number), index), nil
+}
+
+// addressKeys 地址索引里的key，from和to相同时只有一个
+func addressKeys(from string, to string, sortKey []byte) [][]byte {
+	keys := [][]byte{joinKey([]byte(strings.ToLower(from)), sortKey)}
+	if to != "" && !strings.EqualFold(to, from) {
+		keys = append(keys, joinKey([]byte(strings.ToLower(to)), sortKey))
+	}
+	return keys
+}
+
+// prefixEnd 比所有以prefix开头的key都大的最小key，prefix全是0xff时返回nil
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// scanDesc 按key倒序遍历prefix下的记录，最多统计embeddedTotalLimit条，返回总数和当前页的value
+// match为nil时不过滤
+func scanDesc(bucket *bolt.Bucket, prefix []byte, page Page, match func(v []byte) (bool, error)) (int64, string, [][]byte, error) {
+	c := bucket.Cursor()
+	var k, v []byte
+	end := prefixEnd(prefix)
+	if end == nil {
+		k, v = c.Last()
+	} else if k, _ = c.Seek(end); k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	var total int64
+	var values [][]byte
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		if match != nil {
+			ok, err := match(v)
+			if err != nil {
+				return 0, "", nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if total >= int64(page.From) && total < int64(page.From+page.Size) {
+			values = append(values, append([]byte{}, v...))
+		}
+		total++
+		if total > embeddedTotalLimit && total >= int64(page.From+page.Size) {
+			return embeddedTotalLimit, "gte", values, nil
+		}
+	}
+	return total, "eq", values, nil
+}
+
+// indexDocs 根据二级索引里保存的主键读取文档
+func indexDocs(tx *bolt.Tx, bucket []byte, index string, ids [][]byte) []*Doc {
+	b := tx.Bucket(bucket)
+	docs := make([]*Doc, 0, len(ids))
+	for _, id := range ids {
+		source := b.Get(id)
+		if source == nil {
+			continue
+		}
+		docs = append(docs, &Doc{Index: index, Id: string(id), Found: true, Source: append([]byte{}, source...)})
+	}
+	return docs
+}
+
+// listTxs 按索引倒序分页查询tx
+func (r *embeddedRepository) listTxs(index []byte, prefix []byte, page Page, match func(tx *bolt.Tx, hash []byte) (bool, error)) (*SearchResult, error) {
+	result := new(SearchResult)
+	err := r.client.View(func(tx *bolt.Tx) error {
+		var filter func(v []byte) (bool, error)
+		if match != nil {
+			filter = func(v []byte) (bool, error) {
+				return match(tx, v)
+			}
+		}
+		total, relation, hashes, err := scanDesc(tx.Bucket(index), prefix, page, filter)
+		if err != nil {
+			return err
+		}
+		result.Total, result.Relation, result.Hits = total, relation, indexDocs(tx, db.TxBucket, db.TxIndex, hashes)
+		return nil
+	})
+	return result, err
+}
+
+// getDoc 按key读取文档
+func (r *embeddedRepository) getDoc(bucket []byte, index string, id string, key []byte) (*Doc, error) {
+	doc := &Doc{Index: index, Id: id}
+	err := r.client.View(func(tx *bolt.Tx) error {
+		source := tx.Bucket(bucket).Get(key)
+		if source != nil {
+			doc.Found = true
+			doc.Source = append([]byte{}, source...)
+		}
+		return nil
+	})
+	return doc, err
+}
+
+// setField 修改文档里的一个字段
+func setField(source []byte, field string, value interface{}) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	err := json.Unmarshal(source, &doc)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	doc[field] = raw
+	return json.Marshal(doc)
+}
+
+func (r *embeddedRepository) GetBlock(number string) (*Doc, error) {
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return &Doc{Index: db.BlockIndex, Id: number}, nil
+	}
+	return r.getDoc(db.BlockBucket, db.BlockIndex, number, uint64Key(n))
+}
+
+func (r *embeddedRepository) FindBlock(number uint64) (*ESBlock, error) {
+	doc, err := r.getDoc(db.BlockBucket, db.BlockIndex, "", uint64Key(number))
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	block := new(ESBlock)
+	err = json.Unmarshal(doc.Source, block)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// blockFinality 只解析block的finality
+func blockFinality(source []byte) (string, error) {
+	var block struct {
+		Finality string `json:"finality"`
+	}
+	err := json.Unmarshal(source, &block)
+	return block.Finality, err
+}
+
+// blockBlobs 只解析block的blob数量和excessBlobGas
+func blockBlobs(source []byte) (int, string, error) {
+	var block struct {
+		BlobCount     int    `json:"blobCount"`
+		ExcessBlobGas string `json:"excessBlobGas"`
+	}
+	err := json.Unmarshal(source, &block)
+	return block.BlobCount, block.ExcessBlobGas, err
+}
+
+func (r *embeddedRepository) ListBlocks(page Page, finality string) (*SearchResult, error) {
+	var match func(v []byte) (bool, error)
+	if finality != "" {
+		match = func(v []byte) (bool, error) {
+			blockFinality, err := blockFinality(v)
+			return blockFinality == finality, err
+		}
+	}
+	return r.listBlocks(page, match)
+}
+
+func (r *embeddedRepository) ListBlobBlocks(page Page, withBlobs bool) (*SearchResult, error) {
+	return r.listBlocks(page, func(v []byte) (bool, error) {
+		blobCount, excessBlobGas, err := blockBlobs(v)
+		if withBlobs {
+			return blobCount > 0, err
+		}
+		return excessBlobGas != "", err
+	})
+}
+
+// listBlocks 按高度倒序遍历所有的块，match为nil时不过滤
+func (r *embeddedRepository) listBlocks(page Page, match func(v []byte) (bool, error)) (*SearchResult, error) {
+	result := new(SearchResult)
+	err := r.client.View(func(tx *bolt.Tx) error {
+		total, relation, sources, err := scanDesc(tx.Bucket(db.BlockBucket), nil, page, match)
+		if err != nil {
+			return err
+		}
+		result.Total, result.Relation = total, relation
+		for _, source := range sources {
+			var block ESBlock
+			err = json.Unmarshal(source, &block)
+			if err != nil {
+				return err
+			}
+			result.Hits = append(result.Hits, &Doc{Index: db.BlockIndex, Id: block.Number, Found: true, Source: source})
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) ListBlocksByHash(hash string) (*SearchResult, error) {
+	result := &SearchResult{Relation: "eq"}
+	err := r.client.View(func(tx *bolt.Tx) error {
+		number := tx.Bucket(db.BlockHashIndex).Get([]byte(strings.ToLower(hash)))
+		if number == nil {
+			return nil
+		}
+		source := tx.Bucket(db.BlockBucket).Get(number)
+		if source == nil {
+			return nil
+		}
+		result.Total = 1
+		result.Hits = []*Doc{{
+			Index:  db.BlockIndex,
+			Id:     strconv.FormatUint(binary.BigEndian.Uint64(number), 10),
+			Found:  true,
+			Source: append([]byte{}, source...),
+		}}
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) LastBlockNumber() (uint64, bool, error) {
+	return r.LastFinalityNumber("")
+}
+
+// LastFinalityNumber finality为空时返回最后一个块
+func (r *embeddedRepository) LastFinalityNumber(finality string) (uint64, bool, error) {
+	var number uint64
+	ok := false
+	err := r.client.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(db.BlockBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if finality != "" {
+				blockFinality, err := blockFinality(v)
+				if err != nil {
+					return err
+				}
+				if blockFinality != finality {
+					continue
+				}
+			}
+			number, ok = binary.BigEndian.Uint64(k), true
+			return nil
+		}
+		return nil
+	})
+	return number, ok, err
+}
+
+func (r *embeddedRepository) BlockTxCounts(start uint64, end uint64) (map[uint64]int, map[uint64]int, error) {
+	txns := map[uint64]int{}
+	txCount := map[uint64]int{}
+	err := r.client.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(db.BlockBucket).Cursor()
+		for k, v := c.Seek(uint64Key(start)); k != nil && binary.BigEndian.Uint64(k) <= end; k, v = c.Next() {
+			var block ESBlock
+			err := json.Unmarshal(v, &block)
+			if err != nil {
+				return err
+			}
+			txns[binary.BigEndian.Uint64(k)] = block.Txns
+		}
+		txc := tx.Bucket(db.TxBlockIndex).Cursor()
+		for k, _ := txc.Seek(uint64Key(start)); k != nil && binary.BigEndian.Uint64(k[:8]) <= end; k, _ = txc.Next() {
+			txCount[binary.BigEndian.Uint64(k[:8])]++
+		}
+		return nil
+	})
+	return txns, txCount, err
+}
+
+func (r *embeddedRepository) GetTx(hash string) (*Doc, error) {
+	return r.getDoc(db.TxBucket, db.TxIndex, hash, []byte(strings.ToLower(hash)))
+}
+
+// txFinality 只解析tx的finality
+func txFinality(tx *bolt.Tx, hash []byte) (string, error) {
+	return blockFinality(tx.Bucket(db.TxBucket).Get(hash))
+}
+
+func (r *embeddedRepository) ListTxs(page Page, block string, finality string) (*SearchResult, error) {
+	var match func(tx *bolt.Tx, hash []byte) (bool, error)
+	if finality != "" {
+		match = func(tx *bolt.Tx, hash []byte) (bool, error) {
+			txFinality, err := txFinality(tx, hash)
+			return txFinality == finality, err
+		}
+	}
+	if block == "" {
+		return r.listTxs(db.TxTimeIndex, nil, page, match)
+	}
+	number, err := strconv.ParseUint(block, 10, 64)
+	if err != nil {
+		return &SearchResult{Relation: "eq"}, nil
+	}
+	// 同一个块的tx时间相同，按块内顺序倒序
+	return r.listTxs(db.TxBlockIndex, uint64Key(number), page, match)
+}
+
+func (r *embeddedRepository) ListTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.listTxs(db.TxAddressIndex, []byte(strings.ToLower(address)), page, nil)
+}
+
+func (r *embeddedRepository) ListContractCreations(page Page) (*SearchResult, error) {
+	return r.listTxs(db.ContractCreationIndex, nil, page, nil)
+}
+
+func (r *embeddedRepository) ListContractTxs(page Page) (*SearchResult, error) {
+	return r.listTxs(db.ContractTxIndex, nil, page, nil)
+}
+
+// internalTxKeys 内部调用在各个二级索引里的key
+func internalTxKeys(internalTx *ESInternalTx) (map[string][][]byte, error) {
+	number, err := strconv.ParseUint(internalTx.Number, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	blockKey := joinKey(uint64Key(number), uint32Key(uint32(internalTx.TransactionIndex)), uint32Key(uint32(internalTx.Index)))
+	sortKey := joinKey(uint64Key(internalTx.Time), blockKey)
+	// 调用顺序取反，倒序遍历时就是调用顺序
+	order := uint32Key(math.MaxUint32 - uint32(internalTx.Index))
+	return map[string][][]byte{
+		string(db.InternalTxTxIndex):      {joinKey([]byte(strings.ToLower(internalTx.TxHash)), order)},
+		string(db.InternalTxAddressIndex): addressKeys(internalTx.From, internalTx.To, sortKey),
+		string(db.InternalTxBlockIndex):   {blockKey},
+	}, nil
+}
+
+// tokenTransferKeys 代币转账在各个二级索引里的key，日志序号和TransferBatch里的序号在块内唯一
+func tokenTransferKeys(transfer *ESTokenTransfer) (map[string][][]byte, error) {
+	number, err := strconv.ParseUint(transfer.Number, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	blockKey := joinKey(uint64Key(number), uint32Key(uint32(transfer.LogIndex)), uint32Key(uint32(transfer.BatchIndex)))
+	// 序号取反，倒序遍历时就是日志顺序
+	order := joinKey(uint32Key(math.MaxUint32-uint32(transfer.LogIndex)), uint32Key(math.MaxUint32-uint32(transfer.BatchIndex)))
+	token := []byte(strings.ToLower(transfer.Token))
+	entries := map[string][][]byte{
+		string(db.TokenTransferTxIndex):      {joinKey([]byte(strings.ToLower(transfer.TxHash)), order)},
+		string(db.TokenTransferTokenIndex):   {joinKey(token, blockKey)},
+		string(db.TokenTransferAddressIndex): addressKeys(transfer.From, transfer.To, blockKey),
+		string(db.TokenTransferBlockIndex):   {blockKey},
+	}
+	if transfer.TokenId != "" {
+		entries[string(db.TokenTransferTokenIdIndex)] = [][]byte{joinKey(tokenIdPrefix(transfer.Token, transfer.TokenId), blockKey)}
+	}
+	return entries, nil
+}
+
+// tokenIdPrefix tokenId长度不固定，后面加0作为分隔，避免1匹配到12
+func tokenIdPrefix(token string, tokenId string) []byte {
+	return joinKey([]byte(strings.ToLower(token)), []byte(tokenId), []byte{0})
+}
+
+// tokenBalanceKeys 余额在二级索引里的key，持有人的索引按最后变化的高度排序
+func tokenBalanceKeys(balance *ESTokenBalance) (map[string][][]byte, error) {
+	var number uint64
+	if balance.Number != "" {
+		var err error
+		number, err = strconv.ParseUint(balance.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	amount, ok := new(big.Int).SetString(balance.Amount, 10)
+	if !ok {
+		return nil, errors.New("余额格式错误:" + balance.Id)
+	}
+	id := []byte(balance.Id)
+	token := []byte(strings.ToLower(balance.Token))
+	holder := []byte(strings.ToLower(balance.Holder))
+	return map[string][][]byte{
+		string(db.TokenBalanceHolderIndex): {joinKey(holder, uint64Key(number), id)},
+		string(db.TokenBalanceTokenIndex):  {joinKey(token, holder, id)},
+		string(db.TokenBalanceAmountIndex): {joinKey(token, amountKey(amount), id)},
+	}, nil
+}
+
+// balanceKeys 余额记录在二级索引里的key
+func balanceKeys(balance *ESBalance) (map[string][][]byte, error) {
+	number, err := strconv.ParseUint(balance.Number, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	address := []byte(strings.ToLower(balance.Address))
+	return map[string][][]byte{
+		string(db.BalanceAddressIndex): {joinKey(address, uint64Key(number))},
+		string(db.BalanceBlockIndex):   {joinKey(uint64Key(number), address)},
+	}, nil
+}
+
+// amountKey 按数值排序的key，先是符号，再是字节长度和大端字节
+// 从中间开始同步时余额可能是负数，负数的长度和字节取反，绝对值越大越小
+func amountKey(amount *big.Int) []byte {
+	buf := amount.Bytes()
+	if amount.Sign() >= 0 {
+		return joinKey([]byte{1, byte(len(buf))}, buf)
+	}
+	key := []byte{0, 0xff - byte(len(buf))}
+	for _, b := range buf {
+		key = append(key, 0xff-b)
+	}
+	return key
+}
+
+// listDocs 按二级索引倒序分页查询bucket里的文档
+func (r *embeddedRepository) listDocs(bucket []byte, index string, indexBucket []byte, prefix []byte, page Page) (*SearchResult, error) {
+	result := new(SearchResult)
+	err := r.client.View(func(tx *bolt.Tx) error {
+		total, relation, ids, err := scanDesc(tx.Bucket(indexBucket), prefix, page, nil)
+		if err != nil {
+			return err
+		}
+		result.Total, result.Relation, result.Hits = total, relation, indexDocs(tx, bucket, index, ids)
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) ListInternalTxsByTx(hash string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.InternalTxBucket, db.InternalTxIndex, db.InternalTxTxIndex, []byte(strings.ToLower(hash)), page)
+}
+
+func (r *embeddedRepository) ListInternalTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.InternalTxBucket, db.InternalTxIndex, db.InternalTxAddressIndex, []byte(strings.ToLower(address)), page)
+}
+
+func (r *embeddedRepository) ListTokenTransfersByToken(token string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.TokenTransferBucket, db.TokenTransferIndex, db.TokenTransferTokenIndex, []byte(strings.ToLower(token)), page)
+}
+
+func (r *embeddedRepository) ListTokenTransfersByAddress(address string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.TokenTransferBucket, db.TokenTransferIndex, db.TokenTransferAddressIndex, []byte(strings.ToLower(address)), page)
+}
+
+func (r *embeddedRepository) ListTokenTransfersByTx(hash string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.TokenTransferBucket, db.TokenTransferIndex, db.TokenTransferTxIndex, []byte(strings.ToLower(hash)), page)
+}
+
+func (r *embeddedRepository) ListTokenTransfersByTokenId(token string, tokenId string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.TokenTransferBucket, db.TokenTransferIndex, db.TokenTransferTokenIdIndex, tokenIdPrefix(token, tokenId), page)
+}
+
+// listTokenBalances 按余额的二级索引倒序分页，数量不是正数的余额不返回
+func (r *embeddedRepository) listTokenBalances(indexBucket []byte, prefix []byte, page Page, match func(balance *ESTokenBalance) bool) (*SearchResult, error) {
+	result := new(SearchResult)
+	err := r.client.View(func(tx *bolt.Tx) error {
+		balances := tx.Bucket(db.TokenBalanceBucket)
+		filter := func(id []byte) (bool, error) {
+			var balance ESTokenBalance
+			err := json.Unmarshal(balances.Get(id), &balance)
+			if err != nil {
+				return false, err
+			}
+			return compareAmount(balance.Amount, "0") > 0 && (match == nil || match(&balance)), nil
+		}
+		total, relation, ids, err := scanDesc(tx.Bucket(indexBucket), prefix, page, filter)
+		if err != nil {
+			return err
+		}
+		result.Total, result.Relation, result.Hits = total, relation, indexDocs(tx, db.TokenBalanceBucket, db.TokenBalanceIndex, ids)
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) ListNftInventory(address string, page Page) (*SearchResult, error) {
+	return r.listTokenBalances(db.TokenBalanceHolderIndex, []byte(strings.ToLower(address)), page, func(balance *ESTokenBalance) bool {
+		return isNft(balance.Standard)
+	})
+}
+
+func (r *embeddedRepository) ListTokenHolders(token string, page Page) (*SearchResult, error) {
+	return r.listTokenBalances(db.TokenBalanceAmountIndex, []byte(strings.ToLower(token)), page, nil)
+}
+
+func (r *embeddedRepository) ListTokenBalances(address string, page Page) (*SearchResult, error) {
+	return r.listTokenBalances(db.TokenBalanceHolderIndex, []byte(strings.ToLower(address)), page, nil)
+}
+
+// ListNftHolders 代币索引按持有人排列，连续的key属于同一个持有人，统计后按数量排序
+func (r *embeddedRepository) ListNftHolders(token string, page Page) (*SearchResult, error) {
+	var holders []*ESNftHolder
+	err := r.client.View(func(tx *bolt.Tx) error {
+		balances := tx.Bucket(db.TokenBalanceBucket)
+		prefix := []byte(strings.ToLower(token))
+		var last []byte
+		c := tx.Bucket(db.TokenBalanceTokenIndex).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			// 地址是固定的42个字符
+			if len(k) < len(prefix)+42 {
+				continue
+			}
+			var balance ESTokenBalance
+			err := json.Unmarshal(balances.Get(v), &balance)
+			if err != nil {
+				return err
+			}
+			if compareAmount(balance.Amount, "0") <= 0 {
+				continue
+			}
+			holder := k[len(prefix) : len(prefix)+42]
+			if bytes.Equal(holder, last) {
+				holders[len(holders)-1].Tokens++
+				continue
+			}
+			last = append(last[:0], holder...)
+			holders = append(holders, &ESNftHolder{Token: balance.Token, Holder: balance.Holder, Tokens: 1})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(holders, func(i, j int) bool {
+		return holders[i].Tokens > holders[j].Tokens
+	})
+	ids := make([]string, 0, len(holders))
+	sources := make([]interface{}, 0, len(holders))
+	for _, holder := range holders {
+		ids = append(ids, holder.Holder)
+		sources = append(sources, holder)
+	}
+	return pageResult(db.TokenBalanceIndex, ids, sources, &page)
+}
+
+// FindBalance 在地址索引里找到不大于number的最后一个key
+func (r *embeddedRepository) FindBalance(address string, number uint64) (*Doc, error) {
+	doc := &Doc{Index: db.BalanceIndex, Id: address}
+	err := r.client.View(func(tx *bolt.Tx) error {
+		prefix := []byte(strings.ToLower(address))
+		target := joinKey(prefix, uint64Key(number))
+		c := tx.Bucket(db.BalanceAddressIndex).Cursor()
+		k, v := c.Seek(target)
+		if k == nil {
+			k, v = c.Last()
+		} else if !bytes.Equal(k, target) {
+			k, v = c.Prev()
+		}
+		if k == nil || !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		source := tx.Bucket(db.BalanceBucket).Get(v)
+		if source == nil {
+			return nil
+		}
+		doc.Id, doc.Found, doc.Source = string(v), true, append([]byte{}, source...)
+		return nil
+	})
+	return doc, err
+}
+
+func (r *embeddedRepository) ListBalances(address string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.BalanceBucket, db.BalanceIndex, db.BalanceAddressIndex, []byte(strings.ToLower(address)), page)
+}
+
+func (r *embeddedRepository) GetAbi(address string) (*Doc, error) {
+	address = strings.ToLower(address)
+	return r.getDoc(db.AbiBucket, db.AbiIndex, address, []byte(address))
+}
+
+func (r *embeddedRepository) SaveAbi(contractAbi *ESAbi) error {
+	source, err := json.Marshal(contractAbi)
+	if err != nil {
+		return err
+	}
+	return r.client.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.AbiBucket).Put([]byte(strings.ToLower(contractAbi.Address)), source)
+	})
+}
+
+// signatureIdKey 签名索引里的key，selector和topic0的前缀相同，用0隔开
+func signatureIdKey(id string, signature string) []byte {
+	return joinKey([]byte(strings.ToLower(id)), []byte{0}, []byte(signature))
+}
+
+func (r *embeddedRepository) ListSignatures(id string, page Page) (*SearchResult, error) {
+	return r.listDocs(db.SignatureBucket, db.SignatureIndex, db.SignatureIdIndex, joinKey([]byte(strings.ToLower(id)), []byte{0}), page)
+}
+
+func (r *embeddedRepository) SaveSignatures(signatures []*ESSignature) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		bucket, index := tx.Bucket(db.SignatureBucket), tx.Bucket(db.SignatureIdIndex)
+		for _, signature := range signatures {
+			source, err := json.Marshal(signature)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put([]byte(signature.Signature), source)
+			if err != nil {
+				return err
+			}
+			for _, id := range []string{signature.Selector, signature.Topic} {
+				err = index.Put(signatureIdKey(id, signature.Signature), []byte(signature.Signature))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *embeddedRepository) GetAddress(address string) (*Doc, error) {
+	return r.getDoc(db.AddressBucket, db.AddressIndex, address, []byte(address))
+}
+
+func (r *embeddedRepository) ListAddresses(addresses []string) (*SearchResult, error) {
+	result := &SearchResult{Relation: "eq"}
+	err := r.client.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(db.AddressBucket)
+		for _, address := range addresses {
+			source := bucket.Get([]byte(address))
+			if source != nil {
+				result.Hits = append(result.Hits, &Doc{Index: db.AddressIndex, Id: address, Found: true, Source: append([]byte{}, source...)})
+			}
+		}
+		result.Total = int64(len(result.Hits))
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) UpdateAddressType(address string, _type uint8) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(db.AddressBucket)
+		source := bucket.Get([]byte(address))
+		if source == nil {
+			return &Error{Msg: "address不存在:" + address, Status: 404}
+		}
+		updated, err := setField(source, "type", _type)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(address), updated)
+	})
+}
+
+// putTx 写入tx和它的二级索引，已经存在时覆盖
+func putTx(tx *bolt.Tx, esTx *ESTx) error {
+	hash := []byte(strings.ToLower(esTx.Hash))
+	txs := tx.Bucket(db.TxBucket)
+	// 按链上的数据覆盖，先删除旧文档的二级索引
+	if old := txs.Get(hash); old != nil {
+		var key embeddedTxKey
+		err := json.Unmarshal(old, &key)
+		if err != nil {
+			return err
+		}
+		err = txIndexes(tx, &key, true)
+		if err != nil {
+			return err
+		}
+	}
+	source, err := json.Marshal(esTx)
+	if err != nil {
+		return err
+	}
+	err = txs.Put(hash, source)
+	if err != nil {
+		return err
+	}
+	return txIndexes(tx, &embeddedTxKey{
+		Hash:             esTx.Hash,
+		Number:           esTx.Number,
+		Time:             esTx.Time,
+		TransactionIndex: esTx.TransactionIndex,
+		From:             esTx.From,
+		To:               esTx.To,
+		ContractAddress:  esTx.ContractAddress,
+		LogLength:        esTx.LogLength,
+	}, false)
+}
+
+// txIndexes 写入或删除tx的二级索引
+func txIndexes(tx *bolt.Tx, key *embeddedTxKey, remove bool) error {
+	hash := []byte(strings.ToLower(key.Hash))
+	sortKey, err := key.sortKey()
+	if err != nil {
+		return err
+	}
+	blockKey, err := key.blockKey()
+	if err != nil {
+		return err
+	}
+	entries := map[string][][]byte{
+		string(db.TxTimeIndex):    {sortKey},
+		string(db.TxAddressIndex): addressKeys(key.From, key.To, sortKey),
+		string(db.TxBlockIndex):   {blockKey},
+	}
+	if key.ContractAddress != "" {
+		entries[string(db.ContractCreationIndex)] = [][]byte{sortKey}
+	}
+	if key.LogLength > 0 {
+		entries[string(db.ContractTxIndex)] = [][]byte{sortKey}
+	}
+	for bucket, keys := range entries {
+		b := tx.Bucket([]byte(bucket))
+		for _, k := range keys {
+			if remove {
+				err = b.Delete(k)
+			} else {
+				err = b.Put(k, hash)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putDoc 写入文档和它的二级索引，已经存在时不覆盖
+func putDoc(tx *bolt.Tx, bucket []byte, id string, doc interface{}, entries map[string][][]byte) error {
+	b := tx.Bucket(bucket)
+	if b.Get([]byte(id)) != nil {
+		return nil
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	err = b.Put([]byte(id), source)
+	if err != nil {
+		return err
+	}
+	for index, keys := range entries {
+		ib := tx.Bucket([]byte(index))
+		for _, key := range keys {
+			err = ib.Put(key, []byte(id))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteDoc 删除文档和它的二级索引
+func deleteDoc(tx *bolt.Tx, bucket []byte, id []byte, entries map[string][][]byte) error {
+	for index, keys := range entries {
+		ib := tx.Bucket([]byte(index))
+		for _, key := range keys {
+			err := ib.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Bucket(bucket).Delete(id)
+}
+
+// blockDocs 通过高度索引找到一个高度的所有文档，返回主键和文档原文
+func blockDocs(tx *bolt.Tx, blockIndex []byte, bucket []byte, number uint64) ([][]byte, [][]byte) {
+	prefix := uint64Key(number)
+	var ids [][]byte
+	var sources [][]byte
+	b := tx.Bucket(bucket)
+	c := tx.Bucket(blockIndex).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		ids = append(ids, append([]byte{}, v...))
+		sources = append(sources, append([]byte{}, b.Get(v)...))
+	}
+	return ids, sources
+}
+
+func putInternalTx(tx *bolt.Tx, internalTx *ESInternalTx) error {
+	// 按链上的数据覆盖，先删除旧文档和它的二级索引
+	if old := tx.Bucket(db.InternalTxBucket).Get([]byte(internalTx.Id)); old != nil {
+		var oldInternalTx ESInternalTx
+		err := json.Unmarshal(old, &oldInternalTx)
+		if err != nil {
+			return err
+		}
+		oldEntries, err := internalTxKeys(&oldInternalTx)
+		if err != nil {
+			return err
+		}
+		err = deleteDoc(tx, db.InternalTxBucket, []byte(internalTx.Id), oldEntries)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := internalTxKeys(internalTx)
+	if err != nil {
+		return err
+	}
+	return putDoc(tx, db.InternalTxBucket, internalTx.Id, internalTx, entries)
+}
+
+// removeInternalTxs 删除一个高度的内部调用和内部创建的合约地址
+func removeInternalTxs(tx *bolt.Tx, number uint64) error {
+	ids, sources := blockDocs(tx, db.InternalTxBlockIndex, db.InternalTxBucket, number)
+	for i, id := range ids {
+		var internalTx ESInternalTx
+		err := json.Unmarshal(sources[i], &internalTx)
+		if err != nil {
+			return err
+		}
+		entries, err := internalTxKeys(&internalTx)
+		if err != nil {
+			return err
+		}
+		err = deleteDoc(tx, db.InternalTxBucket, id, entries)
+		if err != nil {
+			return err
+		}
+		if internalTx.IsCreate() {
+			err = tx.Bucket(db.AddressBucket).Delete([]byte(internalTx.To))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putTokenTransfer 写入代币转账，返回是否是新写入的
+func putTokenTransfer(tx *bolt.Tx, transfer *ESTokenTransfer) (bool, error) {
+	if tx.Bucket(db.TokenTransferBucket).Get([]byte(transfer.Id)) != nil {
+		return false, nil
+	}
+	entries, err := tokenTransferKeys(transfer)
+	if err != nil {
+		return false, err
+	}
+	return true, putDoc(tx, db.TokenTransferBucket, transfer.Id, transfer, entries)
+}
+
+// removeTokenTransfers 删除一个高度的代币转账，并回滚它们对余额的改变
+func removeTokenTransfers(tx *bolt.Tx, number uint64) error {
+	ids, sources := blockDocs(tx, db.TokenTransferBlockIndex, db.TokenTransferBucket, number)
+	transfers := make([]*ESTokenTransfer, 0, len(ids))
+	for i, id := range ids {
+		transfer := new(ESTokenTransfer)
+		err := json.Unmarshal(sources[i], transfer)
+		if err != nil {
+			return err
+		}
+		entries, err := tokenTransferKeys(transfer)
+		if err != nil {
+			return err
+		}
+		err = deleteDoc(tx, db.TokenTransferBucket, id, entries)
+		if err != nil {
+			return err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return applyTokenBalances(tx, transfers, true)
+}
+
+// applyTokenBalances 把转账的改变加到余额上，余额变化后高度也会变，先删除旧的索引再写入
+func applyTokenBalances(tx *bolt.Tx, transfers []*ESTokenTransfer, revert bool) error {
+	deltas, err := balanceDeltas(transfers, revert)
+	if err != nil {
+		return err
+	}
+	bucket := tx.Bucket(db.TokenBalanceBucket)
+	for _, delta := range deltas {
+		balance := newBalance(delta)
+		if source := bucket.Get([]byte(delta.Id)); source != nil {
+			err = json.Unmarshal(source, balance)
+			if err != nil {
+				return err
+			}
+			entries, err := tokenBalanceKeys(balance)
+			if err != nil {
+				return err
+			}
+			err = deleteDoc(tx, db.TokenBalanceBucket, []byte(delta.Id), entries)
+			if err != nil {
+				return err
+			}
+		}
+		isZero, err := balance.apply(delta)
+		if err != nil {
+			return err
+		}
+		if isZero {
+			continue
+		}
+		entries, err := tokenBalanceKeys(balance)
+		if err != nil {
+			return err
+		}
+		err = putDoc(tx, db.TokenBalanceBucket, balance.Id, balance, entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putBalance 写入余额记录，已经存在时覆盖，同一个id的索引key不变
+func putBalance(tx *bolt.Tx, balance *ESBalance) error {
+	entries, err := balanceKeys(balance)
+	if err != nil {
+		return err
+	}
+	source, err := json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(db.BalanceBucket).Put([]byte(balance.Id), source)
+	if err != nil {
+		return err
+	}
+	for index, keys := range entries {
+		for _, key := range keys {
+			err = tx.Bucket([]byte(index)).Put(key, []byte(balance.Id))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeBalances 删除一个高度的余额记录
+func removeBalances(tx *bolt.Tx, number uint64) error {
+	ids, sources := blockDocs(tx, db.BalanceBlockIndex, db.BalanceBucket, number)
+	for i, id := range ids {
+		var balance ESBalance
+		err := json.Unmarshal(sources[i], &balance)
+		if err != nil {
+			return err
+		}
+		entries, err := balanceKeys(&balance)
+		if err != nil {
+			return err
+		}
+		err = deleteDoc(tx, db.BalanceBucket, id, entries)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putAddress 地址不存在时写入
+func putAddress(tx *bolt.Tx, esAddress *ESAddress) error {
+	bucket := tx.Bucket(db.AddressBucket)
+	if bucket.Get([]byte(esAddress.Address)) != nil {
+		return nil
+	}
+	source, err := json.Marshal(esAddress)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(esAddress.Address), source)
+}
+
+// UpsertBlockBatch 一批块在一个事务里写入，tx和address已存在时不覆盖，block覆盖
+func (r *embeddedRepository) UpsertBlockBatch(batch *BlockBatch) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		for _, esTx := range batch.Txs {
+			err := putTx(tx, esTx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, internalTx := range batch.InternalTxs {
+			err := putInternalTx(tx, internalTx)
+			if err != nil {
+				return err
+			}
+		}
+		// 已经写入的转账不重复计算余额
+		var newTransfers []*ESTokenTransfer
+		for _, transfer := range batch.TokenTransfers {
+			isNew, err := putTokenTransfer(tx, transfer)
+			if err != nil {
+				return err
+			}
+			if isNew {
+				newTransfers = append(newTransfers, transfer)
+			}
+		}
+		err := applyTokenBalances(tx, newTransfers, false)
+		if err != nil {
+			return err
+		}
+		for _, balance := range batch.Balances {
+			err := putBalance(tx, balance)
+			if err != nil {
+				return err
+			}
+		}
+		for _, contract := range batch.Contracts {
+			err := putAddress(tx, batch.address(contract, AddressTypeContract))
+			if err != nil {
+				return err
+			}
+		}
+		for _, address := range batch.Addresses {
+			err := putAddress(tx, batch.address(address, AddressTypeAccount))
+			if err != nil {
+				return err
+			}
+		}
+		blocks := tx.Bucket(db.BlockBucket)
+		hashes := tx.Bucket(db.BlockHashIndex)
+		for _, esBlock := range batch.Blocks {
+			number, err := strconv.ParseUint(esBlock.Number, 10, 64)
+			if err != nil {
+				return err
+			}
+			key := uint64Key(number)
+			if old := blocks.Get(key); old != nil {
+				var oldBlock ESBlock
+				err = json.Unmarshal(old, &oldBlock)
+				if err != nil {
+					return err
+				}
+				err = hashes.Delete([]byte(strings.ToLower(oldBlock.BlockHash)))
+				if err != nil {
+					return err
+				}
+			}
+			source, err := json.Marshal(esBlock)
+			if err != nil {
+				return err
+			}
+			err = blocks.Put(key, source)
+			if err != nil {
+				return err
+			}
+			err = hashes.Put([]byte(strings.ToLower(esBlock.BlockHash)), key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveBlocks 按高度删除孤块，同一高度只保存了一个块，块里的交易通过高度索引找到
+func (r *embeddedRepository) RemoveBlocks(blocks []*ESBlock) ([]string, error) {
+	txHashes := []string{}
+	err := r.client.Update(func(tx *bolt.Tx) error {
+		txs := tx.Bucket(db.TxBucket)
+		for _, block := range blocks {
+			number, err := strconv.ParseUint(block.Number, 10, 64)
+			if err != nil {
+				return err
+			}
+			prefix := uint64Key(number)
+			var hashes [][]byte
+			c := tx.Bucket(db.TxBlockIndex).Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				hashes = append(hashes, append([]byte{}, v...))
+			}
+			for _, hash := range hashes {
+				var key embeddedTxKey
+				err = json.Unmarshal(txs.Get(hash), &key)
+				if err != nil {
+					return err
+				}
+				err = txIndexes(tx, &key, true)
+				if err != nil {
+					return err
+				}
+				err = txs.Delete(hash)
+				if err != nil {
+					return err
+				}
+				if key.ContractAddress != "" {
+					err = tx.Bucket(db.AddressBucket).Delete([]byte(key.ContractAddress))
+					if err != nil {
+						return err
+					}
+				}
+				txHashes = append(txHashes, string(hash))
+			}
+			err = removeInternalTxs(tx, number)
+			if err != nil {
+				return err
+			}
+			err = removeTokenTransfers(tx, number)
+			if err != nil {
+				return err
+			}
+			err = removeBalances(tx, number)
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(db.BlockHashIndex).Delete([]byte(strings.ToLower(block.BlockHash)))
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(db.BlockBucket).Delete(prefix)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+// RebuildTokenBalances 清空余额和它的索引后按全部转账重新写入，在一个事务里完成
+func (r *embeddedRepository) RebuildTokenBalances() (int, error) {
+	count := 0
+	err := r.client.Update(func(tx *bolt.Tx) error {
+		balances, err := rebuildBalances(func(add func(transfer *ESTokenTransfer) error) error {
+			return tx.Bucket(db.TokenTransferBucket).ForEach(func(_, source []byte) error {
+				transfer := new(ESTokenTransfer)
+				err := json.Unmarshal(source, transfer)
+				if err != nil {
+					return err
+				}
+				return add(transfer)
+			})
+		})
+		if err != nil {
+			return err
+		}
+		for _, bucket := range [][]byte{db.TokenBalanceBucket, db.TokenBalanceHolderIndex, db.TokenBalanceTokenIndex, db.TokenBalanceAmountIndex} {
+			err = tx.DeleteBucket(bucket)
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		for _, balance := range balances {
+			entries, err := tokenBalanceKeys(balance)
+			if err != nil {
+				return err
+			}
+			err = putDoc(tx, db.TokenBalanceBucket, balance.Id, balance, entries)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(balances)
+		return nil
+	})
+	return count, err
+}
+
+func (r *embeddedRepository) UpdateTxFees(fees []*ESTxFee) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		txs := tx.Bucket(db.TxBucket)
+		for _, fee := range fees {
+			key := []byte(strings.ToLower(fee.Hash))
+			source := txs.Get(key)
+			if source == nil {
+				continue
+			}
+			esTx := new(ESTx)
+			err := json.Unmarshal(source, esTx)
+			if err != nil {
+				return err
+			}
+			esTx.SetFee(fee)
+			updated, err := json.Marshal(esTx)
+			if err != nil {
+				return err
+			}
+			err = txs.Put(key, updated)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *embeddedRepository) SetFinality(start uint64, end uint64, finality string) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket(db.BlockBucket)
+		var keys [][]byte
+		c := blocks.Cursor()
+		for k, _ := c.Seek(uint64Key(start)); k != nil && binary.BigEndian.Uint64(k) <= end; k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		for _, key := range keys {
+			updated, err := setField(blocks.Get(key), "finality", finality)
+			if err != nil {
+				return err
+			}
+			err = blocks.Put(key, updated)
+			if err != nil {
+				return err
+			}
+		}
+		txs := tx.Bucket(db.TxBucket)
+		var hashes [][]byte
+		txc := tx.Bucket(db.TxBlockIndex).Cursor()
+		for k, v := txc.Seek(uint64Key(start)); k != nil && binary.BigEndian.Uint64(k[:8]) <= end; k, v = txc.Next() {
+			hashes = append(hashes, append([]byte{}, v...))
+		}
+		for _, hash := range hashes {
+			updated, err := setField(txs.Get(hash), "finality", finality)
+			if err != nil {
+				return err
+			}
+			err = txs.Put(hash, updated)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *embeddedRepository) SaveReorg(reorg *ESReorg) error {
+	source, err := json.Marshal(reorg)
+	if err != nil {
+		return err
+	}
+	return r.client.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(db.ReorgBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := uint64Key(id)
+		err = bucket.Put(key, source)
+		if err != nil {
+			return err
+		}
+		index := tx.Bucket(db.ReorgTxIndex)
+		for _, hash := range reorg.TxHashes {
+			err = index.Put(joinKey([]byte(strings.ToLower(hash)), key), key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// listReorgs 按写入顺序倒序读取重组记录，byTx为true时遍历的是交易索引，value是记录的key
+func (r *embeddedRepository) listReorgs(index []byte, prefix []byte, page Page, byTx bool) (*SearchResult, error) {
+	result := new(SearchResult)
+	err := r.client.View(func(tx *bolt.Tx) error {
+		total, relation, values, err := scanDesc(tx.Bucket(index), prefix, page, nil)
+		if err != nil {
+			return err
+		}
+		result.Total, result.Relation = total, relation
+		bucket := tx.Bucket(db.ReorgBucket)
+		for _, source := range values {
+			if byTx {
+				source = append([]byte{}, bucket.Get(source)...)
+			}
+			result.Hits = append(result.Hits, &Doc{Index: db.ReorgIndex, Found: true, Source: source})
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (r *embeddedRepository) ListReorgs(page Page) (*SearchResult, error) {
+	return r.listReorgs(db.ReorgBucket, nil, page, false)
+}
+
+func (r *embeddedRepository) ListReorgsByTx(hash string) (*SearchResult, error) {
+	return r.listReorgs(db.ReorgTxIndex, []byte(strings.ToLower(hash)), Page{Size: 10}, true)
+}
+
+func (r *embeddedRepository) GetCheckpoint() (*ESCheckpoint, error) {
+	doc, err := r.getDoc(db.SyncBucket, "sync", checkpointId, []byte(checkpointId))
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	checkpoint := new(ESCheckpoint)
+	err = json.Unmarshal(doc.Source, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (r *embeddedRepository) SaveCheckpoint(checkpoint *ESCheckpoint) error {
+	source, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return r.client.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.SyncBucket).Put([]byte(checkpointId), source)
+	})
+}
+
+func (r *embeddedRepository) DeleteCheckpoint() error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.SyncBucket).Delete([]byte(checkpointId))
+	})
+}
+
+func (r *embeddedRepository) SaveDeadLetter(deadLetter *ESDeadLetter) error {
+	number, err := strconv.ParseUint(deadLetter.Number, 10, 64)
+	if err != nil {
+		return err
+	}
+	source, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	return r.client.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.DeadLetterBucket).Put(uint64Key(number), source)
+	})
+}
+
+func (r *embeddedRepository) DeleteDeadLetters(numbers []uint64) error {
+	return r.client.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(db.DeadLetterBucket)
+		for _, number := range numbers {
+			err := bucket.Delete(uint64Key(number))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListDeadLetters 死信不多，全部读出来按时间排序
+func (r *embeddedRepository) ListDeadLetters(page Page) (*SearchResult, error) {
+	var deadLetters []*ESDeadLetter
+	err := r.client.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.DeadLetterBucket).ForEach(func(k, v []byte) error {
+			deadLetter := new(ESDeadLetter)
+			err := json.Unmarshal(v, deadLetter)
+			if err != nil {
+				return err
+			}
+			deadLetters = append(deadLetters, deadLetter)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].Time > deadLetters[j].Time
+	})
+	ids := make([]string, 0, len(deadLetters))
+	sources := make([]interface{}, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		ids = append(ids, deadLetter.Number)
+		sources = append(sources, deadLetter)
+	}
+	return pageResult(db.DeadLetterIndex, ids, sources, &page)
+}
@@ -0,0 +1,892 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"explorer/db"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// esRepository 用elasticsearch存储，索引名使用db里的别名
+type esRepository struct {
+	client *elasticsearch.Client
+}
+
+func NewEsRepository(client *elasticsearch.Client) Repository {
+	return &esRepository{client: client}
+}
+
+type esGetRes struct {
+	Index  string          `json:"_index"`
+	Id     string          `json:"_id"`
+	Found  bool            `json:"found"`
+	Source json.RawMessage `json:"_source"`
+}
+
+type esSearchRes struct {
+	Hits struct {
+		Total struct {
+			Value    int64  `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Hits []esGetRes `json:"hits"`
+	} `json:"hits"`
+}
+
+type esTxCountRes struct {
+	Aggregations struct {
+		Txns struct {
+			Buckets []struct {
+				Key      uint64 `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"txns"`
+	} `json:"aggregations"`
+}
+
+type esNftHolderRes struct {
+	Aggregations struct {
+		Holders struct {
+			Buckets []struct {
+				DocCount int64 `json:"doc_count"`
+				Holder   struct {
+					Hits struct {
+						Hits []esGetRes `json:"hits"`
+					} `json:"hits"`
+				} `json:"holder"`
+			} `json:"buckets"`
+		} `json:"holders"`
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+	} `json:"aggregations"`
+}
+
+// esError es返回的http错误，429和5xx可以重试
+func esError(msg string, res *esapi.Response) error {
+	return &Error{
+		Msg:       msg,
+		Status:    res.StatusCode,
+		Transient: res.StatusCode == 429 || res.StatusCode >= 500,
+	}
+}
+
+// blockSortField 块按高度倒序排列时的排序字段，旧版本的block索引里number不能排序，用timestamp
+func blockSortField() string {
+	if db.LegacyBlockIndex {
+		return "timestamp"
+	}
+	return "number"
+}
+
+func sortBy(field string) [1]interface{} {
+	return [1]interface{}{
+		map[string]interface{}{
+			field: map[string]interface{}{
+				"order": "desc",
+			},
+		},
+	}
+}
+
+func termQuery(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			field: map[string]interface{}{
+				"value": value,
+			},
+		},
+	}
+}
+
+func numberStrings(start uint64, end uint64) []string {
+	numbers := make([]string, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		numbers = append(numbers, strconv.FormatUint(i, 10))
+	}
+	return numbers
+}
+
+// get 按id读取文档，不存在时Found为false
+func (r *esRepository) get(index string, id string) (*Doc, error) {
+	req := esapi.GetRequest{
+		Index:      index,
+		DocumentID: id,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return &Doc{Index: index, Id: id}, nil
+	}
+	if res.IsError() {
+		return nil, esError("http:es读取"+index+"出错", res)
+	}
+	var getRes esGetRes
+	err = json.NewDecoder(res.Body).Decode(&getRes)
+	if err != nil {
+		return nil, err
+	}
+	return &Doc{Index: getRes.Index, Id: getRes.Id, Found: getRes.Found, Source: getRes.Source}, nil
+}
+
+// search 查询文档，page为nil时使用es默认的分页
+func (r *esRepository) search(index string, body map[string]interface{}, page *Page) (*SearchResult, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{index},
+		Body:  &buf,
+	}
+	if page != nil {
+		req.Size = &page.Size
+		req.From = &page.From
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, esError("http:es查询"+index+"出错", res)
+	}
+	var searchRes esSearchRes
+	err = json.NewDecoder(res.Body).Decode(&searchRes)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{
+		Total:    searchRes.Hits.Total.Value,
+		Relation: searchRes.Hits.Total.Relation,
+		Hits:     make([]*Doc, 0, len(searchRes.Hits.Hits)),
+	}
+	for _, hit := range searchRes.Hits.Hits {
+		result.Hits = append(result.Hits, &Doc{Index: hit.Index, Id: hit.Id, Found: true, Source: hit.Source})
+	}
+	return result, nil
+}
+
+// mget 按id实时读取文档，刚写入还没有refresh的文档也能读到，source为nil时只返回是否存在
+func (r *esRepository) mget(index string, ids []string, source []string) ([]*Doc, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		source = []string{"false"}
+	}
+	req := esapi.MgetRequest{
+		Index:  index,
+		Body:   bytes.NewReader(body),
+		Source: source,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, esError("http:es读取"+index+"出错", res)
+	}
+	var mgetRes struct {
+		Docs []esGetRes `json:"docs"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&mgetRes)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*Doc, 0, len(mgetRes.Docs))
+	for _, doc := range mgetRes.Docs {
+		docs = append(docs, &Doc{Index: doc.Index, Id: doc.Id, Found: doc.Found, Source: doc.Source})
+	}
+	return docs, nil
+}
+
+// refresh 让刚写入的文档可以被查询到，回滚前调用，避免漏掉还没有refresh的文档
+func (r *esRepository) refresh(indices ...string) error {
+	req := esapi.IndicesRefreshRequest{
+		Index: indices,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError("http:es refresh出错", res)
+	}
+	return nil
+}
+
+// scan 用search_after按唯一的keyword字段field分页读取符合条件的全部文档，不受max_result_window的限制
+func (r *esRepository) scan(index string, body map[string]interface{}, field string, fn func(doc *Doc) error) error {
+	body["size"] = 1000
+	body["sort"] = [1]interface{}{
+		map[string]interface{}{
+			field: map[string]interface{}{
+				"order": "asc",
+			},
+		},
+	}
+	for {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			return err
+		}
+		req := esapi.SearchRequest{
+			Index: []string{index},
+			Body:  &buf,
+		}
+		res, err := req.Do(context.Background(), r.client)
+		if err != nil {
+			return err
+		}
+		var scanRes struct {
+			Hits struct {
+				Hits []struct {
+					esGetRes
+					Sort []interface{} `json:"sort"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if res.IsError() {
+			err = esError("http:es查询"+index+"出错", res)
+		} else {
+			err = json.NewDecoder(res.Body).Decode(&scanRes)
+		}
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		hits := scanRes.Hits.Hits
+		for _, hit := range hits {
+			err = fn(&Doc{Index: hit.Index, Id: hit.Id, Found: true, Source: hit.Source})
+			if err != nil {
+				return err
+			}
+		}
+		if len(hits) < 1000 {
+			return nil
+		}
+		body["search_after"] = hits[len(hits)-1].Sort
+	}
+}
+
+// lastBlock 按field倒序的第一个块
+func (r *esRepository) lastBlock(field string, query map[string]interface{}) (uint64, bool, error) {
+	body := map[string]interface{}{
+		"sort": sortBy(field),
+	}
+	if query != nil {
+		body["query"] = query
+	}
+	result, err := r.search(db.BlockIndex, body, &Page{Size: 1})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result.Hits) == 0 {
+		return 0, false, nil
+	}
+	var block ESBlock
+	err = json.Unmarshal(result.Hits[0].Source, &block)
+	if err != nil {
+		return 0, false, err
+	}
+	number, err := strconv.ParseUint(block.Number, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return number, true, nil
+}
+
+func (r *esRepository) GetBlock(number string) (*Doc, error) {
+	return r.get(db.BlockIndex, number)
+}
+
+func (r *esRepository) FindBlock(number uint64) (*ESBlock, error) {
+	doc, err := r.get(db.BlockIndex, strconv.FormatUint(number, 10))
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	block := new(ESBlock)
+	err = json.Unmarshal(doc.Source, block)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (r *esRepository) ListBlocks(page Page, finality string) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"sort": sortBy(blockSortField()),
+	}
+	if finality != "" {
+		body["query"] = termQuery("finality", finality)
+	}
+	return r.search(db.BlockIndex, body, &page)
+}
+
+func (r *esRepository) ListBlocksByHash(hash string) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("blockHash", hash),
+	}
+	return r.search(db.BlockIndex, body, nil)
+}
+
+func (r *esRepository) ListBlobBlocks(page Page, withBlobs bool) (*SearchResult, error) {
+	query := map[string]interface{}{
+		"exists": map[string]interface{}{
+			"field": "excessBlobGas",
+		},
+	}
+	if withBlobs {
+		query = map[string]interface{}{
+			"range": map[string]interface{}{
+				"blobCount": map[string]interface{}{
+					"gt": 0,
+				},
+			},
+		}
+	}
+	body := map[string]interface{}{
+		"sort":  sortBy(blockSortField()),
+		"query": query,
+	}
+	return r.search(db.BlockIndex, body, &page)
+}
+
+// LastBlockNumber 旧数据的number可能不是数字类型，按时间排序
+func (r *esRepository) LastBlockNumber() (uint64, bool, error) {
+	return r.lastBlock("timestamp", nil)
+}
+
+func (r *esRepository) LastFinalityNumber(finality string) (uint64, bool, error) {
+	return r.lastBlock(blockSortField(), termQuery("finality", finality))
+}
+
+func (r *esRepository) BlockTxCounts(start uint64, end uint64) (map[uint64]int, map[uint64]int, error) {
+	numbers := numberStrings(start, end)
+	blockBody := map[string]interface{}{
+		"_source": []string{"number", "txns"},
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": numbers,
+			},
+		},
+	}
+	blockRes, err := r.search(db.BlockIndex, blockBody, &Page{Size: len(numbers)})
+	if err != nil {
+		return nil, nil, err
+	}
+	txns := map[uint64]int{}
+	for _, hit := range blockRes.Hits {
+		var block ESBlock
+		err = json.Unmarshal(hit.Source, &block)
+		if err != nil {
+			return nil, nil, err
+		}
+		number, err := strconv.ParseUint(hit.Id, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		txns[number] = block.Txns
+	}
+
+	txBody := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"number": numbers,
+			},
+		},
+		"aggs": map[string]interface{}{
+			"txns": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "number",
+					"size":  len(numbers),
+				},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(txBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	txReq := esapi.SearchRequest{
+		Index: []string{db.TxIndex},
+		Body:  &buf,
+	}
+	txRes, err := txReq.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer txRes.Body.Close()
+	if txRes.IsError() {
+		return nil, nil, esError("http:es统计tx出错", txRes)
+	}
+	var countRes esTxCountRes
+	err = json.NewDecoder(txRes.Body).Decode(&countRes)
+	if err != nil {
+		return nil, nil, err
+	}
+	txCount := map[uint64]int{}
+	for _, bucket := range countRes.Aggregations.Txns.Buckets {
+		txCount[bucket.Key] = bucket.DocCount
+	}
+	return txns, txCount, nil
+}
+
+func (r *esRepository) GetTx(hash string) (*Doc, error) {
+	return r.get(db.TxIndex, hash)
+}
+
+func (r *esRepository) ListTxs(page Page, block string, finality string) (*SearchResult, error) {
+	var filter []interface{}
+	if block != "" {
+		filter = append(filter, map[string]interface{}{
+			"match": map[string]interface{}{
+				"number": block,
+			},
+		})
+	}
+	if finality != "" {
+		filter = append(filter, termQuery("finality", finality))
+	}
+	body := map[string]interface{}{
+		"sort": sortBy("timestamp"),
+	}
+	if len(filter) > 0 {
+		body["query"] = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filter,
+			},
+		}
+	}
+	return r.search(db.TxIndex, body, &page)
+}
+
+func (r *esRepository) ListTxsByAddress(address string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": [2]interface{}{
+					termQuery("to", address),
+					termQuery("from", address),
+				},
+			},
+		},
+		"sort": sortBy("timestamp"),
+	}
+	return r.search(db.TxIndex, body, &page)
+}
+
+func (r *esRepository) ListContractCreations(page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"sort": sortBy("timestamp"),
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": [1]interface{}{
+					termQuery("contractAddress", ""),
+				},
+			},
+		},
+	}
+	return r.search(db.TxIndex, body, &page)
+}
+
+func (r *esRepository) ListContractTxs(page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"sort": sortBy("timestamp"),
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": [1]interface{}{
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							"logLength": map[string]interface{}{
+								"gt": 0,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return r.search(db.TxIndex, body, &page)
+}
+
+func (r *esRepository) ListInternalTxsByTx(hash string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("transactionHash", hash),
+		"sort": [1]interface{}{
+			map[string]interface{}{
+				"index": map[string]interface{}{
+					"order": "asc",
+				},
+			},
+		},
+	}
+	return r.search(db.InternalTxIndex, body, &page)
+}
+
+func (r *esRepository) ListInternalTxsByAddress(address string, page Page) (*SearchResult, error) {
+	sort := make([]interface{}, 0, 4)
+	for _, field := range []string{"timestamp", "number", "transactionIndex", "index"} {
+		sort = append(sort, sortBy(field)[0])
+	}
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": [2]interface{}{
+					termQuery("to", address),
+					termQuery("from", address),
+				},
+			},
+		},
+		"sort": sort,
+	}
+	return r.search(db.InternalTxIndex, body, &page)
+}
+
+// 代币转账按高度和日志序号倒序，TransferBatch里的转账再按batchIndex排列
+var esTokenTransferSort = [3]interface{}{sortBy("number")[0], sortBy("logIndex")[0], sortBy("batchIndex")[0]}
+
+func (r *esRepository) ListTokenTransfersByToken(token string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("token", token),
+		"sort":  esTokenTransferSort,
+	}
+	return r.search(db.TokenTransferIndex, body, &page)
+}
+
+func (r *esRepository) ListTokenTransfersByAddress(address string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": [2]interface{}{
+					termQuery("to", address),
+					termQuery("from", address),
+				},
+			},
+		},
+		"sort": esTokenTransferSort,
+	}
+	return r.search(db.TokenTransferIndex, body, &page)
+}
+
+func (r *esRepository) ListTokenTransfersByTx(hash string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("transactionHash", hash),
+		"sort": [2]interface{}{
+			map[string]interface{}{
+				"logIndex": map[string]interface{}{
+					"order": "asc",
+				},
+			},
+			map[string]interface{}{
+				"batchIndex": map[string]interface{}{
+					"order": "asc",
+				},
+			},
+		},
+	}
+	return r.search(db.TokenTransferIndex, body, &page)
+}
+
+func (r *esRepository) ListTokenTransfersByTokenId(token string, tokenId string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": [2]interface{}{
+					termQuery("token", token),
+					termQuery("tokenId", tokenId),
+				},
+			},
+		},
+		"sort": esTokenTransferSort,
+	}
+	return r.search(db.TokenTransferIndex, body, &page)
+}
+
+// 余额更新到一半时余额文档的数量可能是0，查询时只返回数量大于0的，pending和amountSort是更新和排序用的，不返回
+var esTokenBalanceSource = map[string]interface{}{
+	"excludes": [2]string{"pending", "amountSort"},
+}
+
+func tokenBalanceQuery(filters ...interface{}) map[string]interface{} {
+	filters = append(filters, map[string]interface{}{
+		"range": map[string]interface{}{
+			"amount.numeric": map[string]interface{}{
+				"gt": 0,
+			},
+		},
+	})
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": filters,
+		},
+	}
+}
+
+func (r *esRepository) ListNftInventory(address string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"_source": esTokenBalanceSource,
+		"query": tokenBalanceQuery(
+			termQuery("holder", address),
+			map[string]interface{}{
+				"terms": map[string]interface{}{
+					"standard": [2]string{TokenStandardERC721, TokenStandardERC1155},
+				},
+			},
+		),
+		"sort": sortBy("number"),
+	}
+	return r.search(db.TokenBalanceIndex, body, &page)
+}
+
+// ListTokenHolders 按补齐位数的amountSort排序，amount.numeric是double，非常大的数量之间的顺序不精确
+func (r *esRepository) ListTokenHolders(token string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"_source": esTokenBalanceSource,
+		"query":   tokenBalanceQuery(termQuery("token", token)),
+		"sort": [2]interface{}{
+			sortBy("amountSort")[0],
+			map[string]interface{}{
+				"id": map[string]interface{}{
+					"order": "asc",
+				},
+			},
+		},
+	}
+	return r.search(db.TokenBalanceIndex, body, &page)
+}
+
+func (r *esRepository) ListTokenBalances(address string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"_source": esTokenBalanceSource,
+		"query":   tokenBalanceQuery(termQuery("holder", address)),
+		"sort":    sortBy("number"),
+	}
+	return r.search(db.TokenBalanceIndex, body, &page)
+}
+
+// ListNftHolders 用terms聚合统计每个地址的余额文档数量，聚合不能跳过前面的桶，取from+size个再截取
+func (r *esRepository) ListNftHolders(token string, page Page) (*SearchResult, error) {
+	size := page.From + page.Size
+	if size > 10000 {
+		size = 10000
+	}
+	body := map[string]interface{}{
+		"size":  0,
+		"query": tokenBalanceQuery(termQuery("token", token)),
+		"aggs": map[string]interface{}{
+			"holders": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "holder",
+					"size":  size,
+					"order": map[string]interface{}{
+						"_count": "desc",
+					},
+				},
+				"aggs": map[string]interface{}{
+					// holder字段是小写的，取一个文档里原来的地址
+					"holder": map[string]interface{}{
+						"top_hits": map[string]interface{}{
+							"size":    1,
+							"_source": [2]string{"token", "holder"},
+						},
+					},
+				},
+			},
+			"total": map[string]interface{}{
+				"cardinality": map[string]interface{}{
+					"field": "holder",
+				},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{db.TokenBalanceIndex},
+		Body:  &buf,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, esError("http:es统计nft持有人出错", res)
+	}
+	var holderRes esNftHolderRes
+	err = json.NewDecoder(res.Body).Decode(&holderRes)
+	if err != nil {
+		return nil, err
+	}
+	result := &SearchResult{
+		Total:    holderRes.Aggregations.Total.Value,
+		Relation: "eq",
+		Hits:     []*Doc{},
+	}
+	buckets := holderRes.Aggregations.Holders.Buckets
+	for i := page.From; i < len(buckets); i++ {
+		holder := &ESNftHolder{Token: token, Tokens: buckets[i].DocCount}
+		if hits := buckets[i].Holder.Hits.Hits; len(hits) > 0 {
+			var balance ESTokenBalance
+			err = json.Unmarshal(hits[0].Source, &balance)
+			if err != nil {
+				return nil, err
+			}
+			holder.Token, holder.Holder = balance.Token, balance.Holder
+		}
+		source, err := json.Marshal(holder)
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = append(result.Hits, &Doc{Index: db.TokenBalanceIndex, Id: holder.Holder, Found: true, Source: source})
+	}
+	return result, nil
+}
+
+func (r *esRepository) FindBalance(address string, number uint64) (*Doc, error) {
+	// number是long类型
+	if number > math.MaxInt64 {
+		number = math.MaxInt64
+	}
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": [2]interface{}{
+					termQuery("address", address),
+					map[string]interface{}{
+						"range": map[string]interface{}{
+							"number": map[string]interface{}{
+								"lte": number,
+							},
+						},
+					},
+				},
+			},
+		},
+		"sort": sortBy("number"),
+	}
+	result, err := r.search(db.BalanceIndex, body, &Page{Size: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Hits) == 0 {
+		return &Doc{Index: db.BalanceIndex, Id: address}, nil
+	}
+	return result.Hits[0], nil
+}
+
+func (r *esRepository) ListBalances(address string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("address", address),
+		"sort":  sortBy("number"),
+	}
+	return r.search(db.BalanceIndex, body, &page)
+}
+
+func (r *esRepository) GetAbi(address string) (*Doc, error) {
+	return r.get(db.AbiIndex, strings.ToLower(address))
+}
+
+func (r *esRepository) ListSignatures(id string, page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					termQuery("selector", id),
+					termQuery("topic", id),
+				},
+				"minimum_should_match": 1,
+			},
+		},
+		"sort": sortBy("signature"),
+	}
+	return r.search(db.SignatureIndex, body, &page)
+}
+
+func (r *esRepository) GetAddress(address string) (*Doc, error) {
+	return r.get(db.AddressIndex, address)
+}
+
+func (r *esRepository) ListAddresses(addresses []string) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": addresses,
+			},
+		},
+	}
+	return r.search(db.AddressIndex, body, nil)
+}
+
+func (r *esRepository) UpdateAddressType(address string, _type uint8) error {
+	body := map[string]interface{}{
+		"doc": map[string]interface{}{
+			"type": _type,
+		},
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return err
+	}
+	req := esapi.UpdateRequest{
+		Index:      db.AddressIndex,
+		DocumentID: address,
+		Body:       &buf,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError("http:es更新address出错", res)
+	}
+	return nil
+}
+
+func (r *esRepository) ListReorgs(page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"sort": sortBy("timestamp"),
+	}
+	return r.search(db.ReorgIndex, body, &page)
+}
+
+func (r *esRepository) ListReorgsByTx(hash string) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"query": termQuery("txHashes", hash),
+		"sort":  sortBy("timestamp"),
+	}
+	return r.search(db.ReorgIndex, body, nil)
+}
+
+func (r *esRepository) ListDeadLetters(page Page) (*SearchResult, error) {
+	body := map[string]interface{}{
+		"sort": sortBy("timestamp"),
+	}
+	return r.search(db.DeadLetterIndex, body, &page)
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"explorer/log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"go.uber.org/zap"
+)
+
+// bulk里被限流的操作最多重试的次数
+const bulkMaxRetries = 8
+
+// BulkStats es bulk逐条写入的结果
+type BulkStats struct {
+	BulkItems     uint64 `json:"bulkItems"`
+	BulkConflicts uint64 `json:"bulkConflicts"`
+	BulkRetried   uint64 `json:"bulkRetried"`
+	BulkFailed    uint64 `json:"bulkFailed"`
+}
+
+var bulkStats BulkStats
+
+// GetBulkStats 获取bulk写入的统计，非es的存储后端都是0
+func GetBulkStats() BulkStats {
+	return BulkStats{
+		BulkItems:     atomic.LoadUint64(&bulkStats.BulkItems),
+		BulkConflicts: atomic.LoadUint64(&bulkStats.BulkConflicts),
+		BulkRetried:   atomic.LoadUint64(&bulkStats.BulkRetried),
+		BulkFailed:    atomic.LoadUint64(&bulkStats.BulkFailed),
+	}
+}
+
+// bulkItem bulk请求里的一条操作，delete没有source
+type bulkItem struct {
+	action []byte
+	source []byte
+}
+
+type ESBulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type ESBulkItemResult struct {
+	Index  string           `json:"_index"`
+	Id     string           `json:"_id"`
+	Status int              `json:"status"`
+	Error  *ESBulkItemError `json:"error"`
+}
+
+type ESBulkRes struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]ESBulkItemResult `json:"items"`
+}
+
+// 只返回判断结果需要的字段
+var bulkFilterPath = []string{"errors", "items.*._index", "items.*._id", "items.*.status", "items.*.error"}
+
+// parseBulkBody 把ndjson拆成一条条操作，用于只重试失败的部分
+func parseBulkBody(body []byte) ([]bulkItem, error) {
+	var items []bulkItem
+	lines := bytes.Split(body, []byte{'\n'})
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var action map[string]json.RawMessage
+		err := json.Unmarshal(line, &action)
+		if err != nil {
+			return nil, err
+		}
+		item := bulkItem{action: line}
+		if _, ok := action["delete"]; !ok {
+			i++
+			if i >= len(lines) || len(bytes.TrimSpace(lines[i])) == 0 {
+				return nil, errors.New("bulk body缺少source")
+			}
+			item.source = lines[i]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// bulkItemOk create已存在(409)和delete不存在(404)视为成功，保证重复同步是幂等的
+func bulkItemOk(action string, result ESBulkItemResult) bool {
+	if result.Status < 300 {
+		return true
+	}
+	if action == "create" && result.Status == 409 {
+		atomic.AddUint64(&bulkStats.BulkConflicts, 1)
+		return true
+	}
+	// 删除或更新的文档已经不存在，例如重新计算手续费时交易所在的块被回滚
+	return (action == "delete" || action == "update") && result.Status == 404
+}
+
+func bulkItemRetriable(result ESBulkItemResult) bool {
+	return result.Status == 429 || result.Status >= 500
+}
+
+// doBulk 发送一次bulk请求，返回需要重试的操作和无法恢复的错误
+func (r *esRepository) doBulk(items []bulkItem) ([]bulkItem, error) {
+	body := new(bytes.Buffer)
+	for _, item := range items {
+		body.Write(item.action)
+		body.WriteByte('\n')
+		if item.source != nil {
+			body.Write(item.source)
+			body.WriteByte('\n')
+		}
+	}
+	req := esapi.BulkRequest{
+		Body:       bytes.NewReader(body.Bytes()),
+		FilterPath: bulkFilterPath,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return nil, esError("批量写入http返回报错", res)
+	}
+	var bulkRes ESBulkRes
+	err = json.NewDecoder(res.Body).Decode(&bulkRes)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&bulkStats.BulkItems, uint64(len(items)))
+	if !bulkRes.Errors {
+		return nil, nil
+	}
+	if len(bulkRes.Items) != len(items) {
+		return nil, errors.New("bulk返回的数量和请求不一致")
+	}
+	var retryItems []bulkItem
+	var failed []string
+	for i, resultMap := range bulkRes.Items {
+		for action, result := range resultMap {
+			if bulkItemOk(action, result) {
+				continue
+			}
+			if bulkItemRetriable(result) {
+				retryItems = append(retryItems, items[i])
+				continue
+			}
+			reason := ""
+			if result.Error != nil {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			log.Logger.Error("es写入失败",
+				zap.String("action", action),
+				zap.String("index", result.Index),
+				zap.String("id", result.Id),
+				zap.Int("status", result.Status),
+				zap.String("reason", reason),
+			)
+			failed = append(failed, result.Index+"/"+result.Id)
+		}
+	}
+	if len(failed) > 0 {
+		atomic.AddUint64(&bulkStats.BulkFailed, uint64(len(failed)))
+		return retryItems, &Error{Msg: "es写入失败:" + strings.Join(failed, ",")}
+	}
+	return retryItems, nil
+}
+
+// bulkWrite 批量写入，逐条检查结果，只重试被限流或服务端出错的操作
+func (r *esRepository) bulkWrite(body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+	items, err := parseBulkBody(body)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; len(items) > 0; attempt++ {
+		retryItems, err := r.doBulk(items)
+		if err != nil {
+			return err
+		}
+		if len(retryItems) == 0 {
+			return nil
+		}
+		if attempt >= bulkMaxRetries {
+			return &Error{Msg: "es写入重试次数过多", Transient: true}
+		}
+		atomic.AddUint64(&bulkStats.BulkRetried, uint64(len(retryItems)))
+		delay := bulkDelay(attempt)
+		log.Logger.Warn("es部分写入被拒绝，稍后重试",
+			zap.Int("items", len(retryItems)),
+			zap.Duration("delay", delay),
+		)
+		time.Sleep(delay)
+		items = retryItems
+	}
+	return nil
+}
+
+// bulkDelay 第attempt次重试前等待的时间，最多30秒
+func bulkDelay(attempt int) time.Duration {
+	if attempt >= 5 {
+		return 30 * time.Second
+	}
+	return time.Second << uint(attempt)
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"explorer/log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	log.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func TestParseBulkBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		sources []string
+		wantErr bool
+	}{
+		{
+			name:    "create and delete",
+			body:    `{"create":{"_index":"tx","_id":"1"}}` + "\n" + `{"hash":"1"}` + "\n" + `{"delete":{"_index":"tx","_id":"2"}}` + "\n",
+			sources: []string{`{"hash":"1"}`, ""},
+		},
+		{
+			name:    "update with blank lines",
+			body:    "\n" + `{"update":{"_index":"tx","_id":"1"}}` + "\n" + `{"doc":{"fee":"1"}}` + "\n\n",
+			sources: []string{`{"doc":{"fee":"1"}}`},
+		},
+		{
+			name:    "missing source",
+			body:    `{"index":{"_index":"tx","_id":"1"}}` + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid action",
+			body:    `{"index":` + "\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseBulkBody([]byte(tt.body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.sources) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.sources))
+			}
+			for i, item := range items {
+				if string(item.source) != tt.sources[i] {
+					t.Errorf("item %d source = %q, want %q", i, item.source, tt.sources[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBulkItemOk(t *testing.T) {
+	tests := []struct {
+		action string
+		status int
+		want   bool
+	}{
+		{"create", 201, true},
+		{"index", 200, true},
+		{"create", 409, true},
+		{"index", 409, false},
+		{"delete", 404, true},
+		{"update", 404, true},
+		{"create", 404, false},
+		{"update", 400, false},
+		{"index", 429, false},
+		{"delete", 500, false},
+	}
+	for _, tt := range tests {
+		got := bulkItemOk(tt.action, ESBulkItemResult{Status: tt.status})
+		if got != tt.want {
+			t.Errorf("bulkItemOk(%s, %d) = %v, want %v", tt.action, tt.status, got, tt.want)
+		}
+	}
+}
+
+// fakeBulkServer 模拟es的bulk接口，respond按请求的序号和操作的序号返回状态码
+func fakeBulkServer(t *testing.T, respond func(request int, item int) int) (*esRepository, *[][]string) {
+	t.Helper()
+	var requests [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/" {
+			w.Write([]byte(`{"version":{"number":"7.17.0","build_flavor":"default"},"tagline":"You Know, for Search"}`))
+			return
+		}
+		var ids []string
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			var action map[string]struct {
+				Id string `json:"_id"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &action) != nil {
+				continue
+			}
+			for name, meta := range action {
+				if name == "create" || name == "index" || name == "update" || name == "delete" {
+					ids = append(ids, meta.Id)
+				}
+			}
+		}
+		res := ESBulkRes{}
+		for i, id := range ids {
+			status := respond(len(requests), i)
+			if status >= 300 {
+				res.Errors = true
+			}
+			res.Items = append(res.Items, map[string]ESBulkItemResult{"index": {Index: "tx", Id: id, Status: status}})
+		}
+		requests = append(requests, ids)
+		json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &esRepository{client: client}, &requests
+}
+
+func testBulkBody(ids ...string) []byte {
+	buf := new(bytes.Buffer)
+	for _, id := range ids {
+		writeBulkLine(buf, "index", "tx", id, map[string]string{"hash": id})
+	}
+	return buf.Bytes()
+}
+
+func TestBulkWriteRetriesRejectedItems(t *testing.T) {
+	r, requests := fakeBulkServer(t, func(request int, item int) int {
+		// 第一次请求里第二个操作被限流
+		if request == 0 && item == 1 {
+			return 429
+		}
+		return 201
+	})
+	err := r.bulkWrite(testBulkBody("a", "b", "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("got %d bulk requests, want 2", len(*requests))
+	}
+	if retried := strings.Join((*requests)[1], ","); retried != "b" {
+		t.Errorf("retried %q, want only b", retried)
+	}
+}
+
+func TestBulkWriteFailsOnRejectedItem(t *testing.T) {
+	r, requests := fakeBulkServer(t, func(request int, item int) int {
+		if item == 0 {
+			return 400
+		}
+		return 201
+	})
+	err := r.bulkWrite(testBulkBody("a", "b"))
+	storeErr, ok := err.(*Error)
+	if !ok || storeErr.Transient {
+		t.Fatalf("bulkWrite() = %v, want a permanent store error", err)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("got %d bulk requests, want 1", len(*requests))
+	}
+}
@@ -0,0 +1,761 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"explorer/db"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// 同步进度保存在sync索引的这个文档里
+const checkpointId = "checkpoint"
+
+// writeBulkLine 把一条bulk操作写入buf，source为nil时只写操作行
+func writeBulkLine(buf *bytes.Buffer, action string, index string, id string, source interface{}) error {
+	line, err := json.Marshal(map[string]interface{}{
+		action: map[string]interface{}{
+			"_index": index,
+			"_id":    id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	if source == nil {
+		return nil
+	}
+	sourceLine, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	buf.Write(sourceLine)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// newAddresses 过滤掉es里已经存在的地址，合约地址优先
+func (r *esRepository) newAddresses(addresses []string, contracts []string) (map[string]uint8, error) {
+	addressMap := map[string]uint8{}
+	for _, address := range addresses {
+		addressMap[address] = AddressTypeAccount
+	}
+	for _, contract := range contracts {
+		addressMap[contract] = AddressTypeContract
+	}
+	allAddress := make([]string, 0, len(addressMap))
+	for address := range addressMap {
+		allAddress = append(allAddress, address)
+	}
+	existing, err := r.existingIds(db.AddressIndex, allAddress)
+	if err != nil {
+		return nil, err
+	}
+	for address := range existing {
+		delete(addressMap, address)
+	}
+	return addressMap, nil
+}
+
+// existingIds 查询index里已经存在的id，用实时的mget，重试时刚写入还没有refresh的文档也能查到
+func (r *esRepository) existingIds(index string, ids []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	for i := 0; i < len(ids); i += 1000 {
+		j := i + 1000
+		if j > len(ids) {
+			j = len(ids)
+		}
+		docs, err := r.mget(index, ids[i:j], nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if doc.Found {
+				existing[doc.Id] = true
+			}
+		}
+	}
+	return existing, nil
+}
+
+// 余额的改变分两步，es没有事务，每一步都可以重试：
+//  1. apply: 把每个转账的改变加到余额上，转账的id以action:id记录在余额的pending里，已经记录过的跳过。
+//     同一个转账的另一种action的记录是之前一轮同步或回滚留下的，一起清除
+//  2. commit: 转账写入或删除之后清除pending里这些转账的记录，余额为0且没有未完成的转账时删除
+//
+// pending里超过一天的记录是失败后没有再重试的，apply时清除。amountSort和amountSortKey的格式一致
+const balanceScript = `Map pending = ctx._source.pending;
+if (pending == null) {
+	pending = new HashMap();
+	ctx._source.pending = pending;
+}
+long expire = params.time - 86400000L;
+pending.values().removeIf(t -> t < expire);
+BigInteger amount = new BigInteger(ctx._source.amount);
+boolean changed = false;
+for (def part : params.parts) {
+	String key = params.action + ':' + part.id;
+	if (!pending.containsKey(key)) {
+		amount = amount.add(new BigInteger(part.delta));
+		pending.put(key, params.time);
+		pending.remove(params.undo + ':' + part.id);
+		changed = true;
+	}
+}
+if (!changed) {
+	ctx.op = 'noop';
+} else {
+	ctx._source.amount = amount.toString();
+	String digits = amount.abs().toString();
+	StringBuilder sort = new StringBuilder();
+	if (amount.signum() < 0) {
+		sort.append('-');
+	}
+	for (int i = digits.length(); i < 78; i++) {
+		sort.append('0');
+	}
+	ctx._source.amountSort = sort.append(digits).toString();
+	if (params.number != null) {
+		ctx._source.number = params.number;
+	}
+}`
+
+const balanceCommitScript = `Map pending = ctx._source.pending;
+boolean removed = pending != null && pending.keySet().removeAll(params.keys);
+if ((pending == null || pending.isEmpty()) && new BigInteger(ctx._source.amount).signum() == 0) {
+	ctx.op = 'delete';
+} else if (!removed) {
+	ctx.op = 'noop';
+}`
+
+const (
+	balanceApply  = "apply"
+	balanceRevert = "revert"
+)
+
+// applyBalances 用带upsert的脚本更新余额，冲突时由es重试。action是apply或revert，同一个转账的同一种action只计算一次
+func (r *esRepository) applyBalances(deltas []*balanceDelta, action string) error {
+	undo := balanceRevert
+	if action == balanceRevert {
+		undo = balanceApply
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	buf := new(bytes.Buffer)
+	for _, delta := range deltas {
+		parts := make([]map[string]string, 0, len(delta.Parts))
+		for _, part := range delta.Parts {
+			parts = append(parts, map[string]string{"id": part.TransferId, "delta": part.Amount.String()})
+		}
+		params := map[string]interface{}{
+			"parts":  parts,
+			"action": action,
+			"undo":   undo,
+			"time":   now,
+		}
+		if delta.Number != "" {
+			params["number"] = delta.Number
+		}
+		upsert := newBalance(delta)
+		upsert.Amount = "0"
+		err := writeBalanceUpdate(buf, delta.Id, map[string]interface{}{
+			"scripted_upsert": true,
+			"script": map[string]interface{}{
+				"source": balanceScript,
+				"lang":   "painless",
+				"params": params,
+			},
+			"upsert": upsert,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(buf.Bytes())
+}
+
+// commitBalances 转账写入或删除之后清除余额里这些转账的pending记录，余额不存在时忽略
+func (r *esRepository) commitBalances(transfers []*ESTokenTransfer, action string) error {
+	buf := new(bytes.Buffer)
+	for id, transferIds := range balanceTransfers(transfers) {
+		keys := make([]string, 0, len(transferIds))
+		for _, transferId := range transferIds {
+			keys = append(keys, action+":"+transferId)
+		}
+		err := writeBalanceUpdate(buf, id, map[string]interface{}{
+			"script": map[string]interface{}{
+				"source": balanceCommitScript,
+				"lang":   "painless",
+				"params": map[string]interface{}{
+					"keys": keys,
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(buf.Bytes())
+}
+
+// logNegativeBalances 读取减少了的余额，记录变成负数的，负数的余额仍然保存，之后的转账或回滚还要在它上面计算
+func (r *esRepository) logNegativeBalances(deltas []*balanceDelta) error {
+	var ids []string
+	for _, delta := range deltas {
+		if delta.Amount.Sign() < 0 {
+			ids = append(ids, delta.Id)
+		}
+	}
+	for i := 0; i < len(ids); i += 1000 {
+		j := i + 1000
+		if j > len(ids) {
+			j = len(ids)
+		}
+		docs, err := r.mget(db.TokenBalanceIndex, ids[i:j], []string{"amount"})
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if !doc.Found {
+				continue
+			}
+			var balance ESTokenBalance
+			err = json.Unmarshal(doc.Source, &balance)
+			if err != nil {
+				return err
+			}
+			if compareAmount(balance.Amount, "0") < 0 {
+				logNegativeBalance(doc.Id, balance.Amount)
+			}
+		}
+	}
+	return nil
+}
+
+// RebuildTokenBalances 按id读取全部转账重新计算余额，删除现有的余额后写入。es没有事务，失败后重新执行即可
+func (r *esRepository) RebuildTokenBalances() (int, error) {
+	err := r.refresh(db.TokenTransferIndex, db.TokenBalanceIndex)
+	if err != nil {
+		return 0, err
+	}
+	balances, err := rebuildBalances(func(add func(transfer *ESTokenTransfer) error) error {
+		body := map[string]interface{}{"query": map[string]interface{}{"match_all": map[string]interface{}{}}}
+		return r.scan(db.TokenTransferIndex, body, "id", func(doc *Doc) error {
+			transfer := new(ESTokenTransfer)
+			err := json.Unmarshal(doc.Source, transfer)
+			if err != nil {
+				return err
+			}
+			return add(transfer)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = r.deleteByQuery(db.TokenBalanceIndex, map[string]interface{}{"match_all": map[string]interface{}{}})
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(balances); i += 1000 {
+		j := i + 1000
+		if j > len(balances) {
+			j = len(balances)
+		}
+		buf := new(bytes.Buffer)
+		for _, balance := range balances[i:j] {
+			err = writeBulkLine(buf, "index", db.TokenBalanceIndex, balance.Id, &esTokenBalance{balance, amountSortKey(balance.Amount)})
+			if err != nil {
+				return 0, err
+			}
+		}
+		err = r.bulkWrite(buf.Bytes())
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(balances), nil
+}
+
+// esTokenBalance es里的余额文档，多一个按数量排序用的amountSort
+type esTokenBalance struct {
+	*ESTokenBalance
+	AmountSort string `json:"amountSort"`
+}
+
+// uint256最大是78位十进制数
+const amountSortDigits = 78
+
+// amountSortKey 数量补齐到78位的字符串，按keyword排序和数值的顺序一致。
+// double只有53位精度，很大的数量之间不能用amount.numeric排序。负数的余额不返回，只加上负号
+func amountSortKey(amount string) string {
+	digits := strings.TrimPrefix(amount, "-")
+	sign := ""
+	if digits != amount {
+		sign = "-"
+	}
+	if len(digits) >= amountSortDigits {
+		return amount
+	}
+	return sign + strings.Repeat("0", amountSortDigits-len(digits)) + digits
+}
+
+// writeBalanceUpdate 写入一条更新余额的bulk操作
+func writeBalanceUpdate(buf *bytes.Buffer, id string, source interface{}) error {
+	action, err := json.Marshal(map[string]interface{}{
+		"update": map[string]interface{}{
+			"_index":            db.TokenBalanceIndex,
+			"_id":               id,
+			"retry_on_conflict": 5,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sourceLine, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	buf.Write(action)
+	buf.WriteByte('\n')
+	buf.Write(sourceLine)
+	buf.WriteByte('\n')
+	return nil
+}
+
+func (r *esRepository) UpsertBlockBatch(batch *BlockBatch) error {
+	txBuf := new(bytes.Buffer)
+	for _, esTx := range batch.Txs {
+		err := writeBulkLine(txBuf, "index", db.TxIndex, esTx.Hash, esTx)
+		if err != nil {
+			return err
+		}
+	}
+	err := r.bulkWrite(txBuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// es没有事务，先对还没有写入的转账更新余额再写入转账，最后清除余额里的pending记录。
+	// 任何一步失败后重试，已经计算过的转账由pending跳过
+	transferIds := make([]string, 0, len(batch.TokenTransfers))
+	for _, transfer := range batch.TokenTransfers {
+		transferIds = append(transferIds, transfer.Id)
+	}
+	existingTransfers, err := r.existingIds(db.TokenTransferIndex, transferIds)
+	if err != nil {
+		return err
+	}
+	var newTransfers []*ESTokenTransfer
+	for _, transfer := range batch.TokenTransfers {
+		if !existingTransfers[transfer.Id] {
+			newTransfers = append(newTransfers, transfer)
+		}
+	}
+	deltas, err := balanceDeltas(newTransfers, false)
+	if err != nil {
+		return err
+	}
+	err = r.applyBalances(deltas, balanceApply)
+	if err != nil {
+		return err
+	}
+
+	// 内部调用按链上的数据覆盖，转账用create，已经计算过余额的不会被改写
+	eventBuf := new(bytes.Buffer)
+	for _, internalTx := range batch.InternalTxs {
+		err := writeBulkLine(eventBuf, "index", db.InternalTxIndex, internalTx.Id, internalTx)
+		if err != nil {
+			return err
+		}
+	}
+	for _, transfer := range batch.TokenTransfers {
+		err := writeBulkLine(eventBuf, "create", db.TokenTransferIndex, transfer.Id, transfer)
+		if err != nil {
+			return err
+		}
+	}
+	err = r.bulkWrite(eventBuf.Bytes())
+	if err != nil {
+		return err
+	}
+	err = r.commitBalances(batch.TokenTransfers, balanceApply)
+	if err != nil {
+		return err
+	}
+	err = r.logNegativeBalances(deltas)
+	if err != nil {
+		return err
+	}
+
+	// 余额记录按id覆盖，重复写入是幂等的
+	balanceBuf := new(bytes.Buffer)
+	for _, balance := range batch.Balances {
+		err := writeBulkLine(balanceBuf, "index", db.BalanceIndex, balance.Id, balance)
+		if err != nil {
+			return err
+		}
+	}
+	err = r.bulkWrite(balanceBuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	addressMap, err := r.newAddresses(batch.Addresses, batch.Contracts)
+	if err != nil {
+		return err
+	}
+	addressBuf := new(bytes.Buffer)
+	for address, _type := range addressMap {
+		err := writeBulkLine(addressBuf, "create", db.AddressIndex, address, batch.address(address, _type))
+		if err != nil {
+			return err
+		}
+	}
+	err = r.bulkWrite(addressBuf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// block最后写入，块存在就说明块里的数据都已经写入
+	blockBuf := new(bytes.Buffer)
+	for _, esBlock := range batch.Blocks {
+		err := writeBulkLine(blockBuf, "index", db.BlockIndex, esBlock.Number, esBlock)
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(blockBuf.Bytes())
+}
+
+func (r *esRepository) RemoveBlocks(blocks []*ESBlock) ([]string, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	hashes := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		hashes = append(hashes, block.BlockHash)
+	}
+	err := r.refresh(db.TxIndex, db.InternalTxIndex, db.TokenTransferIndex, db.BalanceIndex)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{
+		"_source": []string{"hash", "contractAddress"},
+		"query":   blockHashQuery(hashes),
+	}
+	txHashes := []string{}
+	deleteBuf := new(bytes.Buffer)
+	err = r.scan(db.TxIndex, body, "hash", func(doc *Doc) error {
+		txHashes = append(txHashes, doc.Id)
+		err := writeBulkLine(deleteBuf, "delete", db.TxIndex, doc.Id, nil)
+		if err != nil {
+			return err
+		}
+		var esTx ESTx
+		err = json.Unmarshal(doc.Source, &esTx)
+		if err != nil {
+			return err
+		}
+		if esTx.ContractAddress != "" {
+			return writeBulkLine(deleteBuf, "delete", db.AddressIndex, esTx.ContractAddress, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := r.removeInternalTxs(hashes)
+	if err != nil {
+		return nil, err
+	}
+	err = r.removeTokenTransfers(hashes)
+	if err != nil {
+		return nil, err
+	}
+	err = r.deleteByQuery(db.BalanceIndex, blockHashQuery(hashes))
+	if err != nil {
+		return nil, err
+	}
+	for _, contract := range contracts {
+		err := writeBulkLine(deleteBuf, "delete", db.AddressIndex, contract, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, block := range blocks {
+		err := writeBulkLine(deleteBuf, "delete", db.BlockIndex, block.Number, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txHashes, r.bulkWrite(deleteBuf.Bytes())
+}
+
+func blockHashQuery(blockHashes []string) map[string]interface{} {
+	return map[string]interface{}{
+		"terms": map[string]interface{}{
+			"blockHash": blockHashes,
+		},
+	}
+}
+
+// deleteByQuery 删除符合条件的文档
+func (r *esRepository) deleteByQuery(index string, query map[string]interface{}) error {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(map[string]interface{}{"query": query})
+	if err != nil {
+		return err
+	}
+	req := esapi.DeleteByQueryRequest{
+		Index:     []string{index},
+		Body:      &buf,
+		Conflicts: "proceed",
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError("http:es删除"+index+"出错", res)
+	}
+	return nil
+}
+
+// removeTokenTransfers 回滚孤块里的转账对余额的改变，按id删除回滚过的转账后清除pending记录。
+// 删除失败后重试时，转账还在，回滚由pending跳过
+func (r *esRepository) removeTokenTransfers(blockHashes []string) error {
+	var transfers []*ESTokenTransfer
+	body := map[string]interface{}{"query": blockHashQuery(blockHashes)}
+	err := r.scan(db.TokenTransferIndex, body, "id", func(doc *Doc) error {
+		transfer := new(ESTokenTransfer)
+		err := json.Unmarshal(doc.Source, transfer)
+		if err != nil {
+			return err
+		}
+		transfers = append(transfers, transfer)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	deltas, err := balanceDeltas(transfers, true)
+	if err != nil {
+		return err
+	}
+	err = r.applyBalances(deltas, balanceRevert)
+	if err != nil {
+		return err
+	}
+	deleteBuf := new(bytes.Buffer)
+	for _, transfer := range transfers {
+		err := writeBulkLine(deleteBuf, "delete", db.TokenTransferIndex, transfer.Id, nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = r.bulkWrite(deleteBuf.Bytes())
+	if err != nil {
+		return err
+	}
+	err = r.commitBalances(transfers, balanceRevert)
+	if err != nil {
+		return err
+	}
+	return r.logNegativeBalances(deltas)
+}
+
+// removeInternalTxs 删除孤块里的内部调用，返回内部调用创建的合约
+func (r *esRepository) removeInternalTxs(blockHashes []string) ([]string, error) {
+	query := blockHashQuery(blockHashes)
+	createBody := map[string]interface{}{
+		"_source": []string{"to"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": [3]interface{}{
+					query,
+					map[string]interface{}{
+						"terms": map[string]interface{}{
+							"type": []string{"CREATE", "CREATE2"},
+						},
+					},
+					termQuery("error", ""),
+				},
+			},
+		},
+	}
+	var contracts []string
+	err := r.scan(db.InternalTxIndex, createBody, "id", func(doc *Doc) error {
+		var internalTx ESInternalTx
+		err := json.Unmarshal(doc.Source, &internalTx)
+		if err != nil {
+			return err
+		}
+		if internalTx.To != "" {
+			contracts = append(contracts, internalTx.To)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contracts, r.deleteByQuery(db.InternalTxIndex, query)
+}
+
+func (r *esRepository) SetFinality(start uint64, end uint64, finality string) error {
+	for i := start; i <= end; i += 1000 {
+		j := i + 999
+		if j > end {
+			j = end
+		}
+		numbers := numberStrings(i, j)
+		for _, index := range []string{db.BlockIndex, db.TxIndex} {
+			err := r.updateFinalityByNumbers(index, numbers, finality)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *esRepository) updateFinalityByNumbers(index string, numbers []string, finality string) error {
+	body := map[string]interface{}{
+		"script": map[string]interface{}{
+			"source": "ctx._source.finality = params.finality",
+			"lang":   "painless",
+			"params": map[string]interface{}{
+				"finality": finality,
+			},
+		},
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"number": numbers,
+			},
+		},
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(body)
+	if err != nil {
+		return err
+	}
+	req := esapi.UpdateByQueryRequest{
+		Index:     []string{index},
+		Body:      &buf,
+		Conflicts: "proceed",
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError("http:es更新"+index+"状态出错", res)
+	}
+	return nil
+}
+
+// index 写入一个文档，id为空时由es生成
+func (r *esRepository) index(index string, id string, source interface{}) error {
+	buf, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	req := esapi.IndexRequest{
+		Index:      index,
+		DocumentID: id,
+		Body:       bytes.NewReader(buf),
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return esError("http:es写入"+index+"出错", res)
+	}
+	return nil
+}
+
+func (r *esRepository) UpdateTxFees(fees []*ESTxFee) error {
+	var buf bytes.Buffer
+	for _, fee := range fees {
+		err := writeBulkLine(&buf, "update", db.TxIndex, fee.Hash, map[string]interface{}{"doc": fee})
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(buf.Bytes())
+}
+
+func (r *esRepository) SaveReorg(reorg *ESReorg) error {
+	return r.index(db.ReorgIndex, "", reorg)
+}
+
+func (r *esRepository) SaveAbi(contractAbi *ESAbi) error {
+	return r.index(db.AbiIndex, strings.ToLower(contractAbi.Address), contractAbi)
+}
+
+func (r *esRepository) SaveSignatures(signatures []*ESSignature) error {
+	var buf bytes.Buffer
+	for _, signature := range signatures {
+		err := writeBulkLine(&buf, "index", db.SignatureIndex, signature.Signature, signature)
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(buf.Bytes())
+}
+
+func (r *esRepository) GetCheckpoint() (*ESCheckpoint, error) {
+	doc, err := r.get(db.SyncIndex, checkpointId)
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	checkpoint := new(ESCheckpoint)
+	err = json.Unmarshal(doc.Source, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (r *esRepository) SaveCheckpoint(checkpoint *ESCheckpoint) error {
+	return r.index(db.SyncIndex, checkpointId, checkpoint)
+}
+
+func (r *esRepository) DeleteCheckpoint() error {
+	req := esapi.DeleteRequest{
+		Index:      db.SyncIndex,
+		DocumentID: checkpointId,
+	}
+	res, err := req.Do(context.Background(), r.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != 404 {
+		return esError("http:es删除同步进度出错", res)
+	}
+	return nil
+}
+
+func (r *esRepository) SaveDeadLetter(deadLetter *ESDeadLetter) error {
+	return r.index(db.DeadLetterIndex, deadLetter.Number, deadLetter)
+}
+
+func (r *esRepository) DeleteDeadLetters(numbers []uint64) error {
+	buf := new(bytes.Buffer)
+	for _, number := range numbers {
+		err := writeBulkLine(buf, "delete", db.DeadLetterIndex, strconv.FormatUint(number, 10), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return r.bulkWrite(buf.Bytes())
+}
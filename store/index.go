@@ -0,0 +1,209 @@
+package store
+
+import (
+	"encoding/json"
+	"explorer/db"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Repository 存储后端，controller和sync只通过它读写数据
+//
+// 列表查询按es的习惯返回文档原文，接口的返回格式和存储后端无关
+type Repository interface {
+	// GetBlock 按高度读取block
+	GetBlock(number string) (*Doc, error)
+	// FindBlock 按高度读取block，不存在时返回nil
+	FindBlock(number uint64) (*ESBlock, error)
+	// ListBlocks 按高度倒序分页，finality为空时不过滤
+	ListBlocks(page Page, finality string) (*SearchResult, error)
+	ListBlocksByHash(hash string) (*SearchResult, error)
+	// ListBlobBlocks 坎昆升级之后的块，按高度倒序分页，withBlobs为true时只返回有blob的块
+	ListBlobBlocks(page Page, withBlobs bool) (*SearchResult, error)
+	// LastBlockNumber 按时间最后写入的块，只用于没有同步进度的旧数据
+	LastBlockNumber() (uint64, bool, error)
+	// LastFinalityNumber 最后一个处于finality状态的块
+	LastFinalityNumber(finality string) (uint64, bool, error)
+	// BlockTxCounts [start, end]里已入库的块记录的txns，以及每个高度实际入库的tx数量
+	BlockTxCounts(start uint64, end uint64) (map[uint64]int, map[uint64]int, error)
+
+	GetTx(hash string) (*Doc, error)
+	// ListTxs 按时间倒序分页，block和finality为空时不过滤
+	ListTxs(page Page, block string, finality string) (*SearchResult, error)
+	// ListTxsByAddress from或to是address的交易
+	ListTxsByAddress(address string, page Page) (*SearchResult, error)
+	// ListContractCreations 创建合约的交易
+	ListContractCreations(page Page) (*SearchResult, error)
+	// ListContractTxs 有日志的交易
+	ListContractTxs(page Page) (*SearchResult, error)
+
+	// ListInternalTxsByTx 交易里的内部调用，按调用顺序排列
+	ListInternalTxsByTx(hash string, page Page) (*SearchResult, error)
+	// ListInternalTxsByAddress from或to是address的内部调用，按时间倒序
+	ListInternalTxsByAddress(address string, page Page) (*SearchResult, error)
+
+	// ListTokenTransfersByToken 一个代币的转账，按高度和日志序号倒序
+	ListTokenTransfersByToken(token string, page Page) (*SearchResult, error)
+	// ListTokenTransfersByAddress from或to是address的代币转账
+	ListTokenTransfersByAddress(address string, page Page) (*SearchResult, error)
+	// ListTokenTransfersByTx 交易里的代币转账，按日志序号排列
+	ListTokenTransfersByTx(hash string, page Page) (*SearchResult, error)
+	// ListTokenTransfersByTokenId 一个nft的转账，也就是它的持有历史
+	ListTokenTransfersByTokenId(token string, tokenId string, page Page) (*SearchResult, error)
+
+	// ListNftInventory address当前持有的nft，最近变化的在前
+	ListNftInventory(address string, page Page) (*SearchResult, error)
+	// ListNftHolders 持有一个nft合约的地址，按持有的tokenId数量倒序，文档是ESNftHolder
+	ListNftHolders(token string, page Page) (*SearchResult, error)
+	// ListTokenHolders 一个代币的余额，按数量倒序
+	ListTokenHolders(token string, page Page) (*SearchResult, error)
+	// ListTokenBalances address持有的所有代币的余额，最近变化的在前
+	ListTokenBalances(address string, page Page) (*SearchResult, error)
+
+	// FindBalance address在number之前(含)最后一次记录的余额，没有记录时Found为false
+	FindBalance(address string, number uint64) (*Doc, error)
+	// ListBalances address的余额历史，按高度倒序
+	ListBalances(address string, page Page) (*SearchResult, error)
+
+	// GetAbi 读取合约上传的abi
+	GetAbi(address string) (*Doc, error)
+	// SaveAbi 保存合约的abi，已存在时覆盖
+	SaveAbi(contractAbi *ESAbi) error
+	// ListSignatures selector或topic0是id的签名，按签名倒序
+	ListSignatures(id string, page Page) (*SearchResult, error)
+	// SaveSignatures 保存通过接口添加的签名，已存在的签名覆盖
+	SaveSignatures(signatures []*ESSignature) error
+
+	GetAddress(address string) (*Doc, error)
+	ListAddresses(addresses []string) (*SearchResult, error)
+	UpdateAddressType(address string, _type uint8) error
+
+	// UpsertBlockBatch 写入一批块，先写tx和address最后写block，重复写入是幂等的
+	// block、tx和内部调用按链上的数据覆盖，重新同步可以修正旧数据；转账和地址已经存在时不覆盖，
+	// 新写入的转账会同时更新持有的余额，已经存在的转账不会重复计算
+	UpsertBlockBatch(batch *BlockBatch) error
+	// RemoveBlocks 删除孤块以及孤块里的交易、内部调用、代币转账、余额记录和新建的合约地址，回滚转账对余额的改变，返回删除的交易hash
+	RemoveBlocks(blocks []*ESBlock) ([]string, error)
+	// UpdateTxFees 更新已经写入的交易的手续费字段，不存在的交易忽略
+	UpdateTxFees(fees []*ESTxFee) error
+	// RebuildTokenBalances 按已经写入的全部转账重新计算代币余额，替换现有的余额，返回余额的数量。重建期间需要停止同步
+	RebuildTokenBalances() (int, error)
+	// SetFinality 把[start, end]高度的block和tx设置为finality
+	SetFinality(start uint64, end uint64, finality string) error
+
+	SaveReorg(reorg *ESReorg) error
+	ListReorgs(page Page) (*SearchResult, error)
+	ListReorgsByTx(hash string) (*SearchResult, error)
+
+	// GetCheckpoint 读取同步进度，没有同步过时返回nil
+	GetCheckpoint() (*ESCheckpoint, error)
+	SaveCheckpoint(checkpoint *ESCheckpoint) error
+	DeleteCheckpoint() error
+
+	SaveDeadLetter(deadLetter *ESDeadLetter) error
+	DeleteDeadLetters(numbers []uint64) error
+	ListDeadLetters(page Page) (*SearchResult, error)
+}
+
+// Repo 当前使用的存储后端
+var Repo Repository
+
+// STORAGE_BACKEND 存储后端，elasticsearch/postgres/embedded/memory，postgres需要设置POSTGRES_URL，memory只保存在内存里，用于测试
+// 没有设置STORAGE_BACKEND时，设置了ELASTICSEARCH_PATH用elasticsearch，否则用内嵌存储，只需要CHAIN_HTTP_URL就可以启动
+func InitStore() {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" && os.Getenv("ELASTICSEARCH_PATH") == "" {
+		backend = "embedded"
+	}
+	switch backend {
+	case "", "elasticsearch":
+		db.InitEsClient()
+		Repo = NewEsRepository(db.EsClient)
+	case "postgres":
+		db.InitPgClient()
+		Repo = NewPostgresRepository(db.PgClient)
+	case "embedded":
+		db.InitBoltClient()
+		Repo = NewEmbeddedRepository(db.BoltClient)
+	case "memory":
+		Repo = NewMemoryRepository()
+	default:
+		log.Fatalf("Unknown storage backend: %s", backend)
+	}
+}
+
+// Doc 按id读取的一个文档
+type Doc struct {
+	Index  string
+	Id     string
+	Found  bool
+	Source json.RawMessage
+}
+
+// SearchResult 列表查询的结果，Total是符合条件的总数，Relation为gte时表示总数超过了统计上限
+type SearchResult struct {
+	Total    int64
+	Relation string
+	Hits     []*Doc
+}
+
+// Page 分页参数
+type Page struct {
+	From int
+	Size int
+}
+
+// BlockBatch 一批块以及块里出现的地址
+type BlockBatch struct {
+	Blocks         []*ESBlock
+	Txs            []*ESTx
+	InternalTxs    []*ESInternalTx
+	TokenTransfers []*ESTokenTransfer
+	Balances       []*ESBalance
+	// 交易里出现的地址和新建的合约，已经存在的地址不会覆盖
+	Addresses []string
+	Contracts []string
+	// 新建的合约里探测到的代币，key是合约地址
+	Tokens map[string]*ESToken
+}
+
+// address 新地址的文档，合约带上探测到的代币信息和创建合约的块
+func (b *BlockBatch) address(address string, _type uint8) *ESAddress {
+	esAddress := &ESAddress{Address: address, Type: _type, Time: uint64(time.Now().Unix())}
+	if _type == AddressTypeContract {
+		esAddress.Token = b.Tokens[address]
+		esAddress.BlockHash = b.contractBlock(address)
+	}
+	return esAddress
+}
+
+// contractBlock 创建合约的交易或内部调用所在的块
+func (b *BlockBatch) contractBlock(contract string) string {
+	for _, esTx := range b.Txs {
+		if esTx.ContractAddress == contract {
+			return esTx.BlockHash
+		}
+	}
+	for _, internalTx := range b.InternalTxs {
+		if internalTx.IsCreate() && internalTx.To == contract {
+			return internalTx.BlockHash
+		}
+	}
+	return ""
+}
+
+// Error 存储后端返回的错误，Transient为true时可以重试
+type Error struct {
+	Msg       string
+	Status    int
+	Transient bool
+}
+
+func (e *Error) Error() string {
+	if e.Status != 0 {
+		return e.Msg + " status:" + strconv.Itoa(e.Status)
+	}
+	return e.Msg
+}
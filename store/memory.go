@@ -0,0 +1,853 @@
+package store
+
+import (
+	"encoding/json"
+	"explorer/db"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryRepository 把数据保存在内存里，不需要es就可以运行同步和接口，用于测试
+type memoryRepository struct {
+	mu             sync.RWMutex
+	blocks         map[uint64]*ESBlock
+	txs            map[string]*ESTx
+	internalTxs    map[string]*ESInternalTx
+	tokenTransfers map[string]*ESTokenTransfer
+	tokenBalances  map[string]*ESTokenBalance
+	balances       map[string]*ESBalance
+	abis           map[string]*ESAbi
+	signatures     map[string]*ESSignature
+	addresses      map[string]*ESAddress
+	reorgs         []*ESReorg
+	checkpoint     *ESCheckpoint
+	deadLetters    map[uint64]*ESDeadLetter
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		blocks:         map[uint64]*ESBlock{},
+		txs:            map[string]*ESTx{},
+		internalTxs:    map[string]*ESInternalTx{},
+		tokenTransfers: map[string]*ESTokenTransfer{},
+		tokenBalances:  map[string]*ESTokenBalance{},
+		balances:       map[string]*ESBalance{},
+		abis:           map[string]*ESAbi{},
+		signatures:     map[string]*ESSignature{},
+		addresses:      map[string]*ESAddress{},
+		deadLetters:    map[uint64]*ESDeadLetter{},
+	}
+}
+
+// memoryDoc 序列化成和es一样的文档
+func memoryDoc(index string, id string, source interface{}) (*Doc, error) {
+	buf, err := json.Marshal(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Doc{Index: index, Id: id, Found: true, Source: buf}, nil
+}
+
+// pageResult 取出一页，和es一样Total是全部的数量
+func pageResult(index string, ids []string, sources []interface{}, page *Page) (*SearchResult, error) {
+	start, end := 0, len(ids)
+	if page != nil {
+		start = page.From
+		if start < 0 {
+			start = 0
+		}
+		if start > end {
+			start = end
+		}
+		if page.Size >= 0 && start+page.Size < end {
+			end = start + page.Size
+		}
+	}
+	result := &SearchResult{
+		Total:    int64(len(ids)),
+		Relation: "eq",
+		Hits:     make([]*Doc, 0, end-start),
+	}
+	for i := start; i < end; i++ {
+		doc, err := memoryDoc(index, ids[i], sources[i])
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = append(result.Hits, doc)
+	}
+	return result, nil
+}
+
+// sortedTxs 按时间倒序过滤交易
+func (r *memoryRepository) sortedTxs(page *Page, match func(tx *ESTx) bool) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var txs []*ESTx
+	for _, tx := range r.txs {
+		if match(tx) {
+			txs = append(txs, tx)
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Time != txs[j].Time {
+			return txs[i].Time > txs[j].Time
+		}
+		if txs[i].Number != txs[j].Number {
+			a, _ := strconv.ParseUint(txs[i].Number, 10, 64)
+			b, _ := strconv.ParseUint(txs[j].Number, 10, 64)
+			return a > b
+		}
+		return txs[i].TransactionIndex > txs[j].TransactionIndex
+	})
+	ids := make([]string, 0, len(txs))
+	sources := make([]interface{}, 0, len(txs))
+	for _, tx := range txs {
+		ids = append(ids, tx.Hash)
+		sources = append(sources, tx)
+	}
+	return pageResult(db.TxIndex, ids, sources, page)
+}
+
+// sortedBlocks 按高度倒序过滤block
+func (r *memoryRepository) sortedBlocks(page *Page, match func(block *ESBlock) bool) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	numbers := make([]uint64, 0, len(r.blocks))
+	for number, block := range r.blocks {
+		if match(block) {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		return numbers[i] > numbers[j]
+	})
+	ids := make([]string, 0, len(numbers))
+	sources := make([]interface{}, 0, len(numbers))
+	for _, number := range numbers {
+		ids = append(ids, strconv.FormatUint(number, 10))
+		sources = append(sources, r.blocks[number])
+	}
+	return pageResult(db.BlockIndex, ids, sources, page)
+}
+
+// sortedReorgs 按时间倒序过滤重组记录
+func (r *memoryRepository) sortedReorgs(page *Page, match func(reorg *ESReorg) bool) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []string
+	var sources []interface{}
+	// reorgs按写入顺序保存，倒着遍历就是时间倒序
+	for i := len(r.reorgs) - 1; i >= 0; i-- {
+		if match(r.reorgs[i]) {
+			ids = append(ids, strconv.Itoa(i))
+			sources = append(sources, r.reorgs[i])
+		}
+	}
+	return pageResult(db.ReorgIndex, ids, sources, page)
+}
+
+func (r *memoryRepository) GetBlock(number string) (*Doc, error) {
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return &Doc{Index: db.BlockIndex, Id: number}, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	block, ok := r.blocks[n]
+	if !ok {
+		return &Doc{Index: db.BlockIndex, Id: number}, nil
+	}
+	return memoryDoc(db.BlockIndex, number, block)
+}
+
+func (r *memoryRepository) FindBlock(number uint64) (*ESBlock, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	block, ok := r.blocks[number]
+	if !ok {
+		return nil, nil
+	}
+	copied := *block
+	return &copied, nil
+}
+
+func (r *memoryRepository) ListBlocks(page Page, finality string) (*SearchResult, error) {
+	return r.sortedBlocks(&page, func(block *ESBlock) bool {
+		return finality == "" || block.Finality == finality
+	})
+}
+
+func (r *memoryRepository) ListBlocksByHash(hash string) (*SearchResult, error) {
+	return r.sortedBlocks(nil, func(block *ESBlock) bool {
+		return strings.EqualFold(block.BlockHash, hash)
+	})
+}
+
+func (r *memoryRepository) ListBlobBlocks(page Page, withBlobs bool) (*SearchResult, error) {
+	return r.sortedBlocks(&page, func(block *ESBlock) bool {
+		if withBlobs {
+			return block.BlobCount > 0
+		}
+		return block.ExcessBlobGas != ""
+	})
+}
+
+func (r *memoryRepository) LastBlockNumber() (uint64, bool, error) {
+	return r.lastBlock(func(block *ESBlock) bool {
+		return true
+	})
+}
+
+func (r *memoryRepository) LastFinalityNumber(finality string) (uint64, bool, error) {
+	return r.lastBlock(func(block *ESBlock) bool {
+		return block.Finality == finality
+	})
+}
+
+func (r *memoryRepository) lastBlock(match func(block *ESBlock) bool) (uint64, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var last uint64
+	ok := false
+	for number, block := range r.blocks {
+		if match(block) && (!ok || number > last) {
+			last, ok = number, true
+		}
+	}
+	return last, ok, nil
+}
+
+func (r *memoryRepository) BlockTxCounts(start uint64, end uint64) (map[uint64]int, map[uint64]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	txns := map[uint64]int{}
+	for i := start; i <= end; i++ {
+		if block, ok := r.blocks[i]; ok {
+			txns[i] = block.Txns
+		}
+	}
+	txCount := map[uint64]int{}
+	for _, tx := range r.txs {
+		number, err := strconv.ParseUint(tx.Number, 10, 64)
+		if err == nil && number >= start && number <= end {
+			txCount[number]++
+		}
+	}
+	return txns, txCount, nil
+}
+
+func (r *memoryRepository) GetTx(hash string) (*Doc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tx, ok := r.txs[hash]
+	if !ok {
+		return &Doc{Index: db.TxIndex, Id: hash}, nil
+	}
+	return memoryDoc(db.TxIndex, hash, tx)
+}
+
+func (r *memoryRepository) ListTxs(page Page, block string, finality string) (*SearchResult, error) {
+	return r.sortedTxs(&page, func(tx *ESTx) bool {
+		return (block == "" || tx.Number == block) && (finality == "" || tx.Finality == finality)
+	})
+}
+
+func (r *memoryRepository) ListTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.sortedTxs(&page, func(tx *ESTx) bool {
+		return strings.EqualFold(tx.From, address) || strings.EqualFold(tx.To, address)
+	})
+}
+
+func (r *memoryRepository) ListContractCreations(page Page) (*SearchResult, error) {
+	return r.sortedTxs(&page, func(tx *ESTx) bool {
+		return tx.ContractAddress != ""
+	})
+}
+
+func (r *memoryRepository) ListContractTxs(page Page) (*SearchResult, error) {
+	return r.sortedTxs(&page, func(tx *ESTx) bool {
+		return tx.LogLength > 0
+	})
+}
+
+// sortedInternalTxs 过滤内部调用，less决定排序
+func (r *memoryRepository) sortedInternalTxs(page *Page, match func(internalTx *ESInternalTx) bool, less func(a, b *ESInternalTx) bool) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var internalTxs []*ESInternalTx
+	for _, internalTx := range r.internalTxs {
+		if match(internalTx) {
+			internalTxs = append(internalTxs, internalTx)
+		}
+	}
+	sort.Slice(internalTxs, func(i, j int) bool {
+		return less(internalTxs[i], internalTxs[j])
+	})
+	ids := make([]string, 0, len(internalTxs))
+	sources := make([]interface{}, 0, len(internalTxs))
+	for _, internalTx := range internalTxs {
+		ids = append(ids, internalTx.Id)
+		sources = append(sources, internalTx)
+	}
+	return pageResult(db.InternalTxIndex, ids, sources, page)
+}
+
+func (r *memoryRepository) ListInternalTxsByTx(hash string, page Page) (*SearchResult, error) {
+	return r.sortedInternalTxs(&page, func(internalTx *ESInternalTx) bool {
+		return strings.EqualFold(internalTx.TxHash, hash)
+	}, func(a, b *ESInternalTx) bool {
+		return a.Index < b.Index
+	})
+}
+
+func (r *memoryRepository) ListInternalTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.sortedInternalTxs(&page, func(internalTx *ESInternalTx) bool {
+		return strings.EqualFold(internalTx.From, address) || strings.EqualFold(internalTx.To, address)
+	}, func(a, b *ESInternalTx) bool {
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		if a.Number != b.Number {
+			x, _ := strconv.ParseUint(a.Number, 10, 64)
+			y, _ := strconv.ParseUint(b.Number, 10, 64)
+			return x > y
+		}
+		if a.TransactionIndex != b.TransactionIndex {
+			return a.TransactionIndex > b.TransactionIndex
+		}
+		return a.Index > b.Index
+	})
+}
+
+// sortedTokenTransfers 过滤代币转账，desc为true时按高度和日志序号倒序，否则正序
+func (r *memoryRepository) sortedTokenTransfers(page *Page, desc bool, match func(transfer *ESTokenTransfer) bool) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var transfers []*ESTokenTransfer
+	for _, transfer := range r.tokenTransfers {
+		if match(transfer) {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := transfers[i], transfers[j]
+		if desc {
+			a, b = b, a
+		}
+		if a.Number != b.Number {
+			x, _ := strconv.ParseUint(a.Number, 10, 64)
+			y, _ := strconv.ParseUint(b.Number, 10, 64)
+			return x < y
+		}
+		if a.LogIndex != b.LogIndex {
+			return a.LogIndex < b.LogIndex
+		}
+		return a.BatchIndex < b.BatchIndex
+	})
+	ids := make([]string, 0, len(transfers))
+	sources := make([]interface{}, 0, len(transfers))
+	for _, transfer := range transfers {
+		ids = append(ids, transfer.Id)
+		sources = append(sources, transfer)
+	}
+	return pageResult(db.TokenTransferIndex, ids, sources, page)
+}
+
+func (r *memoryRepository) ListTokenTransfersByToken(token string, page Page) (*SearchResult, error) {
+	return r.sortedTokenTransfers(&page, true, func(transfer *ESTokenTransfer) bool {
+		return strings.EqualFold(transfer.Token, token)
+	})
+}
+
+func (r *memoryRepository) ListTokenTransfersByAddress(address string, page Page) (*SearchResult, error) {
+	return r.sortedTokenTransfers(&page, true, func(transfer *ESTokenTransfer) bool {
+		return strings.EqualFold(transfer.From, address) || strings.EqualFold(transfer.To, address)
+	})
+}
+
+func (r *memoryRepository) ListTokenTransfersByTx(hash string, page Page) (*SearchResult, error) {
+	return r.sortedTokenTransfers(&page, false, func(transfer *ESTokenTransfer) bool {
+		return strings.EqualFold(transfer.TxHash, hash)
+	})
+}
+
+func (r *memoryRepository) ListTokenTransfersByTokenId(token string, tokenId string, page Page) (*SearchResult, error) {
+	return r.sortedTokenTransfers(&page, true, func(transfer *ESTokenTransfer) bool {
+		return strings.EqualFold(transfer.Token, token) && transfer.TokenId == tokenId
+	})
+}
+
+// sortedTokenBalances 过滤余额，compare返回正数时a排在前面，相同时按id排列。数量不是正数的余额不返回
+func (r *memoryRepository) sortedTokenBalances(page *Page, match func(balance *ESTokenBalance) bool, compare func(a, b *ESTokenBalance) int) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var balances []*ESTokenBalance
+	for _, balance := range r.tokenBalances {
+		if compareAmount(balance.Amount, "0") > 0 && match(balance) {
+			balances = append(balances, balance)
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if c := compare(balances[i], balances[j]); c != 0 {
+			return c > 0
+		}
+		return balances[i].Id < balances[j].Id
+	})
+	ids := make([]string, 0, len(balances))
+	sources := make([]interface{}, 0, len(balances))
+	for _, balance := range balances {
+		ids = append(ids, balance.Id)
+		sources = append(sources, balance)
+	}
+	return pageResult(db.TokenBalanceIndex, ids, sources, page)
+}
+
+func compareBalanceNumber(a, b *ESTokenBalance) int {
+	return compareNumber(a.Number, b.Number)
+}
+
+func (r *memoryRepository) ListNftInventory(address string, page Page) (*SearchResult, error) {
+	return r.sortedTokenBalances(&page, func(balance *ESTokenBalance) bool {
+		return strings.EqualFold(balance.Holder, address) && isNft(balance.Standard)
+	}, compareBalanceNumber)
+}
+
+func (r *memoryRepository) ListTokenHolders(token string, page Page) (*SearchResult, error) {
+	return r.sortedTokenBalances(&page, func(balance *ESTokenBalance) bool {
+		return strings.EqualFold(balance.Token, token)
+	}, func(a, b *ESTokenBalance) int {
+		return compareAmount(a.Amount, b.Amount)
+	})
+}
+
+func (r *memoryRepository) ListTokenBalances(address string, page Page) (*SearchResult, error) {
+	return r.sortedTokenBalances(&page, func(balance *ESTokenBalance) bool {
+		return strings.EqualFold(balance.Holder, address)
+	}, compareBalanceNumber)
+}
+
+func (r *memoryRepository) ListNftHolders(token string, page Page) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	holderMap := map[string]*ESNftHolder{}
+	var holders []*ESNftHolder
+	for _, balance := range r.tokenBalances {
+		if !strings.EqualFold(balance.Token, token) || compareAmount(balance.Amount, "0") <= 0 {
+			continue
+		}
+		key := strings.ToLower(balance.Holder)
+		holder, ok := holderMap[key]
+		if !ok {
+			holder = &ESNftHolder{Token: balance.Token, Holder: balance.Holder}
+			holderMap[key] = holder
+			holders = append(holders, holder)
+		}
+		holder.Tokens++
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Tokens != holders[j].Tokens {
+			return holders[i].Tokens > holders[j].Tokens
+		}
+		return strings.ToLower(holders[i].Holder) < strings.ToLower(holders[j].Holder)
+	})
+	ids := make([]string, 0, len(holders))
+	sources := make([]interface{}, 0, len(holders))
+	for _, holder := range holders {
+		ids = append(ids, holder.Holder)
+		sources = append(sources, holder)
+	}
+	return pageResult(db.TokenBalanceIndex, ids, sources, &page)
+}
+
+// applyBalances 把改变加到余额上，调用方持有写锁
+func (r *memoryRepository) applyBalances(transfers []*ESTokenTransfer, revert bool) error {
+	deltas, err := balanceDeltas(transfers, revert)
+	if err != nil {
+		return err
+	}
+	for _, delta := range deltas {
+		balance, ok := r.tokenBalances[delta.Id]
+		if !ok {
+			balance = newBalance(delta)
+		}
+		isZero, err := balance.apply(delta)
+		if err != nil {
+			return err
+		}
+		if isZero {
+			delete(r.tokenBalances, delta.Id)
+		} else {
+			r.tokenBalances[delta.Id] = balance
+		}
+	}
+	return nil
+}
+
+// sortedBalances address的余额记录，按高度倒序
+func (r *memoryRepository) sortedBalances(address string) []*ESBalance {
+	var balances []*ESBalance
+	for _, balance := range r.balances {
+		if strings.EqualFold(balance.Address, address) {
+			balances = append(balances, balance)
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return compareNumber(balances[i].Number, balances[j].Number) > 0
+	})
+	return balances
+}
+
+func (r *memoryRepository) FindBalance(address string, number uint64) (*Doc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, balance := range r.sortedBalances(address) {
+		n, err := strconv.ParseUint(balance.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n <= number {
+			return memoryDoc(db.BalanceIndex, balance.Id, balance)
+		}
+	}
+	return &Doc{Index: db.BalanceIndex, Id: address}, nil
+}
+
+func (r *memoryRepository) ListBalances(address string, page Page) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	balances := r.sortedBalances(address)
+	ids := make([]string, 0, len(balances))
+	sources := make([]interface{}, 0, len(balances))
+	for _, balance := range balances {
+		ids = append(ids, balance.Id)
+		sources = append(sources, balance)
+	}
+	return pageResult(db.BalanceIndex, ids, sources, &page)
+}
+
+func (r *memoryRepository) GetAbi(address string) (*Doc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	address = strings.ToLower(address)
+	contractAbi, ok := r.abis[address]
+	if !ok {
+		return &Doc{Index: db.AbiIndex, Id: address}, nil
+	}
+	return memoryDoc(db.AbiIndex, address, contractAbi)
+}
+
+func (r *memoryRepository) SaveAbi(contractAbi *ESAbi) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *contractAbi
+	r.abis[strings.ToLower(contractAbi.Address)] = &copied
+	return nil
+}
+
+func (r *memoryRepository) ListSignatures(id string, page Page) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var signatures []*ESSignature
+	for _, signature := range r.signatures {
+		if strings.EqualFold(signature.Selector, id) || strings.EqualFold(signature.Topic, id) {
+			signatures = append(signatures, signature)
+		}
+	}
+	sort.Slice(signatures, func(i, j int) bool {
+		return signatures[i].Signature > signatures[j].Signature
+	})
+	ids := make([]string, 0, len(signatures))
+	sources := make([]interface{}, 0, len(signatures))
+	for _, signature := range signatures {
+		ids = append(ids, signature.Signature)
+		sources = append(sources, signature)
+	}
+	return pageResult(db.SignatureIndex, ids, sources, &page)
+}
+
+func (r *memoryRepository) SaveSignatures(signatures []*ESSignature) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, signature := range signatures {
+		copied := *signature
+		r.signatures[signature.Signature] = &copied
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetAddress(address string) (*Doc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	esAddress, ok := r.addresses[address]
+	if !ok {
+		return &Doc{Index: db.AddressIndex, Id: address}, nil
+	}
+	return memoryDoc(db.AddressIndex, address, esAddress)
+}
+
+func (r *memoryRepository) ListAddresses(addresses []string) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []string
+	var sources []interface{}
+	for _, address := range addresses {
+		if esAddress, ok := r.addresses[address]; ok {
+			ids = append(ids, address)
+			sources = append(sources, esAddress)
+		}
+	}
+	return pageResult(db.AddressIndex, ids, sources, nil)
+}
+
+func (r *memoryRepository) UpdateAddressType(address string, _type uint8) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	esAddress, ok := r.addresses[address]
+	if !ok {
+		return &Error{Msg: "address不存在:" + address, Status: 404}
+	}
+	esAddress.Type = _type
+	return nil
+}
+
+func (r *memoryRepository) UpsertBlockBatch(batch *BlockBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tx := range batch.Txs {
+		copied := *tx
+		r.txs[tx.Hash] = &copied
+	}
+	for _, internalTx := range batch.InternalTxs {
+		copied := *internalTx
+		r.internalTxs[internalTx.Id] = &copied
+	}
+	var newTransfers []*ESTokenTransfer
+	for _, transfer := range batch.TokenTransfers {
+		if _, ok := r.tokenTransfers[transfer.Id]; !ok {
+			copied := *transfer
+			r.tokenTransfers[transfer.Id] = &copied
+			newTransfers = append(newTransfers, &copied)
+		}
+	}
+	err := r.applyBalances(newTransfers, false)
+	if err != nil {
+		return err
+	}
+	for _, balance := range batch.Balances {
+		copied := *balance
+		r.balances[balance.Id] = &copied
+	}
+	for _, contract := range batch.Contracts {
+		if _, ok := r.addresses[contract]; !ok {
+			r.addresses[contract] = batch.address(contract, AddressTypeContract)
+		}
+	}
+	for _, address := range batch.Addresses {
+		if _, ok := r.addresses[address]; !ok {
+			r.addresses[address] = batch.address(address, AddressTypeAccount)
+		}
+	}
+	for _, block := range batch.Blocks {
+		number, err := strconv.ParseUint(block.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		copied := *block
+		r.blocks[number] = &copied
+	}
+	return nil
+}
+
+func (r *memoryRepository) RemoveBlocks(blocks []*ESBlock) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hashes := map[string]bool{}
+	for _, block := range blocks {
+		hashes[strings.ToLower(block.BlockHash)] = true
+		number, err := strconv.ParseUint(block.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		delete(r.blocks, number)
+	}
+	txHashes := []string{}
+	for hash, tx := range r.txs {
+		if !hashes[strings.ToLower(tx.BlockHash)] {
+			continue
+		}
+		txHashes = append(txHashes, hash)
+		delete(r.txs, hash)
+		if tx.ContractAddress != "" {
+			delete(r.addresses, tx.ContractAddress)
+		}
+	}
+	for id, internalTx := range r.internalTxs {
+		if !hashes[strings.ToLower(internalTx.BlockHash)] {
+			continue
+		}
+		delete(r.internalTxs, id)
+		if internalTx.IsCreate() {
+			delete(r.addresses, internalTx.To)
+		}
+	}
+	for id, balance := range r.balances {
+		if hashes[strings.ToLower(balance.BlockHash)] {
+			delete(r.balances, id)
+		}
+	}
+	var removed []*ESTokenTransfer
+	for id, transfer := range r.tokenTransfers {
+		if hashes[strings.ToLower(transfer.BlockHash)] {
+			removed = append(removed, transfer)
+			delete(r.tokenTransfers, id)
+		}
+	}
+	err := r.applyBalances(removed, true)
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+func (r *memoryRepository) RebuildTokenBalances() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	balances, err := rebuildBalances(func(add func(transfer *ESTokenTransfer) error) error {
+		for _, transfer := range r.tokenTransfers {
+			err := add(transfer)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.tokenBalances = make(map[string]*ESTokenBalance, len(balances))
+	for _, balance := range balances {
+		r.tokenBalances[balance.Id] = balance
+	}
+	return len(balances), nil
+}
+
+func (r *memoryRepository) UpdateTxFees(fees []*ESTxFee) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, fee := range fees {
+		tx, ok := r.txs[fee.Hash]
+		if ok {
+			tx.SetFee(fee)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) SetFinality(start uint64, end uint64, finality string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for number, block := range r.blocks {
+		if number >= start && number <= end {
+			block.Finality = finality
+		}
+	}
+	for _, tx := range r.txs {
+		number, err := strconv.ParseUint(tx.Number, 10, 64)
+		if err == nil && number >= start && number <= end {
+			tx.Finality = finality
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) SaveReorg(reorg *ESReorg) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *reorg
+	r.reorgs = append(r.reorgs, &copied)
+	return nil
+}
+
+func (r *memoryRepository) ListReorgs(page Page) (*SearchResult, error) {
+	return r.sortedReorgs(&page, func(reorg *ESReorg) bool {
+		return true
+	})
+}
+
+func (r *memoryRepository) ListReorgsByTx(hash string) (*SearchResult, error) {
+	return r.sortedReorgs(nil, func(reorg *ESReorg) bool {
+		for _, txHash := range reorg.TxHashes {
+			if strings.EqualFold(txHash, hash) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *memoryRepository) GetCheckpoint() (*ESCheckpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.checkpoint == nil {
+		return nil, nil
+	}
+	copied := *r.checkpoint
+	return &copied, nil
+}
+
+func (r *memoryRepository) SaveCheckpoint(checkpoint *ESCheckpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *checkpoint
+	r.checkpoint = &copied
+	return nil
+}
+
+func (r *memoryRepository) DeleteCheckpoint() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkpoint = nil
+	return nil
+}
+
+func (r *memoryRepository) SaveDeadLetter(deadLetter *ESDeadLetter) error {
+	number, err := strconv.ParseUint(deadLetter.Number, 10, 64)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *deadLetter
+	r.deadLetters[number] = &copied
+	return nil
+}
+
+func (r *memoryRepository) DeleteDeadLetters(numbers []uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, number := range numbers {
+		delete(r.deadLetters, number)
+	}
+	return nil
+}
+
+func (r *memoryRepository) ListDeadLetters(page Page) (*SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	deadLetters := make([]*ESDeadLetter, 0, len(r.deadLetters))
+	for _, deadLetter := range r.deadLetters {
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].Time > deadLetters[j].Time
+	})
+	ids := make([]string, 0, len(deadLetters))
+	sources := make([]interface{}, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		ids = append(ids, deadLetter.Number)
+		sources = append(sources, deadLetter)
+	}
+	return pageResult(db.DeadLetterIndex, ids, sources, &page)
+}
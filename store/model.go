@@ -0,0 +1,330 @@
+package store
+
+import "github.com/ethereum/go-ethereum/core/types"
+
+// 地址的类型
+const (
+	AddressTypeAccount  uint8 = 1
+	AddressTypeContract uint8 = 2
+)
+
+type ESBlock struct {
+	ParentHash  string      `json:"parentHash"`
+	UncleHash   string      `json:"sha3Uncles"`
+	Coinbase    string      `json:"miner"`
+	Root        string      `json:"stateRoot"`
+	TxHash      string      `json:"transactionsRoot"`
+	ReceiptHash string      `json:"receiptsRoot"`
+	Bloom       types.Bloom `json:"logsBloom"`
+	Difficulty  string      `json:"difficulty"`
+	Number      string      `json:"number"`
+	GasLimit    string      `json:"gasLimit"`
+	GasUsed     string      `json:"gasUsed"`
+	Time        uint64      `json:"timestamp"`
+	Extra       []byte      `json:"extraData"`
+	MixDigest   string      `json:"mixHash"`
+	Nonce       uint64      `json:"nonce"`
+
+	// BaseFee was added by EIP-1559 and is ignored in legacy headers.
+	BaseFee string `json:"baseFeePerGas" rlp:"optional"`
+
+	Txns      int    `json:"txns"`
+	BlockHash string `json:"blockHash"`
+	Size      string `json:"size"`
+	BurntFees string `json:"burntFees"`
+	// pending/safe/finalized
+	Finality string `json:"finality"`
+
+	// 4844 块里的blob数量、消耗的blob gas和blob gas价格，坎昆升级之前的块没有这些字段，没有blob时不返回blobCount
+	BlobCount     int    `json:"blobCount,omitempty"`
+	BlobGasUsed   string `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas string `json:"excessBlobGas,omitempty"`
+	BlobGasPrice  string `json:"blobGasPrice,omitempty"`
+}
+
+type ESTx struct {
+	Type       byte             `json:"type"`
+	Nonce      string           `json:"nonce"`
+	GasPrice   string           `json:"gasPrice"`
+	GasTipCap  string           `json:"maxPriorityFeePerGas"`
+	GasFeeCap  string           `json:"maxFeePerGas"`
+	Gas        string           `json:"gasLimit"`
+	Value      string           `json:"value"`
+	Data       []byte           `json:"input"`
+	Number     string           `json:"number"`
+	V          string           `json:"v"`
+	R          string           `json:"r"`
+	S          string           `json:"s"`
+	To         string           `json:"to"`
+	MethodId   string           `json:"methodId"`
+	MethodName string           `json:"methodName"`
+	Hash       string           `json:"hash"`
+	Time       uint64           `json:"timestamp"`
+	From       string           `json:"from"`
+	AccessList types.AccessList `json:"accessList"`
+	IsFake     bool             `json:"isFake"`
+	BaseFee    string           `json:"baseFeePerGas" rlp:"optional"`
+
+	// 4844 blob交易愿意支付的blob gas价格上限和blob的versioned hash
+	MaxFeePerBlobGas    string   `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes []string `json:"blobVersionedHashes,omitempty"`
+
+	// receipt
+	ReceiptType       uint8        `json:"receiptType"`
+	PostState         []byte       `json:"postState"`
+	Status            string       `json:"status"`
+	CumulativeGasUsed string       `json:"cumulativeGasUsed"`
+	Bloom             types.Bloom  `json:"logsBloom"`
+	Logs              []*types.Log `json:"logs"`
+	LogLength         uint64       `json:"logLength"`
+
+	// Implementation fields: These fields are added by geth when processing a transaction.
+	// They are stored in the chain database.
+	TxHash          string `json:"transactionHash"`
+	ContractAddress string `json:"contractAddress"`
+	GasUsed         string `json:"gasUsed"`
+
+	// Inclusion information: These fields provide information about the inclusion of the
+	// transaction corresponding to this receipt.
+	BlockHash        string `json:"blockHash"`
+	BlockNumber      string `json:"blockNumber"`
+	TransactionIndex uint   `json:"transactionIndex"`
+	TransactionFee   string `json:"transactionFee"`
+	// 实际的gas价格，1559交易是min(maxFeePerGas, baseFee+maxPriorityFeePerGas)
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	// 1559
+	BurntFees    string `json:"burntFees"`
+	TxSavingsFee string `json:"txSavingsFee"`
+	// 4844 blob交易消耗的blob gas和价格，blob费用全部燃烧
+	BlobGasUsed  string `json:"blobGasUsed,omitempty"`
+	BlobGasPrice string `json:"blobGasPrice,omitempty"`
+	BlobFee      string `json:"blobFee,omitempty"`
+
+	Reason string `json:"reason"`
+	// 失败交易解析后的revert数据
+	Revert *ESRevert `json:"revert,omitempty"`
+	// pending/safe/finalized
+	Finality string `json:"finality"`
+}
+
+// ESTxFee 交易的手续费字段，重新计算手续费时只更新这些字段
+type ESTxFee struct {
+	Hash              string `json:"-"`
+	TransactionFee    string `json:"transactionFee"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	BurntFees         string `json:"burntFees"`
+	TxSavingsFee      string `json:"txSavingsFee"`
+	BlobFee           string `json:"blobFee,omitempty"`
+}
+
+// Fee 交易当前的手续费字段
+func (t *ESTx) Fee() *ESTxFee {
+	return &ESTxFee{
+		Hash:              t.Hash,
+		TransactionFee:    t.TransactionFee,
+		EffectiveGasPrice: t.EffectiveGasPrice,
+		BurntFees:         t.BurntFees,
+		TxSavingsFee:      t.TxSavingsFee,
+		BlobFee:           t.BlobFee,
+	}
+}
+
+// SetFee 更新交易的手续费字段
+func (t *ESTx) SetFee(fee *ESTxFee) {
+	t.TransactionFee = fee.TransactionFee
+	t.EffectiveGasPrice = fee.EffectiveGasPrice
+	t.BurntFees = fee.BurntFees
+	t.TxSavingsFee = fee.TxSavingsFee
+	t.BlobFee = fee.BlobFee
+}
+
+// 失败交易revert的类型
+const (
+	// Error(string)
+	RevertKindError = "error"
+	// Panic(uint256)，message是panic code的含义
+	RevertKindPanic = "panic"
+	// 合约abi或签名库里的自定义错误
+	RevertKindCustom = "custom"
+	// 没有revert数据，例如out of gas或者直接revert()，message是节点返回的错误
+	RevertKindEmpty = "empty"
+	// 有revert数据但无法解析
+	RevertKindUnknown = "unknown"
+)
+
+// ESRevert 失败交易重放得到的revert数据
+type ESRevert struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	// revert数据的前4个字节
+	Selector  string   `json:"selector"`
+	Signature string   `json:"signature"`
+	Args      []*ESArg `json:"args"`
+	// 自定义错误是按签名库猜测的
+	Guessed bool `json:"guessed"`
+	// revert的原始数据
+	Data string `json:"data"`
+}
+
+// ESArg 按abi解析出的一个参数，整数和bytes都转成字符串，避免前端丢失精度
+type ESArg struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// ESInternalTx 交易里合约发起的内部调用，由trace得到，不包括交易本身的最外层调用
+type ESInternalTx struct {
+	// 交易hash加上调用顺序
+	Id               string `json:"id"`
+	TxHash           string `json:"transactionHash"`
+	BlockHash        string `json:"blockHash"`
+	Number           string `json:"number"`
+	Time             uint64 `json:"timestamp"`
+	TransactionIndex uint   `json:"transactionIndex"`
+	// 在交易里的调用顺序，从1开始
+	Index        int   `json:"index"`
+	TraceAddress []int `json:"traceAddress"`
+	Depth        int   `json:"depth"`
+	// CALL/DELEGATECALL/STATICCALL/CALLCODE/CREATE/CREATE2/SELFDESTRUCT
+	Type    string `json:"type"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Value   string `json:"value"`
+	Gas     string `json:"gas"`
+	GasUsed string `json:"gasUsed"`
+	// 调用失败的原因，父调用(包括交易本身)失败时子调用的修改也被回滚，继承父调用的错误
+	Error string `json:"error"`
+}
+
+// IsCreate 成功创建合约的内部调用，To是新合约的地址
+func (t *ESInternalTx) IsCreate() bool {
+	return (t.Type == "CREATE" || t.Type == "CREATE2") && t.Error == "" && t.To != ""
+}
+
+// 代币标准
+const (
+	TokenStandardERC20   = "erc20"
+	TokenStandardERC721  = "erc721"
+	TokenStandardERC1155 = "erc1155"
+)
+
+// ESTokenTransfer 从日志解析出的代币转账
+type ESTokenTransfer struct {
+	// 交易hash加上日志序号，erc1155批量转账再加上在批量里的序号
+	Id string `json:"id"`
+	// erc20/erc721/erc1155
+	Standard string `json:"standard"`
+	// 代币合约地址
+	Token string `json:"token"`
+	// nft的tokenId，erc20为空
+	TokenId string `json:"tokenId"`
+	// erc1155的operator
+	Operator         string `json:"operator"`
+	From             string `json:"from"`
+	To               string `json:"to"`
+	Amount           string `json:"amount"`
+	TxHash           string `json:"transactionHash"`
+	LogIndex         uint   `json:"logIndex"`
+	BatchIndex       int    `json:"batchIndex"`
+	BlockHash        string `json:"blockHash"`
+	Number           string `json:"number"`
+	Time             uint64 `json:"timestamp"`
+	TransactionIndex uint   `json:"transactionIndex"`
+}
+
+// ESTokenBalance 一个地址持有的某个代币的数量，nft按tokenId分别记录，数量为0时删除
+type ESTokenBalance struct {
+	Id       string `json:"id"`
+	Standard string `json:"standard"`
+	Token    string `json:"token"`
+	TokenId  string `json:"tokenId"`
+	Holder   string `json:"holder"`
+	Amount   string `json:"amount"`
+	// 最后一次变化的高度，回滚时重新创建的余额没有高度
+	Number string `json:"number,omitempty"`
+}
+
+// ESNftHolder 持有一个nft合约的地址以及持有的tokenId数量
+type ESNftHolder struct {
+	Token  string `json:"token"`
+	Holder string `json:"holder"`
+	Tokens int64  `json:"tokens"`
+}
+
+// ESBalance 地址在一个块之后的原生币余额，只在地址出现的块记录
+type ESBalance struct {
+	// 小写地址加上高度
+	Id        string `json:"id"`
+	Address   string `json:"address"`
+	Balance   string `json:"balance"`
+	BlockHash string `json:"blockHash"`
+	Number    string `json:"number"`
+	Time      uint64 `json:"timestamp"`
+}
+
+// ESAbi 通过接口上传的合约abi，abi是json原文
+type ESAbi struct {
+	Address string `json:"address"`
+	Abi     string `json:"abi"`
+	// 上传时间
+	Time uint64 `json:"timestamp"`
+}
+
+// ESSignature 通过接口添加的方法或事件签名，同一个签名同时按4字节selector和topic0查找
+type ESSignature struct {
+	Signature string `json:"signature"`
+	Selector  string `json:"selector"`
+	Topic     string `json:"topic"`
+	// 添加时间
+	Time uint64 `json:"timestamp"`
+}
+
+type ESAddress struct {
+	Address string `json:"address"`
+	Type    uint8  `json:"type"`
+	// 合约创建时探测到的代币信息，不是代币时为空
+	Token *ESToken `json:"token,omitempty"`
+	// 创建合约的块，回滚时合约地址随块一起删除，普通地址为空
+	BlockHash string `json:"blockHash,omitempty"`
+	// 写入时间，迁移时按这个追赶新写入的地址
+	Time uint64 `json:"timestamp"`
+}
+
+// ESToken 通过eth_call读取的代币信息，合约没有实现的方法对应的字段为空
+type ESToken struct {
+	// erc20/erc721/erc1155
+	Standard    string `json:"standard"`
+	Name        string `json:"name,omitempty"`
+	Symbol      string `json:"symbol,omitempty"`
+	Decimals    *uint8 `json:"decimals,omitempty"`
+	TotalSupply string `json:"totalSupply,omitempty"`
+}
+
+// ESReorg 一次区块重组的记录，前端用来展示被回滚的交易
+type ESReorg struct {
+	// 共同祖先的高度
+	Number    string   `json:"number"`
+	Depth     int      `json:"depth"`
+	OldHashes []string `json:"oldHashes"`
+	TxHashes  []string `json:"txHashes"`
+	Time      uint64   `json:"timestamp"`
+}
+
+// ESCheckpoint 最后一个block、tx、address都写入成功的块
+type ESCheckpoint struct {
+	Number    string `json:"number"`
+	BlockHash string `json:"blockHash"`
+	// 写入时间
+	Time uint64 `json:"timestamp"`
+	// 后台校验下一个需要检查的高度，重启后从这里继续校验
+	VerifiedTo string `json:"verifiedTo,omitempty"`
+}
+
+// ESDeadLetter 多次重试仍然失败的块，校验任务会再次尝试同步
+type ESDeadLetter struct {
+	Number   string `json:"number"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	Time     uint64 `json:"timestamp"`
+}
@@ -0,0 +1,349 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"explorer/db"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// 和es的track_total_hits一样，总数超过这个值时只返回下限
+const pgTotalLimit = 10000
+
+// postgresRepository 用postgres存储，表结构见db/migrations
+type postgresRepository struct {
+	client *sql.DB
+}
+
+func NewPostgresRepository(client *sql.DB) Repository {
+	return &postgresRepository{client: client}
+}
+
+// pgError 连接断开、死锁、资源不足等错误可以重试
+func pgError(msg string, err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code.Class() {
+	case "08", "40", "53", "57":
+		return &Error{Msg: msg + ":" + pqErr.Message, Transient: true}
+	}
+	return &Error{Msg: msg + ":" + pqErr.Message}
+}
+
+// get 读取一行的doc，不存在时Found为false
+func (r *postgresRepository) get(index string, id string, query string, args ...interface{}) (*Doc, error) {
+	var source []byte
+	err := r.client.QueryRow(query, args...).Scan(&source)
+	if err == sql.ErrNoRows {
+		return &Doc{Index: index, Id: id}, nil
+	}
+	if err != nil {
+		return nil, pgError("postgres读取"+index+"出错", err)
+	}
+	return &Doc{Index: index, Id: id, Found: true, Source: source}, nil
+}
+
+// search 查询id和doc两列，where为空时不过滤，page为nil时和es一样只返回前10条
+func (r *postgresRepository) search(index string, table string, where string, order string, page *Page, args ...interface{}) (*SearchResult, error) {
+	if page == nil {
+		page = &Page{Size: 10}
+	}
+	if where != "" {
+		where = " WHERE " + where
+	}
+	var total int64
+	countQuery := "SELECT count(*) FROM (SELECT 1 FROM " + table + where + " LIMIT " + strconv.Itoa(pgTotalLimit+1) + ") t"
+	err := r.client.QueryRow(countQuery, args...).Scan(&total)
+	if err != nil {
+		return nil, pgError("postgres查询"+index+"出错", err)
+	}
+	result := &SearchResult{Total: total, Relation: "eq", Hits: []*Doc{}}
+	if total > pgTotalLimit {
+		result.Total, result.Relation = pgTotalLimit, "gte"
+	}
+	n := len(args)
+	query := "SELECT " + pgIdColumn(table) + ", doc FROM " + table + where +
+		" ORDER BY " + order + " LIMIT $" + strconv.Itoa(n+1) + " OFFSET $" + strconv.Itoa(n+2)
+	rows, err := r.client.Query(query, append(args, page.Size, page.From)...)
+	if err != nil {
+		return nil, pgError("postgres查询"+index+"出错", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		doc := &Doc{Index: index, Found: true}
+		var source []byte
+		err = rows.Scan(&doc.Id, &source)
+		if err != nil {
+			return nil, err
+		}
+		doc.Source = source
+		result.Hits = append(result.Hits, doc)
+	}
+	return result, rows.Err()
+}
+
+// pgIdColumn 各个表作为文档id的列
+func pgIdColumn(table string) string {
+	switch table {
+	case "blocks", "dead_letters":
+		return "number::text"
+	case "txs":
+		return "hash"
+	case "addresses":
+		return "address"
+	case "signatures":
+		return "signature"
+	case "internal_txs", "token_transfers", "token_balances", "balances":
+		return "id"
+	}
+	return "id::text"
+}
+
+// lastNumber 查询一个高度，没有结果时返回false
+func (r *postgresRepository) lastNumber(query string, args ...interface{}) (uint64, bool, error) {
+	var number int64
+	err := r.client.QueryRow(query, args...).Scan(&number)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, pgError("postgres查询block出错", err)
+	}
+	return uint64(number), true, nil
+}
+
+func (r *postgresRepository) GetBlock(number string) (*Doc, error) {
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return &Doc{Index: db.BlockIndex, Id: number}, nil
+	}
+	return r.get(db.BlockIndex, number, `SELECT doc FROM blocks WHERE number = $1`, n)
+}
+
+func (r *postgresRepository) FindBlock(number uint64) (*ESBlock, error) {
+	doc, err := r.get(db.BlockIndex, "", `SELECT doc FROM blocks WHERE number = $1`, int64(number))
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	block := new(ESBlock)
+	err = json.Unmarshal(doc.Source, block)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (r *postgresRepository) ListBlocks(page Page, finality string) (*SearchResult, error) {
+	if finality != "" {
+		return r.search(db.BlockIndex, "blocks", "finality = $1", "number DESC", &page, finality)
+	}
+	return r.search(db.BlockIndex, "blocks", "", "number DESC", &page)
+}
+
+func (r *postgresRepository) ListBlocksByHash(hash string) (*SearchResult, error) {
+	return r.search(db.BlockIndex, "blocks", "hash = $1", "number DESC", nil, strings.ToLower(hash))
+}
+
+// ListBlobBlocks 没有blob的块不保存blobCount，坎昆升级之前的块没有excessBlobGas
+func (r *postgresRepository) ListBlobBlocks(page Page, withBlobs bool) (*SearchResult, error) {
+	if withBlobs {
+		return r.search(db.BlockIndex, "blocks", "doc ? 'blobCount'", "number DESC", &page)
+	}
+	return r.search(db.BlockIndex, "blocks", "doc ? 'excessBlobGas'", "number DESC", &page)
+}
+
+func (r *postgresRepository) LastBlockNumber() (uint64, bool, error) {
+	return r.lastNumber(`SELECT number FROM blocks ORDER BY number DESC LIMIT 1`)
+}
+
+func (r *postgresRepository) LastFinalityNumber(finality string) (uint64, bool, error) {
+	return r.lastNumber(`SELECT number FROM blocks WHERE finality = $1 ORDER BY number DESC LIMIT 1`, finality)
+}
+
+func (r *postgresRepository) BlockTxCounts(start uint64, end uint64) (map[uint64]int, map[uint64]int, error) {
+	txns := map[uint64]int{}
+	rows, err := r.client.Query(`SELECT number, txns FROM blocks WHERE number BETWEEN $1 AND $2`, int64(start), int64(end))
+	if err != nil {
+		return nil, nil, pgError("postgres查询block出错", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var number int64
+		var count int
+		err = rows.Scan(&number, &count)
+		if err != nil {
+			return nil, nil, err
+		}
+		txns[uint64(number)] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	txCount := map[uint64]int{}
+	txRows, err := r.client.Query(`SELECT block_number, count(*) FROM txs WHERE block_number BETWEEN $1 AND $2 GROUP BY block_number`, int64(start), int64(end))
+	if err != nil {
+		return nil, nil, pgError("postgres统计tx出错", err)
+	}
+	defer txRows.Close()
+	for txRows.Next() {
+		var number int64
+		var count int
+		err = txRows.Scan(&number, &count)
+		if err != nil {
+			return nil, nil, err
+		}
+		txCount[uint64(number)] = count
+	}
+	return txns, txCount, txRows.Err()
+}
+
+// 和es一样按时间倒序，同一时间按块内顺序倒序
+const pgTxOrder = "timestamp DESC, block_number DESC, tx_index DESC"
+
+func (r *postgresRepository) GetTx(hash string) (*Doc, error) {
+	return r.get(db.TxIndex, hash, `SELECT doc FROM txs WHERE hash = $1`, strings.ToLower(hash))
+}
+
+func (r *postgresRepository) ListTxs(page Page, block string, finality string) (*SearchResult, error) {
+	var where []string
+	var args []interface{}
+	if block != "" {
+		number, err := strconv.ParseInt(block, 10, 64)
+		if err != nil {
+			return &SearchResult{Relation: "eq", Hits: []*Doc{}}, nil
+		}
+		args = append(args, number)
+		where = append(where, "block_number = $"+strconv.Itoa(len(args)))
+	}
+	if finality != "" {
+		args = append(args, finality)
+		where = append(where, "finality = $"+strconv.Itoa(len(args)))
+	}
+	return r.search(db.TxIndex, "txs", strings.Join(where, " AND "), pgTxOrder, &page, args...)
+}
+
+func (r *postgresRepository) ListTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.search(db.TxIndex, "txs", "(from_address = $1 OR to_address = $1)", pgTxOrder, &page, strings.ToLower(address))
+}
+
+func (r *postgresRepository) ListContractCreations(page Page) (*SearchResult, error) {
+	return r.search(db.TxIndex, "txs", "contract_address <> ''", pgTxOrder, &page)
+}
+
+func (r *postgresRepository) ListContractTxs(page Page) (*SearchResult, error) {
+	return r.search(db.TxIndex, "txs", "log_length > 0", pgTxOrder, &page)
+}
+
+func (r *postgresRepository) ListInternalTxsByTx(hash string, page Page) (*SearchResult, error) {
+	return r.search(db.InternalTxIndex, "internal_txs", "tx_hash = $1", "call_index", &page, strings.ToLower(hash))
+}
+
+func (r *postgresRepository) ListInternalTxsByAddress(address string, page Page) (*SearchResult, error) {
+	return r.search(db.InternalTxIndex, "internal_txs", "(from_address = $1 OR to_address = $1)",
+		"timestamp DESC, block_number DESC, tx_index DESC, call_index DESC", &page, strings.ToLower(address))
+}
+
+const pgTokenTransferOrder = "block_number DESC, log_index DESC, batch_index DESC"
+
+func (r *postgresRepository) ListTokenTransfersByToken(token string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenTransferIndex, "token_transfers", "token = $1", pgTokenTransferOrder, &page, strings.ToLower(token))
+}
+
+func (r *postgresRepository) ListTokenTransfersByAddress(address string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenTransferIndex, "token_transfers", "(from_address = $1 OR to_address = $1)", pgTokenTransferOrder, &page, strings.ToLower(address))
+}
+
+func (r *postgresRepository) ListTokenTransfersByTx(hash string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenTransferIndex, "token_transfers", "tx_hash = $1", "log_index, batch_index", &page, strings.ToLower(hash))
+}
+
+func (r *postgresRepository) ListTokenTransfersByTokenId(token string, tokenId string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenTransferIndex, "token_transfers", "token = $1 AND token_id = $2", pgTokenTransferOrder, &page,
+		strings.ToLower(token), tokenId)
+}
+
+func (r *postgresRepository) ListNftInventory(address string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenBalanceIndex, "token_balances", "holder = $1 AND standard IN ('erc721', 'erc1155') AND amount > 0",
+		"block_number DESC NULLS LAST, id", &page, strings.ToLower(address))
+}
+
+func (r *postgresRepository) ListTokenHolders(token string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenBalanceIndex, "token_balances", "token = $1 AND amount > 0", "amount DESC, id", &page, strings.ToLower(token))
+}
+
+func (r *postgresRepository) ListTokenBalances(address string, page Page) (*SearchResult, error) {
+	return r.search(db.TokenBalanceIndex, "token_balances", "holder = $1 AND amount > 0", "block_number DESC NULLS LAST, id", &page,
+		strings.ToLower(address))
+}
+
+// ListNftHolders 按holder分组统计，分组后的子查询作为表，id是原始大小写的holder
+func (r *postgresRepository) ListNftHolders(token string, page Page) (*SearchResult, error) {
+	table := `(SELECT max(doc->>'holder') AS id, count(*) AS tokens,
+		jsonb_build_object('token', max(doc->>'token'), 'holder', max(doc->>'holder'), 'tokens', count(*)) AS doc
+		FROM token_balances WHERE token = $1 AND amount > 0 GROUP BY holder) holders`
+	return r.search(db.TokenBalanceIndex, table, "", "tokens DESC, id", &page, strings.ToLower(token))
+}
+
+func (r *postgresRepository) FindBalance(address string, number uint64) (*Doc, error) {
+	if number > math.MaxInt64 {
+		number = math.MaxInt64
+	}
+	result, err := r.search(db.BalanceIndex, "balances", "address = $1 AND block_number <= $2", "block_number DESC",
+		&Page{Size: 1}, strings.ToLower(address), int64(number))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Hits) == 0 {
+		return &Doc{Index: db.BalanceIndex, Id: address}, nil
+	}
+	return result.Hits[0], nil
+}
+
+func (r *postgresRepository) ListBalances(address string, page Page) (*SearchResult, error) {
+	return r.search(db.BalanceIndex, "balances", "address = $1", "block_number DESC", &page, strings.ToLower(address))
+}
+
+func (r *postgresRepository) GetAbi(address string) (*Doc, error) {
+	address = strings.ToLower(address)
+	return r.get(db.AbiIndex, address, `SELECT doc FROM abis WHERE address = $1`, address)
+}
+
+func (r *postgresRepository) ListSignatures(id string, page Page) (*SearchResult, error) {
+	return r.search(db.SignatureIndex, "signatures", "selector = $1 OR topic = $1", "signature DESC", &page, strings.ToLower(id))
+}
+
+func (r *postgresRepository) GetAddress(address string) (*Doc, error) {
+	return r.get(db.AddressIndex, address, `SELECT doc FROM addresses WHERE address = $1`, address)
+}
+
+func (r *postgresRepository) ListAddresses(addresses []string) (*SearchResult, error) {
+	return r.search(db.AddressIndex, "addresses", "address = ANY($1)", "address", nil, pq.Array(addresses))
+}
+
+func (r *postgresRepository) UpdateAddressType(address string, _type uint8) error {
+	_, err := r.client.Exec(`UPDATE addresses SET type = $2, doc = jsonb_set(doc, '{type}', to_jsonb($2::smallint)) WHERE address = $1`, address, _type)
+	if err != nil {
+		return pgError("postgres更新address出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListReorgs(page Page) (*SearchResult, error) {
+	return r.search(db.ReorgIndex, "reorgs", "", "timestamp DESC, id DESC", &page)
+}
+
+func (r *postgresRepository) ListReorgsByTx(hash string) (*SearchResult, error) {
+	return r.search(db.ReorgIndex, "reorgs", "tx_hashes @> ARRAY[$1::text]", "timestamp DESC, id DESC", nil, strings.ToLower(hash))
+}
+
+func (r *postgresRepository) ListDeadLetters(page Page) (*SearchResult, error) {
+	return r.search(db.DeadLetterIndex, "dead_letters", "", "timestamp DESC", &page)
+}
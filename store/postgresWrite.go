@@ -0,0 +1,654 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgres一条语句最多65535个参数
+const pgMaxParams = 65535
+
+// insertRows 多行insert，按参数上限分段执行
+// lib/pq会把[]byte当作bytea发送，jsonb列需要传string
+func insertRows(tx *sql.Tx, head string, rows [][]interface{}, tail string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	width := len(rows[0])
+	chunk := pgMaxParams / width
+	for i := 0; i < len(rows); i += chunk {
+		j := i + chunk
+		if j > len(rows) {
+			j = len(rows)
+		}
+		var sb strings.Builder
+		sb.WriteString(head)
+		sb.WriteString(" VALUES ")
+		args := make([]interface{}, 0, (j-i)*width)
+		for k, row := range rows[i:j] {
+			if k > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteByte('(')
+			for l, value := range row {
+				if l > 0 {
+					sb.WriteByte(',')
+				}
+				args = append(args, value)
+				sb.WriteByte('$')
+				sb.WriteString(strconv.Itoa(len(args)))
+			}
+			sb.WriteByte(')')
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(tail)
+		_, err := tx.Exec(sb.String(), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx 在一个事务里执行fn
+func (r *postgresRepository) inTx(msg string, fn func(tx *sql.Tx) error) error {
+	tx, err := r.client.Begin()
+	if err != nil {
+		return pgError(msg, err)
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return pgError(msg, err)
+	}
+	return pgError(msg, tx.Commit())
+}
+
+// nullTopic 没有的topic保存为null
+func nullTopic(topics []string, i int) interface{} {
+	if i < len(topics) {
+		return topics[i]
+	}
+	return nil
+}
+
+// UpsertBlockBatch 一批块在一个事务里写入，tx和address已存在时不覆盖，block覆盖
+func (r *postgresRepository) UpsertBlockBatch(batch *BlockBatch) error {
+	var txRows [][]interface{}
+	var logRows [][]interface{}
+	for _, esTx := range batch.Txs {
+		doc, err := json.Marshal(esTx)
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseInt(esTx.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		txRows = append(txRows, []interface{}{
+			strings.ToLower(esTx.Hash), number, strings.ToLower(esTx.BlockHash), esTx.TransactionIndex, esTx.Time,
+			strings.ToLower(esTx.From), strings.ToLower(esTx.To), strings.ToLower(esTx.ContractAddress),
+			esTx.LogLength, esTx.Finality, string(doc),
+		})
+		for _, log := range esTx.Logs {
+			topics := make([]string, 0, len(log.Topics))
+			for _, topic := range log.Topics {
+				topics = append(topics, strings.ToLower(topic.String()))
+			}
+			logRows = append(logRows, []interface{}{
+				strings.ToLower(esTx.Hash), log.Index, number, strings.ToLower(log.Address.String()),
+				nullTopic(topics, 0), nullTopic(topics, 1), nullTopic(topics, 2), nullTopic(topics, 3), log.Data,
+			})
+		}
+	}
+
+	var internalTxRows [][]interface{}
+	for _, internalTx := range batch.InternalTxs {
+		doc, err := json.Marshal(internalTx)
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseInt(internalTx.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		internalTxRows = append(internalTxRows, []interface{}{
+			internalTx.Id, strings.ToLower(internalTx.TxHash), number, internalTx.Time, internalTx.TransactionIndex, internalTx.Index,
+			internalTx.Type, strings.ToLower(internalTx.From), strings.ToLower(internalTx.To), internalTx.Error, string(doc),
+		})
+	}
+
+	var transferRows [][]interface{}
+	for _, transfer := range batch.TokenTransfers {
+		doc, err := json.Marshal(transfer)
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseInt(transfer.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		transferRows = append(transferRows, []interface{}{
+			transfer.Id, strings.ToLower(transfer.TxHash), number, transfer.LogIndex, transfer.BatchIndex, transfer.Standard,
+			strings.ToLower(transfer.Token), transfer.TokenId, strings.ToLower(transfer.From), strings.ToLower(transfer.To), string(doc),
+		})
+	}
+
+	var balanceRows [][]interface{}
+	for _, balance := range batch.Balances {
+		doc, err := json.Marshal(balance)
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseInt(balance.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		balanceRows = append(balanceRows, []interface{}{
+			balance.Id, strings.ToLower(balance.Address), number, strings.ToLower(balance.BlockHash), balance.Balance, string(doc),
+		})
+	}
+
+	addressMap := map[string]uint8{}
+	for _, address := range batch.Addresses {
+		addressMap[address] = AddressTypeAccount
+	}
+	for _, contract := range batch.Contracts {
+		addressMap[contract] = AddressTypeContract
+	}
+	var addressRows [][]interface{}
+	for address, _type := range addressMap {
+		doc, err := json.Marshal(batch.address(address, _type))
+		if err != nil {
+			return err
+		}
+		addressRows = append(addressRows, []interface{}{address, _type, string(doc)})
+	}
+
+	var blockRows [][]interface{}
+	for _, esBlock := range batch.Blocks {
+		doc, err := json.Marshal(esBlock)
+		if err != nil {
+			return err
+		}
+		number, err := strconv.ParseInt(esBlock.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+		blockRows = append(blockRows, []interface{}{
+			number, strings.ToLower(esBlock.BlockHash), strings.ToLower(esBlock.ParentHash),
+			esBlock.Time, esBlock.Txns, esBlock.Finality, string(doc),
+		})
+	}
+
+	return r.inTx("postgres写入区块出错", func(tx *sql.Tx) error {
+		err := insertRows(tx, `INSERT INTO txs (hash, block_number, block_hash, tx_index, timestamp,
+			from_address, to_address, contract_address, log_length, finality, doc)`, txRows,
+			`ON CONFLICT (hash) DO UPDATE SET block_number = EXCLUDED.block_number, block_hash = EXCLUDED.block_hash,
+			tx_index = EXCLUDED.tx_index, timestamp = EXCLUDED.timestamp, from_address = EXCLUDED.from_address,
+			to_address = EXCLUDED.to_address, contract_address = EXCLUDED.contract_address,
+			log_length = EXCLUDED.log_length, finality = EXCLUDED.finality, doc = EXCLUDED.doc`)
+		if err != nil {
+			return err
+		}
+		err = insertRows(tx, `INSERT INTO logs (tx_hash, log_index, block_number, address,
+			topic0, topic1, topic2, topic3, data)`, logRows,
+			`ON CONFLICT (tx_hash, log_index) DO UPDATE SET block_number = EXCLUDED.block_number, address = EXCLUDED.address,
+			topic0 = EXCLUDED.topic0, topic1 = EXCLUDED.topic1, topic2 = EXCLUDED.topic2, topic3 = EXCLUDED.topic3,
+			data = EXCLUDED.data`)
+		if err != nil {
+			return err
+		}
+		err = insertRows(tx, `INSERT INTO internal_txs (id, tx_hash, block_number, timestamp, tx_index, call_index,
+			type, from_address, to_address, error, doc)`, internalTxRows,
+			`ON CONFLICT (id) DO UPDATE SET tx_hash = EXCLUDED.tx_hash, block_number = EXCLUDED.block_number,
+			timestamp = EXCLUDED.timestamp, tx_index = EXCLUDED.tx_index, call_index = EXCLUDED.call_index,
+			type = EXCLUDED.type, from_address = EXCLUDED.from_address, to_address = EXCLUDED.to_address,
+			error = EXCLUDED.error, doc = EXCLUDED.doc`)
+		if err != nil {
+			return err
+		}
+		// 已经写入的转账不重复计算余额
+		newTransfers, err := newTokenTransfers(tx, batch.TokenTransfers)
+		if err != nil {
+			return err
+		}
+		err = insertRows(tx, `INSERT INTO token_transfers (id, tx_hash, block_number, log_index, batch_index, standard,
+			token, token_id, from_address, to_address, doc)`, transferRows, `ON CONFLICT (id) DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		err = applyBalances(tx, newTransfers, false)
+		if err != nil {
+			return err
+		}
+		err = insertRows(tx, `INSERT INTO balances (id, address, block_number, block_hash, balance, doc)`, balanceRows,
+			`ON CONFLICT (id) DO UPDATE SET block_hash = EXCLUDED.block_hash, balance = EXCLUDED.balance, doc = EXCLUDED.doc`)
+		if err != nil {
+			return err
+		}
+		err = insertRows(tx, `INSERT INTO addresses (address, type, doc)`, addressRows, `ON CONFLICT (address) DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		return insertRows(tx, `INSERT INTO blocks (number, hash, parent_hash, timestamp, txns, finality, doc)`, blockRows,
+			`ON CONFLICT (number) DO UPDATE SET hash = EXCLUDED.hash, parent_hash = EXCLUDED.parent_hash,
+			timestamp = EXCLUDED.timestamp, txns = EXCLUDED.txns, finality = EXCLUDED.finality, doc = EXCLUDED.doc`)
+	})
+}
+
+// newTokenTransfers 过滤出还没有写入的转账
+func newTokenTransfers(tx *sql.Tx, transfers []*ESTokenTransfer) ([]*ESTokenTransfer, error) {
+	if len(transfers) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(transfers))
+	for _, transfer := range transfers {
+		ids = append(ids, transfer.Id)
+	}
+	rows, err := tx.Query(`SELECT id FROM token_transfers WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := map[string]bool{}
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var newTransfers []*ESTokenTransfer
+	for _, transfer := range transfers {
+		if !existing[transfer.Id] {
+			newTransfers = append(newTransfers, transfer)
+		}
+	}
+	return newTransfers, nil
+}
+
+// tokenBalanceRow token_balances的一行，回滚时重新创建的余额block_number为null
+func tokenBalanceRow(balance *ESTokenBalance) ([]interface{}, error) {
+	doc, err := json.Marshal(balance)
+	if err != nil {
+		return nil, err
+	}
+	var number interface{}
+	if balance.Number != "" {
+		number, err = strconv.ParseInt(balance.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []interface{}{
+		balance.Id, balance.Standard, strings.ToLower(balance.Token), balance.TokenId, strings.ToLower(balance.Holder),
+		balance.Amount, number, string(doc),
+	}, nil
+}
+
+// applyBalances 把转账的改变加到余额上，doc里的amount和number一起更新，数量为0的余额删除
+func applyBalances(tx *sql.Tx, transfers []*ESTokenTransfer, revert bool) error {
+	deltas, err := balanceDeltas(transfers, revert)
+	if err != nil || len(deltas) == 0 {
+		return err
+	}
+	rows := make([][]interface{}, 0, len(deltas))
+	ids := make([]string, 0, len(deltas))
+	for _, delta := range deltas {
+		balance := newBalance(delta)
+		balance.Amount, balance.Number = delta.Amount.String(), delta.Number
+		row, err := tokenBalanceRow(balance)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		ids = append(ids, delta.Id)
+	}
+	err = insertRows(tx, `INSERT INTO token_balances (id, standard, token, token_id, holder, amount, block_number, doc)`, rows,
+		`ON CONFLICT (id) DO UPDATE SET amount = token_balances.amount + EXCLUDED.amount,
+		block_number = COALESCE(EXCLUDED.block_number, token_balances.block_number),
+		doc = token_balances.doc || jsonb_strip_nulls(jsonb_build_object(
+			'amount', (token_balances.amount + EXCLUDED.amount)::text, 'number', EXCLUDED.doc->'number'))`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM token_balances WHERE id = ANY($1) AND amount = 0`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	return logNegativeBalances(tx, ids)
+}
+
+// logNegativeBalances 记录变成负数的余额，负数的余额仍然保存，之后的转账或回滚还要在它上面计算
+func logNegativeBalances(tx *sql.Tx, ids []string) error {
+	rows, err := tx.Query(`SELECT id, amount::text FROM token_balances WHERE id = ANY($1) AND amount < 0`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, amount string
+		err = rows.Scan(&id, &amount)
+		if err != nil {
+			return err
+		}
+		logNegativeBalance(id, amount)
+	}
+	return rows.Err()
+}
+
+// RebuildTokenBalances 在一个事务里按id分页读取全部转账，清空token_balances后重新写入
+func (r *postgresRepository) RebuildTokenBalances() (int, error) {
+	count := 0
+	err := r.inTx("postgres重建代币余额出错", func(tx *sql.Tx) error {
+		balances, err := rebuildBalances(func(add func(transfer *ESTokenTransfer) error) error {
+			last := ""
+			for {
+				n, lastId, err := scanTokenTransfers(tx, last, add)
+				if err != nil || n < 1000 {
+					return err
+				}
+				last = lastId
+			}
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM token_balances`)
+		if err != nil {
+			return err
+		}
+		rows := make([][]interface{}, 0, len(balances))
+		for _, balance := range balances {
+			row, err := tokenBalanceRow(balance)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		count = len(balances)
+		return insertRows(tx, `INSERT INTO token_balances (id, standard, token, token_id, holder, amount, block_number, doc)`, rows, "")
+	})
+	return count, err
+}
+
+// scanTokenTransfers 读取id大于last的1000个转账，返回读到的数量和最后一个id
+func scanTokenTransfers(tx *sql.Tx, last string, add func(transfer *ESTokenTransfer) error) (count int, lastId string, err error) {
+	rows, err := tx.Query(`SELECT id, doc FROM token_transfers WHERE id > $1 ORDER BY id LIMIT 1000`, last)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc []byte
+		err = rows.Scan(&lastId, &doc)
+		if err != nil {
+			return 0, "", err
+		}
+		transfer := new(ESTokenTransfer)
+		err = json.Unmarshal(doc, transfer)
+		if err != nil {
+			return 0, "", err
+		}
+		err = add(transfer)
+		if err != nil {
+			return 0, "", err
+		}
+		count++
+	}
+	return count, lastId, rows.Err()
+}
+
+func (r *postgresRepository) RemoveBlocks(blocks []*ESBlock) ([]string, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	hashes := make([]string, 0, len(blocks))
+	numbers := make([]int64, 0, len(blocks))
+	for _, block := range blocks {
+		hashes = append(hashes, strings.ToLower(block.BlockHash))
+		number, err := strconv.ParseInt(block.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, number)
+	}
+	txHashes := []string{}
+	err := r.inTx("postgres删除孤块出错", func(tx *sql.Tx) error {
+		// 新建的合约地址按原始大小写保存在doc里，内部调用和代币转账随交易级联删除，先取出内部创建的合约和转账
+		var contracts []string
+		createRows, err := tx.Query(`SELECT doc->>'to' FROM internal_txs WHERE block_number = ANY($1)
+			AND tx_hash IN (SELECT hash FROM txs WHERE block_hash = ANY($2))
+			AND type IN ('CREATE', 'CREATE2') AND error = '' AND to_address <> ''`, pq.Array(numbers), pq.Array(hashes))
+		if err != nil {
+			return err
+		}
+		for createRows.Next() {
+			var contract string
+			err = createRows.Scan(&contract)
+			if err != nil {
+				createRows.Close()
+				return err
+			}
+			contracts = append(contracts, contract)
+		}
+		createRows.Close()
+		if err = createRows.Err(); err != nil {
+			return err
+		}
+		// 代币转账级联删除前回滚它们对余额的改变
+		transferRows, err := tx.Query(`SELECT doc FROM token_transfers WHERE block_number = ANY($1)
+			AND tx_hash IN (SELECT hash FROM txs WHERE block_hash = ANY($2))`, pq.Array(numbers), pq.Array(hashes))
+		if err != nil {
+			return err
+		}
+		var transfers []*ESTokenTransfer
+		for transferRows.Next() {
+			var doc []byte
+			err = transferRows.Scan(&doc)
+			if err != nil {
+				transferRows.Close()
+				return err
+			}
+			transfer := new(ESTokenTransfer)
+			err = json.Unmarshal(doc, transfer)
+			if err != nil {
+				transferRows.Close()
+				return err
+			}
+			transfers = append(transfers, transfer)
+		}
+		transferRows.Close()
+		if err = transferRows.Err(); err != nil {
+			return err
+		}
+		err = applyBalances(tx, transfers, true)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`DELETE FROM txs WHERE block_hash = ANY($1) RETURNING hash, doc->>'contractAddress'`, pq.Array(hashes))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var hash, contract string
+			err = rows.Scan(&hash, &contract)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			txHashes = append(txHashes, hash)
+			if contract != "" {
+				contracts = append(contracts, contract)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM addresses WHERE address = ANY($1)`, pq.Array(contracts))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM balances WHERE block_hash = ANY($1)`, pq.Array(hashes))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM blocks WHERE number = ANY($1)`, pq.Array(numbers))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+func (r *postgresRepository) SetFinality(start uint64, end uint64, finality string) error {
+	return r.inTx("postgres更新状态出错", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE blocks SET finality = $3, doc = jsonb_set(doc, '{finality}', to_jsonb($3::text))
+			WHERE number BETWEEN $1 AND $2`, int64(start), int64(end), finality)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE txs SET finality = $3, doc = jsonb_set(doc, '{finality}', to_jsonb($3::text))
+			WHERE block_number BETWEEN $1 AND $2`, int64(start), int64(end), finality)
+		return err
+	})
+}
+
+func (r *postgresRepository) UpdateTxFees(fees []*ESTxFee) error {
+	return r.inTx("postgres更新手续费出错", func(tx *sql.Tx) error {
+		for _, fee := range fees {
+			doc, err := json.Marshal(fee)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`UPDATE txs SET doc = doc || $2::jsonb WHERE hash = $1`, strings.ToLower(fee.Hash), string(doc))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *postgresRepository) SaveReorg(reorg *ESReorg) error {
+	doc, err := json.Marshal(reorg)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.ParseInt(reorg.Number, 10, 64)
+	if err != nil {
+		return err
+	}
+	txHashes := make([]string, 0, len(reorg.TxHashes))
+	for _, hash := range reorg.TxHashes {
+		txHashes = append(txHashes, strings.ToLower(hash))
+	}
+	_, err = r.client.Exec(`INSERT INTO reorgs (number, timestamp, tx_hashes, doc) VALUES ($1, $2, $3, $4)`,
+		number, reorg.Time, pq.Array(txHashes), string(doc))
+	if err != nil {
+		return pgError("postgres写入reorg出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) SaveAbi(contractAbi *ESAbi) error {
+	doc, err := json.Marshal(contractAbi)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Exec(`INSERT INTO abis (address, doc) VALUES ($1, $2)
+		ON CONFLICT (address) DO UPDATE SET doc = EXCLUDED.doc`, strings.ToLower(contractAbi.Address), string(doc))
+	if err != nil {
+		return pgError("postgres写入abi出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) SaveSignatures(signatures []*ESSignature) error {
+	rows := make([][]interface{}, 0, len(signatures))
+	for _, signature := range signatures {
+		doc, err := json.Marshal(signature)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{signature.Signature, strings.ToLower(signature.Selector), strings.ToLower(signature.Topic), string(doc)})
+	}
+	return r.inTx("postgres写入签名出错", func(tx *sql.Tx) error {
+		return insertRows(tx, `INSERT INTO signatures (signature, selector, topic, doc)`, rows,
+			`ON CONFLICT (signature) DO UPDATE SET doc = EXCLUDED.doc`)
+	})
+}
+
+func (r *postgresRepository) GetCheckpoint() (*ESCheckpoint, error) {
+	doc, err := r.get("sync", checkpointId, `SELECT doc FROM sync_state WHERE id = $1`, checkpointId)
+	if err != nil || !doc.Found {
+		return nil, err
+	}
+	checkpoint := new(ESCheckpoint)
+	err = json.Unmarshal(doc.Source, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (r *postgresRepository) SaveCheckpoint(checkpoint *ESCheckpoint) error {
+	doc, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Exec(`INSERT INTO sync_state (id, doc) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET doc = EXCLUDED.doc`, checkpointId, string(doc))
+	if err != nil {
+		return pgError("postgres写入同步进度出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeleteCheckpoint() error {
+	_, err := r.client.Exec(`DELETE FROM sync_state WHERE id = $1`, checkpointId)
+	if err != nil {
+		return pgError("postgres删除同步进度出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) SaveDeadLetter(deadLetter *ESDeadLetter) error {
+	doc, err := json.Marshal(deadLetter)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.ParseInt(deadLetter.Number, 10, 64)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Exec(`INSERT INTO dead_letters (number, timestamp, doc) VALUES ($1, $2, $3)
+		ON CONFLICT (number) DO UPDATE SET timestamp = EXCLUDED.timestamp, doc = EXCLUDED.doc`, number, deadLetter.Time, string(doc))
+	if err != nil {
+		return pgError("postgres写入死信出错", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeleteDeadLetters(numbers []uint64) error {
+	values := make([]int64, 0, len(numbers))
+	for _, number := range numbers {
+		values = append(values, int64(number))
+	}
+	_, err := r.client.Exec(`DELETE FROM dead_letters WHERE number = ANY($1)`, pq.Array(values))
+	if err != nil {
+		return pgError("postgres删除死信出错", err)
+	}
+	return nil
+}
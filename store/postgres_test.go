@@ -0,0 +1,228 @@
+package store
+
+import (
+	"database/sql"
+	"explorer/db"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPostgres 设置了POSTGRES_URL时在一个新建的schema里执行migration，测试结束后删除schema，没有设置时返回nil
+func testPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	postgresUrl := os.Getenv("POSTGRES_URL")
+	if postgresUrl == "" {
+		return nil
+	}
+	admin, err := sql.Open("postgres", postgresUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("explorer_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec(`CREATE SCHEMA ` + schema)
+	if err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	t.Setenv("POSTGRES_URL", withSearchPath(t, postgresUrl, schema))
+	db.InitPgClient()
+	client := db.PgClient
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+// withSearchPath 连接参数里加上search_path，支持url和key=value两种格式
+func withSearchPath(t *testing.T, postgresUrl string, schema string) string {
+	t.Helper()
+	if !strings.HasPrefix(postgresUrl, "postgres://") && !strings.HasPrefix(postgresUrl, "postgresql://") {
+		return postgresUrl + " search_path=" + schema
+	}
+	u, err := url.Parse(postgresUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func appliedMigrations(t *testing.T, client *sql.DB) map[int]time.Time {
+	t.Helper()
+	rows, err := client.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return applied
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	client := testPostgres(t)
+	if client == nil {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	entries, err := os.ReadDir("../db/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := appliedMigrations(t, client)
+	if len(applied) != len(entries) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(entries))
+	}
+	for _, entry := range entries {
+		version, err := strconv.Atoi(strings.SplitN(entry.Name(), "_", 2)[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := applied[version]; !ok {
+			t.Errorf("migration %s is not applied", entry.Name())
+		}
+	}
+	for _, table := range []string{"blocks", "txs", "logs", "addresses", "reorgs", "sync_state", "dead_letters"} {
+		var exists bool
+		err = client.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("table %s is missing", table)
+		}
+	}
+
+	// 再次启动不会重复执行已经执行过的migration
+	db.InitPgClient()
+	defer db.PgClient.Close()
+	again := appliedMigrations(t, db.PgClient)
+	if len(again) != len(applied) {
+		t.Fatalf("applied %d migrations after restart, want %d", len(again), len(applied))
+	}
+	for version, appliedAt := range applied {
+		if !again[version].Equal(appliedAt) {
+			t.Errorf("migration %d is applied again at %v", version, again[version])
+		}
+	}
+}
+
+// testPgBatches 两个块，块2里的交易创建了合约
+func testPgBatches() (*BlockBatch, *BlockBatch) {
+	first := &BlockBatch{
+		Blocks:    []*ESBlock{{Number: "1", BlockHash: "0xb1", Txns: 1, Time: 1}},
+		Txs:       []*ESTx{{Hash: "0xt1", BlockHash: "0xb1", Number: "1", Time: 1, From: testPgAlice, To: testPgBob}},
+		Addresses: []string{testPgAlice, testPgBob},
+	}
+	second := &BlockBatch{
+		Blocks: []*ESBlock{{Number: "2", BlockHash: "0xb2", Txns: 1, Time: 2}},
+		Txs: []*ESTx{{Hash: "0xt2", BlockHash: "0xb2", Number: "2", Time: 2, From: testPgAlice,
+			ContractAddress: testPgContract}},
+		Addresses: []string{testPgAlice},
+		Contracts: []string{testPgContract},
+	}
+	return first, second
+}
+
+const (
+	testPgAlice    = "0x00000000000000000000000000000000000000Bb"
+	testPgBob      = "0x00000000000000000000000000000000000000cc"
+	testPgContract = "0x00000000000000000000000000000000000000dd"
+)
+
+func TestPostgresUpsertBlockBatch(t *testing.T) {
+	client := testPostgres(t)
+	if client == nil {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	repo := NewPostgresRepository(client)
+	first, second := testPgBatches()
+	for _, batch := range []*BlockBatch{first, second, second} {
+		err := repo.UpsertBlockBatch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 重复写入不会产生重复的行
+	counts := map[string]int{
+		`SELECT count(*) FROM blocks`:                                          2,
+		`SELECT count(*) FROM txs`:                                             2,
+		`SELECT count(*) FROM addresses`:                                       3,
+		`SELECT count(*) FROM addresses WHERE address = '` + testPgAlice + `'`: 1,
+	}
+	for query, want := range counts {
+		var got int
+		err := client.QueryRow(query).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s = %d, want %d", query, got, want)
+		}
+	}
+	doc, err := repo.GetAddress(testPgContract)
+	if err != nil || !doc.Found {
+		t.Fatalf("GetAddress(%s) found = %v, %v, want found", testPgContract, doc.Found, err)
+	}
+}
+
+func TestPostgresRemoveBlocks(t *testing.T) {
+	client := testPostgres(t)
+	if client == nil {
+		t.Skip("POSTGRES_URL is not set")
+	}
+	repo := NewPostgresRepository(client)
+	first, second := testPgBatches()
+	for _, batch := range []*BlockBatch{first, second} {
+		err := repo.UpsertBlockBatch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 回滚两次，第二次没有可以删除的数据
+	for i := 0; i < 2; i++ {
+		txHashes, err := repo.RemoveBlocks(second.Blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && (len(txHashes) != 1 || txHashes[0] != "0xt2") {
+			t.Fatalf("removed txs = %v, want [0xt2]", txHashes)
+		}
+	}
+	block, err := repo.FindBlock(2)
+	if err != nil || block != nil {
+		t.Fatalf("FindBlock(2) = %v, %v, want nil", block, err)
+	}
+	for hash, want := range map[string]bool{"0xt1": true, "0xt2": false} {
+		doc, err := repo.GetTx(hash)
+		if err != nil || doc.Found != want {
+			t.Fatalf("GetTx(%s) found = %v, %v, want %v", hash, doc.Found, err, want)
+		}
+	}
+	doc, err := repo.GetAddress(testPgContract)
+	if err != nil || doc.Found {
+		t.Fatalf("GetAddress(%s) found = %v, %v, want removed", testPgContract, doc.Found, err)
+	}
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"encoding/json"
+	"explorer/db"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBackends 不需要外部服务的存储后端，embedded使用临时文件，设置了POSTGRES_URL时加上postgres
+func testBackends(t *testing.T) map[string]Repository {
+	t.Helper()
+	os.Setenv("EMBEDDED_DB_PATH", filepath.Join(t.TempDir(), "explorer.db"))
+	defer os.Unsetenv("EMBEDDED_DB_PATH")
+	db.InitBoltClient()
+	client := db.BoltClient
+	t.Cleanup(func() {
+		client.Close()
+	})
+	backends := map[string]Repository{
+		"memory":   NewMemoryRepository(),
+		"embedded": NewEmbeddedRepository(client),
+	}
+	if pgClient := testPostgres(t); pgClient != nil {
+		backends["postgres"] = NewPostgresRepository(pgClient)
+	}
+	return backends
+}
+
+const (
+	testContract = "0x00000000000000000000000000000000000000dd"
+	testCreated  = "0x00000000000000000000000000000000000000ee"
+)
+
+// testBlockBatches 两个块：块1给alice铸造100，块2里alice转给bob 30，同时创建了合约并记录了bob的原生币余额
+func testBlockBatches() (*BlockBatch, *BlockBatch) {
+	first := &BlockBatch{
+		Blocks: []*ESBlock{{Number: "1", BlockHash: "0xb1", Txns: 1, Time: 1}},
+		Txs:    []*ESTx{{Hash: "0xt1", BlockHash: "0xb1", Number: "1", Time: 1, From: testAlice, To: testToken}},
+		TokenTransfers: []*ESTokenTransfer{
+			{Id: "0xt1-0", Standard: TokenStandardERC20, Token: testToken, From: zeroAddress, To: testAlice, Amount: "100",
+				TxHash: "0xt1", BlockHash: "0xb1", Number: "1", Time: 1},
+		},
+		Addresses: []string{testAlice},
+	}
+	second := &BlockBatch{
+		Blocks: []*ESBlock{{Number: "2", BlockHash: "0xb2", Txns: 1, Time: 2}},
+		Txs: []*ESTx{{Hash: "0xt2", BlockHash: "0xb2", Number: "2", Time: 2, From: testAlice, To: testToken,
+			ContractAddress: testContract}},
+		InternalTxs: []*ESInternalTx{
+			{Id: "0xt2-1", TxHash: "0xt2", BlockHash: "0xb2", Number: "2", Time: 2, Index: 1, Type: "CREATE",
+				From: testContract, To: testCreated},
+		},
+		TokenTransfers: []*ESTokenTransfer{
+			{Id: "0xt2-0", Standard: TokenStandardERC20, Token: testToken, From: testAlice, To: testBob, Amount: "30",
+				TxHash: "0xt2", BlockHash: "0xb2", Number: "2", Time: 2},
+		},
+		Balances: []*ESBalance{
+			{Id: "bob-2", Address: testBob, Balance: "5", BlockHash: "0xb2", Number: "2", Time: 2},
+		},
+		Addresses: []string{testAlice, testBob},
+		Contracts: []string{testContract, testCreated},
+	}
+	return first, second
+}
+
+// tokenHolders 代币的持有人和数量
+func tokenHolders(t *testing.T, repo Repository) map[string]string {
+	t.Helper()
+	result, err := repo.ListTokenHolders(testToken, Page{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	holders := map[string]string{}
+	for _, doc := range result.Hits {
+		var balance ESTokenBalance
+		err = json.Unmarshal(doc.Source, &balance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		holders[balance.Holder] = balance.Amount
+	}
+	return holders
+}
+
+func assertHolders(t *testing.T, repo Repository, want map[string]string) {
+	t.Helper()
+	got := tokenHolders(t, repo)
+	if len(got) != len(want) {
+		t.Fatalf("holders = %v, want %v", got, want)
+	}
+	for holder, amount := range want {
+		if got[holder] != amount {
+			t.Fatalf("holders = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRemoveBlocksRollback(t *testing.T) {
+	for name, repo := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := testBlockBatches()
+			for _, batch := range []*BlockBatch{first, second, second} {
+				err := repo.UpsertBlockBatch(batch)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 重复写入同一个块不会重复计算余额
+			assertHolders(t, repo, map[string]string{testAlice: "70", testBob: "30"})
+
+			// 回滚两次，第二次没有可以删除的数据
+			for i := 0; i < 2; i++ {
+				txHashes, err := repo.RemoveBlocks(second.Blocks)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 && (len(txHashes) != 1 || txHashes[0] != "0xt2") {
+					t.Fatalf("removed txs = %v, want [0xt2]", txHashes)
+				}
+				assertHolders(t, repo, map[string]string{testAlice: "100"})
+			}
+
+			block, err := repo.FindBlock(2)
+			if err != nil || block != nil {
+				t.Fatalf("FindBlock(2) = %v, %v, want nil", block, err)
+			}
+			for hash, want := range map[string]bool{"0xt1": true, "0xt2": false} {
+				doc, err := repo.GetTx(hash)
+				if err != nil || doc.Found != want {
+					t.Fatalf("GetTx(%s) found = %v, %v, want %v", hash, doc.Found, err, want)
+				}
+			}
+			for _, address := range []string{testContract, testCreated} {
+				doc, err := repo.GetAddress(address)
+				if err != nil || doc.Found {
+					t.Fatalf("GetAddress(%s) found = %v, %v, want removed", address, doc.Found, err)
+				}
+			}
+			checks := map[string]func() (*SearchResult, error){
+				"transfers": func() (*SearchResult, error) { return repo.ListTokenTransfersByTx("0xt2", Page{Size: 10}) },
+				"internal":  func() (*SearchResult, error) { return repo.ListInternalTxsByTx("0xt2", Page{Size: 10}) },
+				"balances":  func() (*SearchResult, error) { return repo.ListBalances(testBob, Page{Size: 10}) },
+			}
+			for check, list := range checks {
+				result, err := list()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(result.Hits) != 0 {
+					t.Errorf("%s of the removed block are still there: %d", check, len(result.Hits))
+				}
+			}
+
+			// 重新写入被回滚的块，余额重新计算
+			err = repo.UpsertBlockBatch(second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertHolders(t, repo, map[string]string{testAlice: "70", testBob: "30"})
+		})
+	}
+}
+
+func TestUpsertOverwritesChainData(t *testing.T) {
+	for name, repo := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := testBlockBatches()
+			for _, batch := range []*BlockBatch{first, second} {
+				err := repo.UpsertBlockBatch(batch)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 重新同步时修正了tx和内部调用的字段，地址列表里不会多出重复的记录
+			_, resynced := testBlockBatches()
+			resynced.Txs[0].MethodName = "fixed"
+			resynced.InternalTxs[0].Error = "out of gas"
+			err := repo.UpsertBlockBatch(resynced)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertHolders(t, repo, map[string]string{testAlice: "70", testBob: "30"})
+			doc, err := repo.GetTx("0xt2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var esTx ESTx
+			err = json.Unmarshal(doc.Source, &esTx)
+			if err != nil || esTx.MethodName != "fixed" {
+				t.Fatalf("GetTx(0xt2) methodName = %s, %v, want fixed", esTx.MethodName, err)
+			}
+			internal, err := repo.ListInternalTxsByTx("0xt2", Page{Size: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var internalTx ESInternalTx
+			if len(internal.Hits) != 1 {
+				t.Fatalf("internal txs = %d, want 1", len(internal.Hits))
+			}
+			err = json.Unmarshal(internal.Hits[0].Source, &internalTx)
+			if err != nil || internalTx.Error != "out of gas" {
+				t.Fatalf("internal tx error = %s, %v, want out of gas", internalTx.Error, err)
+			}
+			txs, err := repo.ListTxsByAddress(testAlice, Page{Size: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(txs.Hits) != 2 {
+				t.Errorf("txs of alice = %d, want 2", len(txs.Hits))
+			}
+		})
+	}
+}
+
+func TestRebuildTokenBalances(t *testing.T) {
+	for name, repo := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			first, second := testBlockBatches()
+			// 先写入块2，alice的余额是负数，不返回
+			err := repo.UpsertBlockBatch(second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertHolders(t, repo, map[string]string{testBob: "30"})
+
+			count, err := repo.RebuildTokenBalances()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 2 {
+				t.Errorf("rebuilt %d balances, want 2", count)
+			}
+			assertHolders(t, repo, map[string]string{testBob: "30"})
+
+			// 重建时保留了负数的余额，补上块1之后是正确的
+			err = repo.UpsertBlockBatch(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertHolders(t, repo, map[string]string{testAlice: "70", testBob: "30"})
+			_, err = repo.RebuildTokenBalances()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertHolders(t, repo, map[string]string{testAlice: "70", testBob: "30"})
+		})
+	}
+}
+
+func TestBatchAddressBlockHash(t *testing.T) {
+	batch := &BlockBatch{
+		Txs:         []*ESTx{{ContractAddress: "0xc1", BlockHash: "0xb1"}},
+		InternalTxs: []*ESInternalTx{{Type: "CREATE2", To: "0xc2", BlockHash: "0xb2"}, {Type: "CREATE", To: "0xc3", BlockHash: "0xb3", Error: "reverted"}},
+	}
+	for contract, want := range map[string]string{"0xc1": "0xb1", "0xc2": "0xb2", "0xc3": ""} {
+		esAddress := batch.address(contract, AddressTypeContract)
+		if esAddress.BlockHash != want {
+			t.Errorf("address(%s).BlockHash = %s, want %s", contract, esAddress.BlockHash, want)
+		}
+		if esAddress.Time == 0 {
+			t.Errorf("address(%s).Time not set", contract)
+		}
+	}
+	// 普通地址不随块删除
+	if esAddress := batch.address("0xc1", AddressTypeAccount); esAddress.BlockHash != "" {
+		t.Errorf("account BlockHash = %s, want empty", esAddress.BlockHash)
+	}
+}
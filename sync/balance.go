@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/db"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"os"
+	"strings"
+)
+
+// SYNC_BALANCE 不为空时记录块里出现的地址在这个块之后的余额
+// 按高度读取历史状态，从很早的块开始同步时需要归档节点
+var syncBalance = os.Getenv("SYNC_BALANCE") != ""
+
+// ErrBalanceDisabled 没有开启SYNC_BALANCE时余额接口返回的错误
+var ErrBalanceDisabled = errors.New("没有开启SYNC_BALANCE，不记录原生币余额")
+
+// BalanceEnabled 是否记录原生币余额
+func BalanceEnabled() bool {
+	return syncBalance
+}
+
+// 批量请求eth_getBalance时每次请求的数量
+const balanceBatchSize = 100
+
+// getBalances 读取地址在块之后的余额，矿工的手续费收入也会改变余额，一起记录
+func getBalances(ctx context.Context, block *rpcBlock, addresses []string) ([]*store.ESBalance, error) {
+	if !syncBalance {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	var unique []string
+	for _, address := range append([]string{block.header.Coinbase.String()}, addresses...) {
+		key := strings.ToLower(address)
+		if address == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, address)
+	}
+	number := block.header.Number.String()
+	blockNumber := hexutil.EncodeBig(block.header.Number)
+	results := make([]hexutil.Big, len(unique))
+	for i := 0; i < len(unique); i += balanceBatchSize {
+		j := i + balanceBatchSize
+		if j > len(unique) {
+			j = len(unique)
+		}
+		elems := make([]rpc.BatchElem, 0, j-i)
+		for k := i; k < j; k++ {
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_getBalance",
+				Args:   []interface{}{unique[k], blockNumber},
+				Result: &results[k],
+			})
+		}
+		err := db.RpcClient.BatchCallContext(ctx, elems)
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			if elem.Error != nil {
+				return nil, elem.Error
+			}
+		}
+	}
+	balances := make([]*store.ESBalance, 0, len(unique))
+	for i, address := range unique {
+		balances = append(balances, &store.ESBalance{
+			Id:        strings.ToLower(address) + "-" + number,
+			Address:   address,
+			Balance:   results[i].ToInt().String(),
+			BlockHash: block.hash.String(),
+			Number:    number,
+			Time:      block.header.Time,
+		})
+	}
+	return balances, nil
+}
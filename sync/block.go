@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"explorer/db"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+)
+
+// 每个blob消耗的blob gas，节点的receipt里没有blobGasUsed时按blob数量计算
+const gasPerBlob = 1 << 17
+
+// rpcBlock eth_getBlockByNumber返回的块
+//
+// geth v1.10.21的Header不认识上海升级之后的字段，自己计算的hash和大小都不对，也解析不了type 3的blob交易，
+// 所以hash、大小和4844的字段按节点返回的json读取，交易逐个解析
+type rpcBlock struct {
+	header        *types.Header
+	hash          common.Hash
+	size          uint64
+	blobGasUsed   *uint64
+	excessBlobGas *uint64
+	// 这个块的blob gas价格，坎昆升级之前为nil
+	blobGasPrice *big.Int
+	txs          []*rpcTx
+}
+
+// rpcTx 块里的一个交易，blob交易没有对应的types.Transaction，只有blob
+type rpcTx struct {
+	hash common.Hash
+	tx   *types.Transaction
+	blob *blobTx
+}
+
+// blobTx 按节点返回的json解析的type 3交易
+type blobTx struct {
+	Hash                 common.Hash      `json:"hash"`
+	From                 common.Address   `json:"from"`
+	To                   *common.Address  `json:"to"`
+	ChainID              *hexutil.Big     `json:"chainId"`
+	Nonce                hexutil.Uint64   `json:"nonce"`
+	Gas                  hexutil.Uint64   `json:"gas"`
+	MaxFeePerGas         *hexutil.Big     `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big     `json:"maxPriorityFeePerGas"`
+	MaxFeePerBlobGas     *hexutil.Big     `json:"maxFeePerBlobGas"`
+	Value                *hexutil.Big     `json:"value"`
+	Input                hexutil.Bytes    `json:"input"`
+	AccessList           types.AccessList `json:"accessList"`
+	BlobVersionedHashes  []common.Hash    `json:"blobVersionedHashes"`
+	V                    *hexutil.Big     `json:"v"`
+	R                    *hexutil.Big     `json:"r"`
+	S                    *hexutil.Big     `json:"s"`
+}
+
+// blobCount 块里所有交易的blob数量
+func (b *rpcBlock) blobCount() int {
+	count := 0
+	for _, tx := range b.txs {
+		if tx.blob != nil {
+			count += len(tx.blob.BlobVersionedHashes)
+		}
+	}
+	return count
+}
+
+// getBlock 获取块和块里完整的交易
+func getBlock(ctx context.Context, number uint64) (*rpcBlock, error) {
+	var raw json.RawMessage
+	err := db.RpcClient.CallContext(ctx, &raw, "eth_getBlockByNumber", hexutil.EncodeUint64(number), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+	header := new(types.Header)
+	err = json.Unmarshal(raw, header)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Hash          common.Hash       `json:"hash"`
+		Size          hexutil.Uint64    `json:"size"`
+		BlobGasUsed   *hexutil.Uint64   `json:"blobGasUsed"`
+		ExcessBlobGas *hexutil.Uint64   `json:"excessBlobGas"`
+		Transactions  []json.RawMessage `json:"transactions"`
+	}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return nil, err
+	}
+	block := &rpcBlock{
+		header: header,
+		hash:   body.Hash,
+		size:   uint64(body.Size),
+		txs:    make([]*rpcTx, 0, len(body.Transactions)),
+	}
+	for _, rawTx := range body.Transactions {
+		tx, err := parseTx(rawTx)
+		if err != nil {
+			return nil, err
+		}
+		block.txs = append(block.txs, tx)
+	}
+	if body.BlobGasUsed != nil {
+		blobGasUsed := uint64(*body.BlobGasUsed)
+		block.blobGasUsed = &blobGasUsed
+	}
+	if body.ExcessBlobGas != nil {
+		excessBlobGas := uint64(*body.ExcessBlobGas)
+		block.excessBlobGas = &excessBlobGas
+		block.blobGasPrice, err = getBlobBaseFee(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+// parseTx 按type解析一个交易，type 3的交易单独解析
+func parseTx(raw json.RawMessage) (*rpcTx, error) {
+	var envelope struct {
+		Type hexutil.Uint64 `json:"type"`
+	}
+	err := json.Unmarshal(raw, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Type == blobTxType {
+		blob := new(blobTx)
+		err = json.Unmarshal(raw, blob)
+		if err != nil {
+			return nil, err
+		}
+		return &rpcTx{hash: blob.Hash, blob: blob}, nil
+	}
+	tx := new(types.Transaction)
+	err = json.Unmarshal(raw, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcTx{hash: tx.Hash(), tx: tx}, nil
+}
+
+// getBlobBaseFee 通过eth_feeHistory获取块的blob gas价格，价格的参数在之后的升级里会调整，不在本地计算
+// 节点不返回baseFeePerBlobGas时返回nil，由blob交易的receipt补上
+func getBlobBaseFee(ctx context.Context, number uint64) (*big.Int, error) {
+	var history struct {
+		BaseFeePerBlobGas []*hexutil.Big `json:"baseFeePerBlobGas"`
+	}
+	err := db.RpcClient.CallContext(ctx, &history, "eth_feeHistory", hexutil.EncodeUint64(1), hexutil.EncodeUint64(number), []float64{})
+	if err != nil {
+		return nil, err
+	}
+	if len(history.BaseFeePerBlobGas) == 0 || history.BaseFeePerBlobGas[0] == nil {
+		return nil, nil
+	}
+	return history.BaseFeePerBlobGas[0].ToInt(), nil
+}
+
+// getBlockHash 获取链上一个块的hash
+func getBlockHash(ctx context.Context, number *big.Int) (common.Hash, error) {
+	var head *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	err := db.RpcClient.CallContext(ctx, &head, "eth_getBlockByNumber", hexutil.EncodeBig(number), false)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if head == nil {
+		return common.Hash{}, ethereum.NotFound
+	}
+	return head.Hash, nil
+}
@@ -0,0 +1,101 @@
+package sync
+
+import (
+	"explorer/store"
+	"strconv"
+	"time"
+)
+
+// Status 同步状态接口的返回
+type Status struct {
+	Checkpoint *store.ESCheckpoint `json:"checkpoint"`
+	Head       uint64              `json:"head"`
+	// 没有同步进度时为0，这时Synced为false
+	Behind uint64 `json:"behind"`
+	// 有同步进度并且落后的块数不超过确认数
+	Synced bool `json:"synced"`
+	// 同步失败还没有补齐的块数，详情见/sync/deadletters
+	DeadLetters int64 `json:"deadLetters"`
+}
+
+// getCheckpoint 读取同步进度，没有同步过时返回nil
+func getCheckpoint() (*store.ESCheckpoint, error) {
+	return store.Repo.GetCheckpoint()
+}
+
+// saveCheckpoint 记录同步进度，只在一批块全部写入成功后调用
+// 后台校验的进度一起写入，重组回滚时不超过回滚后的高度
+func saveCheckpoint(number uint64, blockHash string) error {
+	checkpoint := &store.ESCheckpoint{
+		Number:    strconv.FormatUint(number, 10),
+		BlockHash: blockHash,
+		Time:      uint64(time.Now().Unix()),
+	}
+	if verified, ok := clampVerified(number + 1); ok {
+		checkpoint.VerifiedTo = strconv.FormatUint(verified, 10)
+	}
+	return store.Repo.SaveCheckpoint(checkpoint)
+}
+
+// deleteCheckpoint 重组回滚到创世块之前时清空同步进度
+func deleteCheckpoint() error {
+	clampVerified(0)
+	return store.Repo.DeleteCheckpoint()
+}
+
+// getSyncStart 获取下一个需要同步的高度
+// 没有同步进度时(旧版本的数据)从最后一个入库的块开始重新同步
+func getSyncStart() (uint64, error) {
+	checkpoint, err := getCheckpoint()
+	if err != nil {
+		return 0, err
+	}
+	err = loadVerified(checkpoint)
+	if err != nil {
+		return 0, err
+	}
+	if checkpoint != nil {
+		number, err := strconv.ParseUint(checkpoint.Number, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if lastHash == "" {
+			lastNumber, lastHash = number, checkpoint.BlockHash
+		}
+		return number + 1, nil
+	}
+	start, _, err := store.Repo.LastBlockNumber()
+	return start, err
+}
+
+// GetStatus 获取同步进度和链上最新块
+func GetStatus() (*Status, error) {
+	checkpoint, err := getCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	head, err := getRpcLastBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	deadLetters, err := store.Repo.ListDeadLetters(store.Page{Size: 0})
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{
+		Checkpoint:  checkpoint,
+		Head:        head.Uint64(),
+		DeadLetters: deadLetters.Total,
+	}
+	if checkpoint != nil {
+		number, err := strconv.ParseUint(checkpoint.Number, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if status.Head > number {
+			status.Behind = status.Head - number
+		}
+		status.Synced = status.Behind <= syncConfirmations
+	}
+	return status, nil
+}
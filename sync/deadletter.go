@@ -0,0 +1,33 @@
+package sync
+
+import (
+	"explorer/log"
+	"explorer/store"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// saveDeadLetter 记录同步失败的块
+func saveDeadLetter(number uint64, attempts int, cause error) error {
+	err := store.Repo.SaveDeadLetter(&store.ESDeadLetter{
+		Number:   strconv.FormatUint(number, 10),
+		Error:    cause.Error(),
+		Attempts: attempts,
+		Time:     uint64(time.Now().Unix()),
+	})
+	if err != nil {
+		return err
+	}
+	log.Logger.Error("区块同步失败，已记录死信",
+		zap.Uint64("block", number),
+		zap.Int("attempts", attempts),
+		zap.Error(cause),
+	)
+	return nil
+}
+
+// deleteDeadLetters 块重新同步成功后删除死信
+func deleteDeadLetters(numbers []uint64) error {
+	return store.Repo.DeleteDeadLetters(numbers)
+}
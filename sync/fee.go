@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"explorer/log"
+	"explorer/store"
+	"flag"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+	"math/big"
+	"strconv"
+)
+
+// eip-4844的blob交易类型，geth v1.10.21里还没有这个常量
+const blobTxType = 3
+
+// computeFee 按receipt的gasUsed和实际的gas价格计算手续费，只用到tx文档里已有的字段，重新计算旧数据时也用它
+//
+// 实际的gas价格优先用receipt里的effectiveGasPrice(同步时写入tx的effectiveGasPrice)，l2和自定义费用市场的链可能和按交易字段算出的不一样
+// 没有时按交易类型计算：1559和blob交易是min(maxFeePerGas, baseFee+maxPriorityFeePerGas)，其他交易是gasPrice
+// 燃烧的是baseFee*gasUsed和全部的blob费用，节省的是(maxFeePerGas-实际价格)*gasUsed
+func computeFee(esTx *store.ESTx) (*store.ESTxFee, error) {
+	gasUsed, err := parseFeeField(esTx, "gasUsed", esTx.GasUsed)
+	if err != nil {
+		return nil, err
+	}
+	var baseFee *big.Int
+	if esTx.BaseFee != "" {
+		baseFee, err = parseFeeField(esTx, "baseFeePerGas", esTx.BaseFee)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dynamic := esTx.Type == types.DynamicFeeTxType || esTx.Type == blobTxType
+	var price, feeCap *big.Int
+	if dynamic && baseFee != nil {
+		feeCap, err = parseFeeField(esTx, "maxFeePerGas", esTx.GasFeeCap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if esTx.EffectiveGasPrice != "" {
+		price, err = parseFeeField(esTx, "effectiveGasPrice", esTx.EffectiveGasPrice)
+		if err != nil {
+			return nil, err
+		}
+	} else if dynamic && baseFee != nil {
+		tipCap, err := parseFeeField(esTx, "maxPriorityFeePerGas", esTx.GasTipCap)
+		if err != nil {
+			return nil, err
+		}
+		price = new(big.Int).Add(baseFee, tipCap)
+		if price.Cmp(feeCap) > 0 {
+			price.Set(feeCap)
+		}
+	} else {
+		price, err = parseFeeField(esTx, "gasPrice", esTx.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fee := &store.ESTxFee{Hash: esTx.Hash, EffectiveGasPrice: price.String()}
+	transactionFee := new(big.Int).Mul(gasUsed, price)
+	blobFee := new(big.Int)
+	if esTx.BlobGasUsed != "" && esTx.BlobGasPrice != "" {
+		blobGasUsed, err := parseFeeField(esTx, "blobGasUsed", esTx.BlobGasUsed)
+		if err != nil {
+			return nil, err
+		}
+		blobGasPrice, err := parseFeeField(esTx, "blobGasPrice", esTx.BlobGasPrice)
+		if err != nil {
+			return nil, err
+		}
+		blobFee.Mul(blobGasUsed, blobGasPrice)
+		fee.BlobFee = blobFee.String()
+		transactionFee.Add(transactionFee, blobFee)
+	}
+	fee.TransactionFee = transactionFee.String()
+	if baseFee != nil {
+		burntFees := new(big.Int).Mul(baseFee, gasUsed)
+		fee.BurntFees = burntFees.Add(burntFees, blobFee).String()
+		if dynamic {
+			txSavingsFee := new(big.Int).Sub(feeCap, price)
+			if txSavingsFee.Sign() < 0 {
+				txSavingsFee.SetInt64(0)
+			}
+			fee.TxSavingsFee = txSavingsFee.Mul(txSavingsFee, gasUsed).String()
+		}
+	}
+	return fee, nil
+}
+
+func parseFeeField(esTx *store.ESTx, field string, value string) (*big.Int, error) {
+	number, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, errors.New("交易的" + field + "格式错误:" + esTx.Hash)
+	}
+	return number, nil
+}
+
+// RecomputeFees 按computeFee重新计算已经写入的交易的手续费，只更新结果不一样的交易
+//
+//	./main fees                  重新计算到同步进度的所有交易
+//	./main fees -from 0 -to 100  只重新计算[from, to]高度的交易
+func RecomputeFees(args []string) error {
+	flags := flag.NewFlagSet("fees", flag.ExitOnError)
+	from := flags.Uint64("from", 0, "开始高度")
+	to := flags.Uint64("to", 0, "结束高度(含)，为0时到同步进度")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	end := *to
+	if end == 0 {
+		checkpoint, err := getCheckpoint()
+		if err != nil {
+			return err
+		}
+		if checkpoint == nil {
+			return errors.New("还没有同步进度")
+		}
+		end, err = strconv.ParseUint(checkpoint.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	if *from > end {
+		return errors.New("from不能大于to")
+	}
+	var total, updated, skipped int
+	for start := *from; start <= end; start += verifyWindow {
+		windowEnd := start + verifyWindow - 1
+		if windowEnd > end {
+			windowEnd = end
+		}
+		_, txCounts, err := store.Repo.BlockTxCounts(start, windowEnd)
+		if err != nil {
+			return err
+		}
+		var fees []*store.ESTxFee
+		for number := start; number <= windowEnd; number++ {
+			count := txCounts[number]
+			if count == 0 {
+				continue
+			}
+			result, err := store.Repo.ListTxs(store.Page{Size: count}, strconv.FormatUint(number, 10), "")
+			if err != nil {
+				return err
+			}
+			for _, doc := range result.Hits {
+				esTx := new(store.ESTx)
+				err = json.Unmarshal(doc.Source, esTx)
+				if err != nil {
+					return err
+				}
+				total++
+				fee, err := computeFee(esTx)
+				if err != nil {
+					skipped++
+					log.Logger.Warn("无法计算交易的手续费", zap.String("hash", doc.Id), zap.Error(err))
+					continue
+				}
+				if *fee != *esTx.Fee() {
+					fees = append(fees, fee)
+				}
+			}
+		}
+		err = store.Repo.UpdateTxFees(fees)
+		if err != nil {
+			return err
+		}
+		updated += len(fees)
+		log.Logger.Info("重新计算手续费",
+			zap.Uint64("from", start),
+			zap.Uint64("to", windowEnd),
+			zap.Int("updated", len(fees)),
+		)
+	}
+	log.Logger.Info("重新计算手续费完成",
+		zap.Int("txs", total),
+		zap.Int("updated", updated),
+		zap.Int("skipped", skipped),
+	)
+	return nil
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"explorer/store"
+	"testing"
+)
+
+func TestComputeFee(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   store.ESTx
+		want store.ESTxFee
+	}{
+		{
+			name: "legacy before london",
+			tx:   store.ESTx{Type: 0, GasPrice: "20", GasUsed: "21000"},
+			want: store.ESTxFee{TransactionFee: "420000", EffectiveGasPrice: "20"},
+		},
+		{
+			name: "legacy after london",
+			tx:   store.ESTx{Type: 0, GasPrice: "20", GasUsed: "21000", BaseFee: "15"},
+			want: store.ESTxFee{TransactionFee: "420000", EffectiveGasPrice: "20", BurntFees: "315000"},
+		},
+		{
+			name: "1559 base fee plus tip",
+			tx:   store.ESTx{Type: 2, GasFeeCap: "100", GasTipCap: "2", GasUsed: "1000", BaseFee: "10"},
+			want: store.ESTxFee{TransactionFee: "12000", EffectiveGasPrice: "12", BurntFees: "10000", TxSavingsFee: "88000"},
+		},
+		{
+			name: "1559 capped by max fee",
+			tx:   store.ESTx{Type: 2, GasFeeCap: "11", GasTipCap: "5", GasUsed: "1000", BaseFee: "10"},
+			want: store.ESTxFee{TransactionFee: "11000", EffectiveGasPrice: "11", BurntFees: "10000", TxSavingsFee: "0"},
+		},
+		{
+			name: "1559 receipt effective gas price",
+			tx:   store.ESTx{Type: 2, GasFeeCap: "100", GasTipCap: "2", GasUsed: "1000", BaseFee: "10", EffectiveGasPrice: "30"},
+			want: store.ESTxFee{TransactionFee: "30000", EffectiveGasPrice: "30", BurntFees: "10000", TxSavingsFee: "70000"},
+		},
+		{
+			name: "blob",
+			tx: store.ESTx{Type: blobTxType, GasFeeCap: "100", GasTipCap: "3", GasUsed: "21000", BaseFee: "10",
+				BlobGasUsed: "131072", BlobGasPrice: "7"},
+			want: store.ESTxFee{TransactionFee: "1190504", EffectiveGasPrice: "13", BurntFees: "1127504",
+				TxSavingsFee: "1827000", BlobFee: "917504"},
+		},
+		{
+			name: "blob receipt effective gas price",
+			tx: store.ESTx{Type: blobTxType, GasFeeCap: "100", GasTipCap: "3", GasUsed: "21000", BaseFee: "10",
+				BlobGasUsed: "131072", BlobGasPrice: "7", EffectiveGasPrice: "12"},
+			want: store.ESTxFee{TransactionFee: "1169504", EffectiveGasPrice: "12", BurntFees: "1127504",
+				TxSavingsFee: "1848000", BlobFee: "917504"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee, err := computeFee(&tt.tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *fee != tt.want {
+				t.Errorf("computeFee() = %+v, want %+v", *fee, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeFeeMalformed(t *testing.T) {
+	tests := []store.ESTx{
+		{Type: 0, GasPrice: "20", GasUsed: ""},
+		{Type: 0, GasPrice: "0x14", GasUsed: "21000"},
+		{Type: 2, GasFeeCap: "", GasTipCap: "2", GasUsed: "1000", BaseFee: "10"},
+		{Type: 2, GasFeeCap: "100", GasTipCap: "2", GasUsed: "1000", BaseFee: "10", EffectiveGasPrice: "x"},
+		{Type: blobTxType, GasFeeCap: "100", GasTipCap: "3", GasUsed: "21000", BaseFee: "10", BlobGasUsed: "a", BlobGasPrice: "7"},
+	}
+	for i, tx := range tests {
+		_, err := computeFee(&tx)
+		if err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/db"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/core/types"
+	"os"
+	stdsync "sync"
+)
+
+// block和tx的确认状态
+const (
+	FinalityPending   = "pending"
+	FinalitySafe      = "safe"
+	FinalityFinalized = "finalized"
+)
+
+// SYNC_CONFIRMATIONS 只同步确认数达到这个值的块
+// SYNC_FOLLOW_TAG 设置为safe或finalized时只同步到节点对应标签的块
+var (
+	syncConfirmations = uint64(envInt("SYNC_CONFIRMATIONS", 0))
+	syncFollowTag     = os.Getenv("SYNC_FOLLOW_TAG")
+)
+
+// finalityMarks 当前safe和finalized的高度，ok为false表示还没有块达到对应状态
+type finalityMarks struct {
+	safe        uint64
+	safeOk      bool
+	finalized   uint64
+	finalizedOk bool
+}
+
+// 已经写入的状态进度，下一个需要标记的高度
+var (
+	finalityLoaded bool
+	nextSafe       uint64
+	nextFinalized  uint64
+)
+
+// currentMarks 写入新块时使用的safe和finalized高度，同步、校验补块和重建索引会同时读写
+var (
+	marksMu      stdsync.Mutex
+	currentMarks finalityMarks
+)
+
+func setCurrentMarks(marks finalityMarks) {
+	marksMu.Lock()
+	defer marksMu.Unlock()
+	currentMarks = marks
+}
+
+func getCurrentMarks() finalityMarks {
+	marksMu.Lock()
+	defer marksMu.Unlock()
+	return currentMarks
+}
+
+// getTagNumber 获取节点safe或finalized标签对应的高度，节点不支持时返回false
+func getTagNumber(tag string) (uint64, bool) {
+	var header *types.Header
+	err := db.RpcClient.CallContext(context.Background(), &header, "eth_getBlockByNumber", tag, false)
+	if err != nil || header == nil || header.Number == nil {
+		return 0, false
+	}
+	return header.Number.Uint64(), true
+}
+
+// getFinalityMarks 获取safe和finalized的高度，节点不支持标签时按确认数计算
+func getFinalityMarks(head uint64) finalityMarks {
+	var marks finalityMarks
+	marks.finalized, marks.finalizedOk = getTagNumber(FinalityFinalized)
+	marks.safe, marks.safeOk = getTagNumber(FinalitySafe)
+	if !marks.finalizedOk && syncConfirmations > 0 && head >= syncConfirmations {
+		marks.finalized, marks.finalizedOk = head-syncConfirmations, true
+	}
+	if !marks.safeOk {
+		marks.safe, marks.safeOk = marks.finalized, marks.finalizedOk
+	}
+	return marks
+}
+
+// getSyncTarget 根据确认数和跟随的标签计算这次同步到的高度
+func getSyncTarget(head uint64, marks finalityMarks) (uint64, error) {
+	if head < syncConfirmations {
+		return 0, errors.New("链上的块数小于确认数")
+	}
+	target := head - syncConfirmations
+	switch syncFollowTag {
+	case FinalitySafe:
+		if !marks.safeOk {
+			return 0, errors.New("节点不支持safe标签")
+		}
+		if marks.safe < target {
+			target = marks.safe
+		}
+	case FinalityFinalized:
+		if !marks.finalizedOk {
+			return 0, errors.New("节点不支持finalized标签")
+		}
+		if marks.finalized < target {
+			target = marks.finalized
+		}
+	}
+	return target, nil
+}
+
+// getFinality 新写入的块的状态
+func getFinality(number uint64) string {
+	marks := getCurrentMarks()
+	if marks.finalizedOk && number <= marks.finalized {
+		return FinalityFinalized
+	}
+	if marks.safeOk && number <= marks.safe {
+		return FinalitySafe
+	}
+	return FinalityPending
+}
+
+func loadFinality() error {
+	finalized, ok, err := store.Repo.LastFinalityNumber(FinalityFinalized)
+	if err != nil {
+		return err
+	}
+	if ok {
+		nextFinalized = finalized + 1
+	}
+	safe, ok, err := store.Repo.LastFinalityNumber(FinalitySafe)
+	if err != nil {
+		return err
+	}
+	if ok {
+		nextSafe = safe + 1
+	}
+	if nextSafe < nextFinalized {
+		nextSafe = nextFinalized
+	}
+	finalityLoaded = true
+	return nil
+}
+
+// resetFinality 重组回滚后，共同祖先之后重新写入的块还没有标记，下一个需要标记的高度退回到next
+func resetFinality(next uint64) {
+	if nextFinalized > next {
+		nextFinalized = next
+	}
+	if nextSafe > next {
+		nextSafe = next
+	}
+}
+
+// updateFinality 随着链的推进把已入库的block和tx标记为safe或finalized
+// synced是已经同步到的高度，超过的部分等写入时再标记
+func updateFinality(marks finalityMarks, synced uint64) error {
+	setCurrentMarks(marks)
+	if !finalityLoaded {
+		err := loadFinality()
+		if err != nil {
+			return err
+		}
+	}
+	if marks.finalizedOk {
+		end := marks.finalized
+		if end > synced {
+			end = synced
+		}
+		if nextFinalized <= end {
+			err := setFinality(nextFinalized, end, FinalityFinalized)
+			if err != nil {
+				return err
+			}
+			nextFinalized = end + 1
+		}
+	}
+	if nextSafe < nextFinalized {
+		nextSafe = nextFinalized
+	}
+	if marks.safeOk {
+		end := marks.safe
+		if end > synced {
+			end = synced
+		}
+		if nextSafe <= end {
+			err := setFinality(nextSafe, end, FinalitySafe)
+			if err != nil {
+				return err
+			}
+			nextSafe = end + 1
+		}
+	}
+	return nil
+}
+
+// setFinality 把[start, end]高度的block和tx设置为finality
+func setFinality(start uint64, end uint64, finality string) error {
+	return store.Repo.SetFinality(start, end, finality)
+}
@@ -0,0 +1,63 @@
+package sync
+
+import (
+	"context"
+	"explorer/db"
+	"explorer/log"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 轮询间隔，订阅正常时新块到达会提前唤醒
+const pollInterval = time.Second * 5
+
+// 订阅断开后重连的间隔
+const resubscribeInterval = time.Second * 5
+
+// followHeads 订阅newHeads，有新块时通知同步，订阅断开后自动重连
+// 断开期间同步靠pollInterval轮询
+func followHeads(notify chan<- struct{}) {
+	if db.SubscribeClient == nil {
+		return
+	}
+	for {
+		heads := make(chan *types.Header)
+		sub, err := db.SubscribeClient.SubscribeNewHead(context.Background(), heads)
+		if err != nil {
+			log.Logger.Warn("订阅新块失败，使用轮询", zap.Error(err))
+			time.Sleep(resubscribeInterval)
+			continue
+		}
+		log.Logger.Info("已订阅新块")
+		watchHeads(sub.Err(), heads, notify)
+		sub.Unsubscribe()
+		time.Sleep(resubscribeInterval)
+	}
+}
+
+func watchHeads(errs <-chan error, heads <-chan *types.Header, notify chan<- struct{}) {
+	for {
+		select {
+		case err := <-errs:
+			log.Logger.Warn("新块订阅断开，使用轮询", zap.Error(err))
+			return
+		case <-heads:
+			// 同步还没处理完上一次通知时不用重复通知
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// waitForHead 等待新块通知或者轮询超时
+func waitForHead(notify <-chan struct{}) {
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+	select {
+	case <-notify:
+	case <-timer.C:
+	}
+}
@@ -1,182 +1,23 @@
 package sync
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"explorer/db"
+	"explorer/decode"
 	"explorer/log"
-	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"explorer/store"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"io"
+	"go.uber.org/zap"
 	"math/big"
-	"os"
-	"strings"
 	"time"
 )
 
-type ESBlock struct {
-	ParentHash  string      `json:"parentHash"`
-	UncleHash   string      `json:"sha3Uncles"`
-	Coinbase    string      `json:"miner"`
-	Root        string      `json:"stateRoot"`
-	TxHash      string      `json:"transactionsRoot"`
-	ReceiptHash string      `json:"receiptsRoot"`
-	Bloom       types.Bloom `json:"logsBloom"`
-	Difficulty  string      `json:"difficulty"`
-	Number      string      `json:"number"`
-	GasLimit    string      `json:"gasLimit"`
-	GasUsed     string      `json:"gasUsed"`
-	Time        uint64      `json:"timestamp"`
-	Extra       []byte      `json:"extraData"`
-	MixDigest   string      `json:"mixHash"`
-	Nonce       uint64      `json:"nonce"`
-
-	// BaseFee was added by EIP-1559 and is ignored in legacy headers.
-	BaseFee string `json:"baseFeePerGas" rlp:"optional"`
-
-	Txns      int    `json:"txns"`
-	BlockHash string `json:"blockHash"`
-	Size      string `json:"size"`
-	BurntFees string `json:"burntFees"`
-}
-
-type ESTx struct {
-	Type       byte             `json:"type"`
-	Nonce      string           `json:"nonce"`
-	GasPrice   string           `json:"gasPrice"`
-	GasTipCap  string           `json:"maxPriorityFeePerGas"`
-	GasFeeCap  string           `json:"maxFeePerGas"`
-	Gas        string           `json:"gasLimit"`
-	Value      string           `json:"value"`
-	Data       []byte           `json:"input"`
-	Number     string           `json:"number"`
-	V          string           `json:"v"`
-	R          string           `json:"r"`
-	S          string           `json:"s"`
-	To         string           `json:"to"`
-	Hash       string           `json:"hash"`
-	Time       uint64           `json:"timestamp"`
-	From       string           `json:"from"`
-	AccessList types.AccessList `json:"accessList"`
-	IsFake     bool             `json:"isFake"`
-	BaseFee    string           `json:"baseFeePerGas" rlp:"optional"`
-
-	// receipt
-	ReceiptType       uint8        `json:"receiptType"`
-	PostState         []byte       `json:"postState"`
-	Status            string       `json:"status"`
-	CumulativeGasUsed string       `json:"cumulativeGasUsed"`
-	Bloom             types.Bloom  `json:"logsBloom"`
-	Logs              []*types.Log `json:"logs"`
-	LogLength         uint64       `json:"logLength"`
-
-	// Implementation fields: These fields are added by geth when processing a transaction.
-	// They are stored in the chain database.
-	TxHash          string `json:"transactionHash"`
-	ContractAddress string `json:"contractAddress"`
-	GasUsed         string `json:"gasUsed"`
-
-	// Inclusion information: These fields provide information about the inclusion of the
-	// transaction corresponding to this receipt.
-	BlockHash        string `json:"blockHash"`
-	BlockNumber      string `json:"blockNumber"`
-	TransactionIndex uint   `json:"transactionIndex"`
-	TransactionFee   string `json:"transactionFee"`
-	// 1559
-	BurntFees    string `json:"burntFees"`
-	TxSavingsFee string `json:"txSavingsFee"`
-
-	Reason string `json:"reason"`
-}
-
-type ESAddress struct {
-	address string `json:"address"`
-	Type    uint8  `json:"type"`
-}
-type ESBlockHit1 struct {
-	Source ESBlock `json:"_source"`
-	Index  string  `json:"_index"`
-	Type   string  `json:"_type"`
-	Id     string  `json:"_id"`
-	Score  string  `json:"_score"`
-}
-
-type ESTotal struct {
-	Value    int64  `json:"value"`
-	Relation string `json:"relation"`
-}
-type ESBlockHit2 struct {
-	Hits  []ESBlockHit1 `json:"hits"`
-	Total ESTotal       `json:"total"`
-}
-type ESShards struct {
-	Total      int64 `json:"total"`
-	Successful int64 `json:"successful"`
-	Skipped    int64 `json:"skipped"`
-	Failed     int64 `json:"failed"`
-}
-type ESBlockRes struct {
-	Took     int64       `json:"took"`
-	TimedOut bool        `json:"timed_out"`
-	Shards   ESShards    `json:"_shards"`
-	Hits     ESBlockHit2 `json:"hits"`
-}
-
 var emptyContractAddress = "0x0000000000000000000000000000000000000000"
 
-var searchBlock = []string{"block"}
-
-func getEsLastBlockNumber() (string, error) {
-	if db.EsClient != nil {
-		var startStr = "0"
-		size := 1
-		from := 0
-		_body := `{
-		"sort": [
-		   {
-			 "timestamp":{
-			   "order": "desc"
-			 }
-		   }
-		 ]
-	   }`
-		blockReq := esapi.SearchRequest{
-			Index: searchBlock,
-			Size:  &size,
-			From:  &from,
-			Body:  strings.NewReader(_body),
-		}
-		esBlockResponse, err := blockReq.Do(context.Background(), db.EsClient)
-		if err != nil {
-			startStr = "0"
-		}
-		defer esBlockResponse.Body.Close()
-		if esBlockResponse.StatusCode >= 300 {
-			startStr = "0"
-		} else {
-			byt, err := io.ReadAll(esBlockResponse.Body)
-
-			if err != nil {
-				return "", errors.New("查询block失败")
-			}
-			var esBlockRes ESBlockRes
-			err = json.Unmarshal(byt, &esBlockRes)
-			if err != nil {
-				startStr = "0"
-			} else {
-				startStr = esBlockRes.Hits.Hits[0].Source.Number
-			}
-
-		}
-		return startStr, nil
-	} else {
-		return "", errors.New("es数据库未连接")
-	}
-
-}
 func getRpcLastBlockNumber() (*big.Int, error) {
 	if db.EthClient != nil {
 		num, err := db.EthClient.BlockNumber(context.Background())
@@ -186,11 +27,10 @@ func getRpcLastBlockNumber() (*big.Int, error) {
 		return nil, errors.New("rpc未连接")
 	}
 }
-func buildEsBlock(block *types.Block) *ESBlock {
-	header := block.Header()
-	body := block.Body()
-	txLength := len(body.Transactions)
-	esBlock := new(ESBlock)
+func buildEsBlock(block *rpcBlock) *store.ESBlock {
+	header := block.header
+	txLength := len(block.txs)
+	esBlock := new(store.ESBlock)
 	esBlock.ParentHash = header.ParentHash.String()
 	esBlock.UncleHash = header.UncleHash.String()
 	esBlock.Coinbase = header.Coinbase.String()
@@ -216,8 +56,8 @@ func buildEsBlock(block *types.Block) *ESBlock {
 	}
 
 	esBlock.Txns = txLength
-	esBlock.BlockHash = block.Hash().String()
-	esBlock.Size = block.Size().String()
+	esBlock.BlockHash = block.hash.String()
+	esBlock.Size = common.StorageSize(block.size).String()
 	//1559
 	if header.BaseFee != nil {
 		burntFees := new(big.Int)
@@ -226,32 +66,21 @@ func buildEsBlock(block *types.Block) *ESBlock {
 	} else {
 		// todo
 	}
-	return esBlock
-}
-func createEsBlock(block *ESBlock) error {
-	blockBuf, err := json.Marshal(block)
-	if err != nil {
-		return err
-	}
-
-	blockReq := esapi.IndexRequest{
-		Index:      "block",
-		DocumentID: block.Number,
-		Body:       bytes.NewReader(blockBuf),
-	}
-
-	blockRes, blockErr := blockReq.Do(context.Background(), db.EsClient)
-	if blockErr != nil {
-		return err
-	}
-	defer blockRes.Body.Close()
-	if blockRes.StatusCode >= 300 {
-		return errors.New("http:es写入block出错")
+	//4844
+	if block.excessBlobGas != nil {
+		esBlock.BlobCount = block.blobCount()
+		esBlock.ExcessBlobGas = new(big.Int).SetUint64(*block.excessBlobGas).String()
+		if block.blobGasUsed != nil {
+			esBlock.BlobGasUsed = new(big.Int).SetUint64(*block.blobGasUsed).String()
+		}
+		if block.blobGasPrice != nil {
+			esBlock.BlobGasPrice = block.blobGasPrice.String()
+		}
 	}
-	return nil
+	return esBlock
 }
-func buildTx(tx *types.Transaction, header *types.Header) (*ESTx, error) {
-	esTx := new(ESTx)
+func buildTx(tx *types.Transaction, block *rpcBlock, receipt *rpcReceipt) (*store.ESTx, error) {
+	esTx := new(store.ESTx)
 	esTx.Type = tx.Type()
 
 	esTx.Nonce = new(big.Int).SetUint64(tx.Nonce()).String()
@@ -275,11 +104,6 @@ func buildTx(tx *types.Transaction, header *types.Header) (*ESTx, error) {
 	}
 
 	esTx.Data = tx.Data()
-	number := header.Number
-	if number != nil {
-		esTx.Number = header.Number.String()
-	}
-
 	to := tx.To()
 	if to != nil {
 		esTx.To = to.String()
@@ -298,11 +122,6 @@ func buildTx(tx *types.Transaction, header *types.Header) (*ESTx, error) {
 		esTx.S = s.String()
 	}
 
-	esTx.Time = header.Time
-	baseFee := header.BaseFee
-	if baseFee != nil {
-		esTx.BaseFee = baseFee.String()
-	}
 	// todo 为什么解析 需要用到chainId
 	msg, err := tx.AsMessage(types.LatestSignerForChainID(tx.ChainId()), gasPrice)
 	if err != nil {
@@ -312,10 +131,113 @@ func buildTx(tx *types.Transaction, header *types.Header) (*ESTx, error) {
 	esTx.IsFake = msg.IsFake()
 	esTx.AccessList = msg.AccessList()
 	esTx.From = msg.From().String()
-	receipt, err := db.EthClient.TransactionReceipt(context.Background(), tx.Hash())
+	call := ethereum.CallMsg{
+		From:       msg.From(),
+		To:         tx.To(),
+		Gas:        tx.Gas(),
+		GasPrice:   tx.GasPrice(),
+		GasFeeCap:  gasFeeCap,
+		GasTipCap:  gasTipCap,
+		Value:      tx.Value(),
+		Data:       tx.Data(),
+		AccessList: tx.AccessList(),
+	}
+	err = buildReceipt(esTx, block, receipt, call)
 	if err != nil {
 		return nil, err
 	}
+	return esTx, nil
+}
+
+// buildBlobTx 构建type 3的blob交易，geth v1.10.21没有这种交易类型，字段直接取节点返回的json
+// gasPrice和1559交易一样是maxFeePerGas
+func buildBlobTx(tx *blobTx, block *rpcBlock, receipt *rpcReceipt) (*store.ESTx, error) {
+	esTx := new(store.ESTx)
+	esTx.Type = blobTxType
+	esTx.Nonce = new(big.Int).SetUint64(uint64(tx.Nonce)).String()
+	if tx.MaxFeePerGas != nil {
+		esTx.GasPrice = tx.MaxFeePerGas.ToInt().String()
+		esTx.GasFeeCap = esTx.GasPrice
+	}
+	if tx.MaxPriorityFeePerGas != nil {
+		esTx.GasTipCap = tx.MaxPriorityFeePerGas.ToInt().String()
+	}
+	if tx.MaxFeePerBlobGas != nil {
+		esTx.MaxFeePerBlobGas = tx.MaxFeePerBlobGas.ToInt().String()
+	}
+	esTx.Gas = new(big.Int).SetUint64(uint64(tx.Gas)).String()
+	if tx.Value != nil {
+		esTx.Value = tx.Value.ToInt().String()
+	}
+	esTx.Data = tx.Input
+	if tx.To != nil {
+		esTx.To = tx.To.String()
+	}
+	esTx.Hash = tx.Hash.String()
+	if tx.V != nil {
+		esTx.V = tx.V.ToInt().String()
+	}
+	if tx.R != nil {
+		esTx.R = tx.R.ToInt().String()
+	}
+	if tx.S != nil {
+		esTx.S = tx.S.ToInt().String()
+	}
+	esTx.AccessList = tx.AccessList
+	esTx.From = tx.From.String()
+	esTx.BlobVersionedHashes = make([]string, 0, len(tx.BlobVersionedHashes))
+	for _, hash := range tx.BlobVersionedHashes {
+		esTx.BlobVersionedHashes = append(esTx.BlobVersionedHashes, hash.String())
+	}
+	esTx.BlobGasUsed = new(big.Int).SetUint64(uint64(len(tx.BlobVersionedHashes)) * gasPerBlob).String()
+	if receipt.BlobGasUsed != nil {
+		esTx.BlobGasUsed = new(big.Int).SetUint64(uint64(*receipt.BlobGasUsed)).String()
+	}
+	if receipt.BlobGasPrice != nil {
+		esTx.BlobGasPrice = receipt.BlobGasPrice.ToInt().String()
+	} else if block.blobGasPrice != nil {
+		esTx.BlobGasPrice = block.blobGasPrice.String()
+	}
+
+	// 重放失败交易时没有blob，合约里读到的blobhash是0
+	call := ethereum.CallMsg{
+		From:       tx.From,
+		To:         tx.To,
+		Gas:        uint64(tx.Gas),
+		GasFeeCap:  (*big.Int)(tx.MaxFeePerGas),
+		GasTipCap:  (*big.Int)(tx.MaxPriorityFeePerGas),
+		Value:      (*big.Int)(tx.Value),
+		Data:       tx.Input,
+		AccessList: tx.AccessList,
+	}
+	err := buildReceipt(esTx, block, receipt, call)
+	if err != nil {
+		return nil, err
+	}
+	return esTx, nil
+}
+
+// buildReceipt 填充块、receipt和手续费相关的字段，交易失败时用call重放获取revert数据
+func buildReceipt(esTx *store.ESTx, block *rpcBlock, receipt *rpcReceipt, call ethereum.CallMsg) error {
+	header := block.header
+	number := header.Number
+	if number != nil {
+		esTx.Number = header.Number.String()
+	}
+	if esTx.To != "" && len(esTx.Data) >= 4 {
+		esTx.MethodId = hexutil.Encode(esTx.Data[:4])
+		methodName, err := decode.MethodName(esTx.Data)
+		if err != nil {
+			return err
+		}
+		esTx.MethodName = methodName
+	}
+
+	esTx.Time = header.Time
+	baseFee := header.BaseFee
+	if baseFee != nil {
+		esTx.BaseFee = baseFee.String()
+	}
 	esTx.ReceiptType = receipt.Type
 	esTx.PostState = receipt.PostState
 	esTx.Status = new(big.Int).SetUint64(receipt.Status).String()
@@ -332,317 +254,122 @@ func buildTx(tx *types.Transaction, header *types.Header) (*ESTx, error) {
 		esTx.BlockNumber = blockNumber.String()
 	}
 	if receipt.Status == 0 {
-		msg := ethereum.CallMsg{
-			From:       msg.From(),
-			To:         tx.To(),
-			Gas:        tx.Gas(),
-			GasPrice:   tx.GasPrice(),
-			GasFeeCap:  gasFeeCap,
-			GasTipCap:  gasTipCap,
-			Value:      tx.Value(),
-			Data:       tx.Data(),
-			AccessList: tx.AccessList(),
-		}
-		_, err := db.EthClient.CallContractAtHash(context.Background(), msg, receipt.BlockHash)
+		_, err := db.EthClient.CallContractAtHash(context.Background(), call, receipt.BlockHash)
 		if err != nil {
 			esTx.Reason = err.Error()
+			esTx.Revert, err = decode.DecodeRevert(esTx.To, revertData(err), err.Error())
+			if err != nil {
+				return err
+			}
 		}
 	}
 	esTx.TransactionIndex = receipt.TransactionIndex
 
-	// 1559
-	if header.BaseFee != nil {
-		// 交易费
-		transactionFee := new(big.Int)
-		transactionFee.Add(header.BaseFee, gasTipCap)
-		transactionFee.Mul(transactionFee, new(big.Int).SetUint64(tx.Gas()))
-		esTx.TransactionFee = transactionFee.String()
-		// Savings Fees
-		txSavingsFee := new(big.Int)
-		txSavingsFee.Sub(gasFeeCap, gasTipCap)
-		txSavingsFee.Sub(txSavingsFee, header.BaseFee)
-		txSavingsFee.Mul(transactionFee, new(big.Int).SetUint64(tx.Gas()))
-		esTx.TxSavingsFee = txSavingsFee.String()
-		burntFees := new(big.Int)
-		burntFees.Mul(header.BaseFee, new(big.Int).SetUint64(tx.Gas()))
-		esTx.BurntFees = burntFees.String()
-	} else {
-		transactionFee := new(big.Int)
-		transactionFee.Mul(gasPrice, new(big.Int).SetUint64(tx.Gas()))
-		esTx.TransactionFee = transactionFee.String()
+	if receipt.EffectiveGasPrice != nil {
+		esTx.EffectiveGasPrice = receipt.EffectiveGasPrice.ToInt().String()
+	}
+	fee, err := computeFee(esTx)
+	if err != nil {
+		return err
 	}
+	esTx.SetFee(fee)
 	if receipt.ContractAddress.String() != emptyContractAddress {
 		esTx.ContractAddress = receipt.ContractAddress.String()
 	}
-	return esTx, nil
-}
-func buildAddress(address string, _type uint8) *ESAddress {
-	esAddress := new(ESAddress)
-	esAddress.Type = _type
-	esAddress.address = address
-
-	return esAddress
+	return nil
 }
-func bulkBuildTx(block *types.Block) (*bytes.Buffer, []string, []string, error) {
 
-	body := block.Body()
-	header := block.Header()
-	length := len(body.Transactions)
+// buildTxs 构建block里所有的tx，同时返回涉及到的地址和新建的合约
+func buildTxs(ctx context.Context, block *rpcBlock) ([]*store.ESTx, []string, []string, error) {
+	var esTxs []*store.ESTx
 	var contractArray []string
 	var addressArray []string
-	if length > 0 {
-		// 创建tx的body
-		txBuf := new(bytes.Buffer)
-		// 创建address的body
-		//addressBuf := new(bytes.Buffer)
-		for _, tx := range body.Transactions {
-			createLine := map[string]interface{}{
-				"create": map[string]interface{}{
-					"_index": "tx",
-					"_id":    tx.Hash(),
-				},
-			}
-			createStr, err := json.Marshal(createLine)
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			txBuf.Write(createStr)
-			txBuf.WriteByte('\n')
-			esTx, err := buildTx(tx, header)
-			addressArray = append(addressArray, esTx.From)
-			if esTx.To != "" {
-				addressArray = append(addressArray, esTx.To)
-			}
-
-			if esTx.ContractAddress != "" && esTx.ContractAddress != emptyContractAddress {
-				contractArray = append(contractArray, esTx.ContractAddress)
-			}
-
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			paramsStr, paramsErr := json.Marshal(esTx)
-			if paramsErr != nil {
-				return nil, nil, nil, err
+	receipts, err := getBlockReceipts(ctx, block)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// 节点的eth_feeHistory不返回blob gas价格时用blob交易的receipt里的
+	if block.excessBlobGas != nil && block.blobGasPrice == nil {
+		for _, receipt := range receipts {
+			if receipt.BlobGasPrice != nil {
+				block.blobGasPrice = receipt.BlobGasPrice.ToInt()
+				break
 			}
-			txBuf.Write(paramsStr)
-			txBuf.WriteByte('\n')
 		}
-		return txBuf, addressArray, contractArray, nil
-	} else {
-
-		return nil, addressArray, contractArray, nil
 	}
-}
-func bulkBuildAddress(address map[string]bool, contract map[string]bool) (*bytes.Buffer, error) {
-	addressBuf := new(bytes.Buffer)
-	for _address, bool := range address {
-		if bool {
-			createLine := map[string]interface{}{
-				"create": map[string]interface{}{
-					"_index": "address",
-					"_id":    _address,
-				},
-			}
-			createStr, err := json.Marshal(createLine)
-			if err != nil {
-				return nil, err
-			}
-
-			addressBuf.Write(createStr)
-			addressBuf.WriteByte('\n')
-			esAddress := buildAddress(_address, 1)
-			paramsStr, paramsErr := json.Marshal(esAddress)
-			if paramsErr != nil {
-				return nil, err
-			}
-			addressBuf.Write(paramsStr)
-			addressBuf.WriteByte('\n')
+	for i, tx := range block.txs {
+		var esTx *store.ESTx
+		if tx.blob != nil {
+			esTx, err = buildBlobTx(tx.blob, block, receipts[i])
+		} else {
+			esTx, err = buildTx(tx.tx, block, receipts[i])
 		}
-	}
-
-	for _contract, bool := range contract {
-		if bool {
-			createLine := map[string]interface{}{
-				"create": map[string]interface{}{
-					"_index": "address",
-					"_id":    _contract,
-				},
-			}
-			createStr, err := json.Marshal(createLine)
-			if err != nil {
-				return nil, err
-			}
-
-			addressBuf.Write(createStr)
-			addressBuf.WriteByte('\n')
-			esAddress := buildAddress(_contract, 2)
-			paramsStr, paramsErr := json.Marshal(esAddress)
-			if paramsErr != nil {
-				return nil, err
-			}
-			addressBuf.Write(paramsStr)
-			addressBuf.WriteByte('\n')
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		addressArray = append(addressArray, esTx.From)
+		if esTx.To != "" {
+			addressArray = append(addressArray, esTx.To)
 		}
+		if esTx.ContractAddress != "" && esTx.ContractAddress != emptyContractAddress {
+			contractArray = append(contractArray, esTx.ContractAddress)
+		}
+		esTxs = append(esTxs, esTx)
 	}
-
-	return addressBuf, nil
-
+	return esTxs, addressArray, contractArray, nil
 }
 
-func bulkCreate(buf *bytes.Buffer) (string, error) {
-	if buf != nil && buf.Len() > 0 {
-
-		req := esapi.BulkRequest{
-			Body: bytes.NewReader(buf.Bytes()),
-		}
-		res, err := req.Do(context.Background(), db.EsClient)
-
+func Sync() {
+	notify := make(chan struct{}, 1)
+	go followHeads(notify)
+	go verifyLoop()
+	failures := 0
+	for {
+		err := syncToHead()
 		if err != nil {
-			return "", err
-		}
-		defer res.Body.Close()
-		if res.StatusCode >= 300 {
-			return "", errors.New("批量写入http返回报错")
-		} else {
-			return "", nil
+			// 出错时不退出进程，退避后重新同步，接口照常提供服务
+			delay := backoff(failures)
+			failures++
+			log.Logger.Error("同步出错，稍后重试",
+				zap.Int("failures", failures),
+				zap.Duration("delay", delay),
+				zap.Error(err),
+			)
+			time.Sleep(delay)
+			continue
 		}
+		failures = 0
+		waitForHead(notify)
 	}
-	return "", nil
 }
-func getAddressListByList(list []string) (*db.EsSearchResponse, error) {
-	body := map[string]interface{}{
-		"query": map[string]interface{}{
-			"ids": map[string]interface{}{
-				"values": list,
-			},
-		},
-	}
 
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(body)
-	if err != nil {
-		return nil, err
+// syncToHead 把es同步到链上的最新块
+func syncToHead() error {
+	if store.Repo == nil || db.EthClient == nil {
+		return errors.New("存储或rpc未连接")
 	}
-	listReq := esapi.SearchRequest{
-		Index: []string{"address"},
-		Body:  &buf,
+	// 获取 数据库的同步进度
+	start, err := getSyncStart()
+	if err != nil {
+		return err
 	}
-	res, err := listReq.Do(context.Background(), db.EsClient)
-	defer res.Body.Close()
+	// 获取区块链的最后一个块
+	length, err := getRpcLastBlockNumber()
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var response db.EsSearchResponse
-	err = json.NewDecoder(res.Body).Decode(&response)
+	marks := getFinalityMarks(length.Uint64())
+	setCurrentMarks(marks)
+	target, err := getSyncTarget(length.Uint64(), marks)
 	if err != nil {
-		return nil, err
+		log.Logger.Warn(err.Error())
+		return nil
 	}
-	return &response, nil
-
-}
-
-func Sync() {
-	if db.EsClient != nil && db.EthClient != nil {
-		// 获取 数据库的最后一个块
-		startStr, err := getEsLastBlockNumber()
-		if err != nil {
-			log.Logger.Error(err.Error())
-			os.Exit(1)
-		}
-		// 获取区块链的最后一个块
-		length, err := getRpcLastBlockNumber()
-		if err != nil {
-			log.Logger.Error(err.Error())
-			os.Exit(1)
-		}
-		startBg, b := new(big.Int).SetString(startStr, 10)
-		if !b {
-
-			startBg = big.NewInt(0)
-		}
-
-		// 如果数据库比区块链小，就开始更新
-		for i := startBg; i.Cmp(length) == -1; i.Add(i, big.NewInt(1)) {
-			log.Logger.Info(i.String())
-			block, err := db.EthClient.BlockByNumber(context.Background(), i)
-			if err != nil {
-				log.Logger.Error("获取区块信息出错")
-				log.Logger.Error(err.Error())
-				os.Exit(1)
-			}
-			// 存储block
-			esBlock := buildEsBlock(block)
-			err = createEsBlock(esBlock)
-
-			if err != nil {
-				log.Logger.Error("es block 入库出错")
-				log.Logger.Error(err.Error())
-				os.Exit(1)
-			}
-			txBuf, address, contract, err := bulkBuildTx(block)
-
-			if err != nil {
-				log.Logger.Error("build tx出错")
-				log.Logger.Error(err.Error())
-				os.Exit(1)
-			}
-
-			if txBuf != nil {
-
-				_, err = bulkCreate(txBuf)
-				if err != nil {
-					log.Logger.Error("批量创建tx出错")
-					log.Logger.Error(err.Error())
-					os.Exit(1)
-				}
-			}
-
-			allAddress := append(address, contract...)
-			res, err := getAddressListByList(allAddress)
-			if err != nil {
-				log.Logger.Error("获取地址列表出错")
-				log.Logger.Error(err.Error())
-				os.Exit(1)
-			}
-			addressMap := map[string]bool{}
-			for _, _address := range address {
-				addressMap[_address] = true
-			}
-			contractMap := map[string]bool{}
-			for _, _contract := range contract {
-				contractMap[_contract] = true
-			}
-			for _, hit := range res.Hits.Hits {
-				if addressMap[hit.Id] {
-					addressMap[hit.Id] = false
-				}
-				if contractMap[hit.Id] {
-					contractMap[hit.Id] = false
-				}
-			}
-			addressBuf, err := bulkBuildAddress(addressMap, contractMap)
-
-			if err != nil {
-				log.Logger.Error("构建入库地址列表出错")
-				log.Logger.Error(err.Error())
-				os.Exit(1)
-			}
 
-			if addressBuf != nil && addressBuf.Len() > 0 {
-				_, err = bulkCreate(addressBuf)
-				if err != nil {
-					log.Logger.Error("入库地址列表出错")
-					log.Logger.Error(err.Error())
-					os.Exit(1)
-				}
-			}
-
-		}
+	// 如果数据库比区块链小，就开始更新
+	err = syncRange(start, target+1)
+	if err != nil {
+		return err
 	}
-
-	timer1 := time.NewTimer(time.Second * 5)
-	<-timer1.C //阻塞，5秒以后继续执行
-	Sync()
+	return updateFinality(marks, target)
 }
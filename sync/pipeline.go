@@ -0,0 +1,355 @@
+package sync
+
+import (
+	"context"
+	"explorer/log"
+	"explorer/store"
+	"go.uber.org/zap"
+	"math/big"
+	"os"
+	"strconv"
+	stdsync "sync"
+	"sync/atomic"
+	"time"
+)
+
+// syncBlock 一个已经从链上取回、等待写入的块
+type syncBlock struct {
+	number         uint64
+	block          *rpcBlock
+	esBlock        *store.ESBlock
+	esTxs          []*store.ESTx
+	internalTxs    []*store.ESInternalTx
+	tokenTransfers []*store.ESTokenTransfer
+	balances       []*store.ESBalance
+	addresses      []string
+	contracts      []string
+	tokens         map[string]*store.ESToken
+	err            error
+	attempts       int
+}
+
+// 同步参数
+// SYNC_WORKERS 并发拉取区块的协程数
+// SYNC_BATCH_SIZE 每次批量写入的区块数
+// SYNC_QUEUE_SIZE 已拉取未写入的区块上限
+var (
+	syncWorkers   = envInt("SYNC_WORKERS", 8)
+	syncBatchSize = envInt("SYNC_BATCH_SIZE", 50)
+	syncQueueSize = envInt("SYNC_QUEUE_SIZE", 200)
+)
+
+// 上一个已写入块的高度和hash，用来检测重组
+var (
+	lastNumber uint64
+	lastHash   = ""
+)
+
+// writeMu 同步写入、重组回滚和校验补块互相排斥，补块不会写入正在回滚的孤块
+var writeMu stdsync.Mutex
+
+func envInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func fetchBlock(ctx context.Context, number uint64) *syncBlock {
+	sb := &syncBlock{number: number}
+	block, err := getBlock(ctx, number)
+	if err != nil {
+		sb.err = err
+		return sb
+	}
+	sb.block = block
+	sb.esTxs, sb.addresses, sb.contracts, sb.err = buildTxs(ctx, block)
+	if sb.err != nil {
+		return sb
+	}
+	sb.esBlock = buildEsBlock(block)
+	for _, esTx := range sb.esTxs {
+		transfers, addresses := buildTokenTransfers(esTx)
+		sb.tokenTransfers = append(sb.tokenTransfers, transfers...)
+		sb.addresses = append(sb.addresses, addresses...)
+	}
+	internalTxs, addresses, contracts, err := getInternalTxs(ctx, block, sb.esTxs)
+	if err != nil {
+		sb.err = err
+		return sb
+	}
+	sb.internalTxs = internalTxs
+	sb.addresses = append(sb.addresses, addresses...)
+	sb.contracts = append(sb.contracts, contracts...)
+	sb.tokens, sb.err = getTokens(ctx, sb.contracts, block.header.Number)
+	if sb.err != nil {
+		return sb
+	}
+	sb.balances, sb.err = getBalances(ctx, block, append(sb.addresses, sb.contracts...))
+	return sb
+}
+
+// fetchBlockWithRetry 拉取区块，失败时按退避重试，用完重试次数才返回错误。
+// 节点对某个块返回的错误不一定是临时的(例如receipt还没有准备好)，所以不区分错误类型，pipeline取消后不再重试
+func fetchBlockWithRetry(ctx context.Context, number uint64) *syncBlock {
+	var sb *syncBlock
+	attempts, _ := retryWhen("拉取区块"+strconv.FormatUint(number, 10), func(error) bool {
+		return ctx.Err() == nil
+	}, func() error {
+		sb = fetchBlock(ctx, number)
+		return sb.err
+	})
+	sb.attempts = attempts
+	return sb
+}
+
+// startPipeline 并发拉取[start, end)的块，按高度顺序输出
+// 返回的release需要在每消费一个块后调用，用来限制队列长度
+func startPipeline(ctx context.Context, start uint64, end uint64) (<-chan *syncBlock, func()) {
+	jobs := make(chan uint64)
+	fetched := make(chan *syncBlock, syncWorkers)
+	ordered := make(chan *syncBlock, syncQueueSize)
+	tokens := make(chan struct{}, syncQueueSize)
+	release := func() {
+		<-tokens
+		stats.setQueueDepth(len(tokens))
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := start; i < end; i++ {
+			select {
+			case tokens <- struct{}{}:
+				stats.setQueueDepth(len(tokens))
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg stdsync.WaitGroup
+	for w := 0; w < syncWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for number := range jobs {
+				sb := fetchBlockWithRetry(ctx, number)
+				stats.fetched()
+				select {
+				case fetched <- sb:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+
+	// 乱序到达的块先放在pending里，按高度依次输出
+	go func() {
+		defer close(ordered)
+		pending := map[uint64]*syncBlock{}
+		next := start
+		for sb := range fetched {
+			pending[sb.number] = sb
+			for {
+				ready, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case ordered <- ready:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return ordered, release
+}
+
+// syncRange 同步[start, end)的块，遇到重组时从共同祖先重新开始
+func syncRange(start uint64, end uint64) error {
+	for start < end {
+		next, err := runPipeline(start, end)
+		if err != nil {
+			return err
+		}
+		start = next
+	}
+	return nil
+}
+
+// runPipeline 消费有序的块并批量写入，返回下一个需要同步的高度
+func runPipeline(start uint64, end uint64) (uint64, error) {
+	// 没有同步进度时从已入库的数据里读取上一个块的hash
+	if lastHash == "" && start > 0 {
+		parent, err := store.Repo.FindBlock(start - 1)
+		if err != nil {
+			return 0, err
+		}
+		if parent != nil {
+			lastNumber, lastHash = start-1, parent.BlockHash
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ordered, release := startPipeline(ctx, start, end)
+
+	var batch []*syncBlock
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case sb, ok := <-ordered:
+			if !ok {
+				return end, writeBatch(batch)
+			}
+			release()
+			if sb.err != nil {
+				// 节点不可用时整体重试，节点正常时说明是这个块的问题，记录死信后跳过
+				_, err := getRpcLastBlockNumber()
+				if err != nil {
+					return 0, sb.err
+				}
+				err = writeBatch(batch)
+				if err != nil {
+					return 0, err
+				}
+				batch = nil
+				err = saveDeadLetter(sb.number, sb.attempts, sb.err)
+				if err != nil {
+					return 0, err
+				}
+				// 跳过的块由校验任务补齐，lastHash仍然是最后写入的块，下一个块照常检测重组
+				continue
+			}
+			from, ok, err := checkParent(ctx, sb)
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				err := writeBatch(batch)
+				if err != nil {
+					return 0, err
+				}
+				cancel()
+				ancestor, ancestorHash, err := handleReorg(new(big.Int).SetUint64(from))
+				if err != nil {
+					return 0, err
+				}
+				lastHash = ancestorHash
+				if ancestor.Sign() < 0 {
+					return 0, nil
+				}
+				// 从共同祖先的下一个块重新同步
+				lastNumber = ancestor.Uint64()
+				return lastNumber + 1, nil
+			}
+			lastNumber, lastHash = sb.number, sb.esBlock.BlockHash
+			batch = append(batch, sb)
+			if len(batch) >= syncBatchSize {
+				err := writeBatch(batch)
+				if err != nil {
+					return 0, err
+				}
+				batch = nil
+			}
+		case <-ticker.C:
+			err := writeBatch(batch)
+			if err != nil {
+				return 0, err
+			}
+			batch = nil
+		}
+	}
+}
+
+// checkParent 检查块的父hash和上一个写入的块是否一致，不一致时返回开始找共同祖先的高度。
+// 中间有记录了死信跳过的块时，已入库的上一个高度存在就和它比较，不存在就确认最后写入的块还在链上
+func checkParent(ctx context.Context, sb *syncBlock) (uint64, bool, error) {
+	if lastHash == "" {
+		return 0, true, nil
+	}
+	parentHash := sb.block.header.ParentHash.String()
+	if sb.number == lastNumber+1 {
+		return lastNumber, parentHash == lastHash, nil
+	}
+	parent, err := store.Repo.FindBlock(sb.number - 1)
+	if err != nil {
+		return 0, false, err
+	}
+	if parent != nil {
+		return sb.number - 1, parentHash == parent.BlockHash, nil
+	}
+	hash, err := getBlockHash(ctx, new(big.Int).SetUint64(lastNumber))
+	if err != nil {
+		return 0, false, err
+	}
+	return lastNumber, hash.String() == lastHash, nil
+}
+
+// writeBatch 把一批块写入存储并记录同步进度
+func writeBatch(batch []*syncBlock) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	last := batch[len(batch)-1]
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	_, err := retry("写入区块", func() error {
+		err := writeBlocks(batch)
+		if err != nil {
+			return err
+		}
+		return saveCheckpoint(last.number, last.esBlock.BlockHash)
+	})
+	if err != nil {
+		return err
+	}
+	stats.written(last.number, len(batch))
+	log.Logger.Info("同步进度",
+		zap.Uint64("block", last.number),
+		zap.Int("batch", len(batch)),
+		zap.Float64("blocksPerSecond", stats.rate()),
+		zap.Int64("queueDepth", atomic.LoadInt64(&stats.queueDepth)),
+	)
+	return nil
+}
+
+// writeBlocks 把一批块写入存储，顺序是tx、内部调用、代币转账、address、block
+func writeBlocks(batch []*syncBlock) error {
+	blockBatch := new(store.BlockBatch)
+	for _, sb := range batch {
+		finality := getFinality(sb.number)
+		sb.esBlock.Finality = finality
+		for _, esTx := range sb.esTxs {
+			esTx.Finality = finality
+		}
+		blockBatch.Blocks = append(blockBatch.Blocks, sb.esBlock)
+		blockBatch.Txs = append(blockBatch.Txs, sb.esTxs...)
+		blockBatch.InternalTxs = append(blockBatch.InternalTxs, sb.internalTxs...)
+		blockBatch.TokenTransfers = append(blockBatch.TokenTransfers, sb.tokenTransfers...)
+		blockBatch.Balances = append(blockBatch.Balances, sb.balances...)
+		blockBatch.Addresses = append(blockBatch.Addresses, sb.addresses...)
+		blockBatch.Contracts = append(blockBatch.Contracts, sb.contracts...)
+		for contract, token := range sb.tokens {
+			if blockBatch.Tokens == nil {
+				blockBatch.Tokens = map[string]*store.ESToken{}
+			}
+			blockBatch.Tokens[contract] = token
+		}
+	}
+	return store.Repo.UpsertBlockBatch(blockBatch)
+}
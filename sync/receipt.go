@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"explorer/db"
+	"explorer/log"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+	"strings"
+	"sync/atomic"
+)
+
+// 批量请求receipt时每次请求的数量
+const receiptBatchSize = 100
+
+// 节点不支持eth_getBlockReceipts时置为1，之后直接走批量请求
+var blockReceiptsUnsupported int32
+
+// rpcReceipt 节点返回的receipt，geth v1.10.21的Receipt没有effectiveGasPrice和4844的字段，单独解析
+type rpcReceipt struct {
+	*types.Receipt
+	EffectiveGasPrice *hexutil.Big
+	BlobGasUsed       *hexutil.Uint64
+	BlobGasPrice      *hexutil.Big
+}
+
+func (r *rpcReceipt) UnmarshalJSON(input []byte) error {
+	var extra struct {
+		EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice"`
+		BlobGasUsed       *hexutil.Uint64 `json:"blobGasUsed"`
+		BlobGasPrice      *hexutil.Big    `json:"blobGasPrice"`
+	}
+	err := json.Unmarshal(input, &extra)
+	if err != nil {
+		return err
+	}
+	r.Receipt = new(types.Receipt)
+	r.EffectiveGasPrice = extra.EffectiveGasPrice
+	r.BlobGasUsed, r.BlobGasPrice = extra.BlobGasUsed, extra.BlobGasPrice
+	return r.Receipt.UnmarshalJSON(input)
+}
+
+// getBlockReceipts 获取block里所有tx的receipt，顺序和block里的tx一致
+func getBlockReceipts(ctx context.Context, block *rpcBlock) ([]*rpcReceipt, error) {
+	txs := block.txs
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	if atomic.LoadInt32(&blockReceiptsUnsupported) == 0 {
+		var receipts []*rpcReceipt
+		err := db.RpcClient.CallContext(ctx, &receipts, "eth_getBlockReceipts", hexutil.EncodeBig(block.header.Number))
+		if err == nil && checkReceipts(txs, receipts) == nil {
+			return receipts, nil
+		}
+		if err != nil && ctx.Err() == nil && isUnsupportedMethod(err) {
+			atomic.StoreInt32(&blockReceiptsUnsupported, 1)
+			log.Logger.Warn("节点不支持eth_getBlockReceipts，改用批量请求", zap.Error(err))
+		}
+	}
+	return batchGetReceipts(ctx, txs)
+}
+
+// isUnsupportedMethod 判断错误是不是节点不支持这个方法。除了标准的-32601，有的节点对不认识的方法或参数
+// 返回-32602，或者返回-32000加上method not found之类的信息；其它不能重试的错误也按不支持处理
+func isUnsupportedMethod(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32601, -32602:
+			return true
+		case -32000:
+			msg := strings.ToLower(err.Error())
+			if strings.Contains(msg, "method") {
+				for _, unsupported := range []string{"not found", "not supported", "unsupported", "does not exist", "not available"} {
+					if strings.Contains(msg, unsupported) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return !isTransient(err)
+}
+
+// batchGetReceipts 用批量json-rpc请求eth_getTransactionReceipt
+func batchGetReceipts(ctx context.Context, txs []*rpcTx) ([]*rpcReceipt, error) {
+	receipts := make([]*rpcReceipt, len(txs))
+	for i := 0; i < len(txs); i += receiptBatchSize {
+		j := i + receiptBatchSize
+		if j > len(txs) {
+			j = len(txs)
+		}
+		elems := make([]rpc.BatchElem, 0, j-i)
+		for k := i; k < j; k++ {
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_getTransactionReceipt",
+				Args:   []interface{}{txs[k].hash},
+				Result: &receipts[k],
+			})
+		}
+		err := db.RpcClient.BatchCallContext(ctx, elems)
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			if elem.Error != nil {
+				return nil, elem.Error
+			}
+		}
+	}
+	return receipts, checkReceipts(txs, receipts)
+}
+
+// checkReceipts 校验receipt和tx一一对应
+func checkReceipts(txs []*rpcTx, receipts []*rpcReceipt) error {
+	if len(receipts) != len(txs) {
+		return errors.New("receipt数量和tx数量不一致")
+	}
+	for i, receipt := range receipts {
+		if receipt == nil {
+			return errors.New("receipt不存在:" + txs[i].hash.String())
+		}
+		if receipt.TxHash != txs[i].hash {
+			return errors.New("receipt和tx不对应:" + txs[i].hash.String())
+		}
+	}
+	return nil
+}
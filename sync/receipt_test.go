@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestIsUnsupportedMethod(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"method not found", &testRpcError{-32601, "the method eth_getBlockReceipts does not exist/is not available"}, true},
+		{"invalid params", &testRpcError{-32602, "invalid argument 0: hex string without 0x prefix"}, true},
+		{"server error method not found", &testRpcError{-32000, "Method not found"}, true},
+		{"server error unsupported method", &testRpcError{-32000, "unsupported method: eth_getBlockReceipts"}, true},
+		// 负载均衡后面的节点还没有这个块，下一个块可能就正常了
+		{"header not found", &testRpcError{-32000, "header not found"}, false},
+		{"rate limited", &testRpcError{-32005, "limit exceeded"}, false},
+		{"http 429", rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, false},
+		{"timeout", context.DeadlineExceeded, false},
+		{"other error", errors.New("json: cannot unmarshal object into Go value of type []*sync.rpcReceipt"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnsupportedMethod(tt.err); got != tt.want {
+				t.Errorf("isUnsupportedMethod(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"context"
+	"explorer/log"
+	"explorer/store"
+	"go.uber.org/zap"
+	"math/big"
+	"time"
+)
+
+// findCommonAncestor 从from开始往回找，直到已入库的block hash和链上一致
+// 返回共同祖先的高度以及需要回滚的block。遇到没有入库的高度(跳过的死信或者同步的起点之前)时，
+// 之前的历史是未知的，把这个高度当作共同祖先返回，不再往前找
+func findCommonAncestor(from *big.Int) (*big.Int, []*store.ESBlock, error) {
+	var orphaned []*store.ESBlock
+	for i := new(big.Int).Set(from); i.Sign() >= 0; i.Sub(i, big.NewInt(1)) {
+		stored, err := store.Repo.FindBlock(i.Uint64())
+		if err != nil {
+			return nil, nil, err
+		}
+		if stored == nil {
+			return i, orphaned, nil
+		}
+		hash, err := getBlockHash(context.Background(), i)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stored.BlockHash == hash.String() {
+			return i, orphaned, nil
+		}
+		orphaned = append(orphaned, stored)
+	}
+	return big.NewInt(-1), orphaned, nil
+}
+
+// rollback 删除孤块以及孤块里的交易和新建的合约地址，并记录重组事件
+func rollback(ancestor *big.Int, orphaned []*store.ESBlock) error {
+	if len(orphaned) == 0 {
+		return nil
+	}
+	txHashes, err := store.Repo.RemoveBlocks(orphaned)
+	if err != nil {
+		return err
+	}
+	reorg := new(store.ESReorg)
+	reorg.Number = ancestor.String()
+	reorg.Depth = len(orphaned)
+	reorg.OldHashes = make([]string, 0, len(orphaned))
+	for _, block := range orphaned {
+		reorg.OldHashes = append(reorg.OldHashes, block.BlockHash)
+	}
+	reorg.TxHashes = txHashes
+	reorg.Time = uint64(time.Now().Unix())
+	err = store.Repo.SaveReorg(reorg)
+	if err != nil {
+		return err
+	}
+	log.Logger.Warn("区块重组",
+		zap.String("ancestor", reorg.Number),
+		zap.Int("depth", reorg.Depth),
+		zap.Strings("oldHashes", reorg.OldHashes),
+		zap.Int("txs", len(reorg.TxHashes)),
+	)
+	return nil
+}
+
+// handleReorg 检测到父hash不一致时回滚到共同祖先，返回共同祖先的高度和hash，共同祖先没有入库时hash为空
+func handleReorg(from *big.Int) (*big.Int, string, error) {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	ancestor, orphaned, err := findCommonAncestor(from)
+	if err != nil {
+		return nil, "", err
+	}
+	err = rollback(ancestor, orphaned)
+	if err != nil {
+		return nil, "", err
+	}
+	resetFinality(uint64(ancestor.Int64() + 1))
+	if ancestor.Sign() < 0 {
+		return ancestor, "", deleteCheckpoint()
+	}
+	stored, err := store.Repo.FindBlock(ancestor.Uint64())
+	if err != nil {
+		return nil, "", err
+	}
+	hash := ""
+	if stored != nil {
+		hash = stored.BlockHash
+	} else {
+		// 共同祖先本身缺失，后台校验从这里重新检查
+		clampVerified(ancestor.Uint64())
+	}
+	return ancestor, hash, saveCheckpoint(ancestor.Uint64(), hash)
+}
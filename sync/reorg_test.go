@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"context"
+	"explorer/db"
+	"explorer/log"
+	"explorer/store"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+)
+
+// testChain 按高度返回块hash的eth_getBlockByNumber，记录查询过的高度
+type testChain struct {
+	hashes  map[uint64]common.Hash
+	queried []uint64
+}
+
+func (c *testChain) GetBlockByNumber(ctx context.Context, number hexutil.Big, full bool) (map[string]interface{}, error) {
+	n := number.ToInt().Uint64()
+	c.queried = append(c.queried, n)
+	hash, ok := c.hashes[n]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{"hash": hash}, nil
+}
+
+func testHash(chain string, number uint64) common.Hash {
+	return common.BytesToHash([]byte(chain + strconv.FormatUint(number, 10)))
+}
+
+func TestFindCommonAncestor(t *testing.T) {
+	tests := []struct {
+		name string
+		// 已入库的高度，没有的是缺块
+		stored []uint64
+		// 链上从这个高度开始是新的分叉
+		forkAt       uint64
+		from         uint64
+		wantAncestor int64
+		wantOrphaned int
+		wantQueried  int
+	}{
+		{"fork below from", []uint64{0, 1, 2, 3, 4, 5}, 4, 5, 3, 2, 3},
+		{"gap is the end of known history", []uint64{5, 6, 7, 8}, 0, 8, 4, 4, 4},
+		{"gap in the middle", []uint64{0, 1, 2, 4, 5}, 4, 5, 3, 2, 2},
+		{"all orphaned", []uint64{0, 1, 2}, 0, 2, -1, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.Repo = store.NewMemoryRepository()
+			chain := &testChain{hashes: map[uint64]common.Hash{}}
+			for number := uint64(0); number <= tt.from; number++ {
+				if number >= tt.forkAt {
+					chain.hashes[number] = testHash("new", number)
+				} else {
+					chain.hashes[number] = testHash("old", number)
+				}
+			}
+			var blocks []*store.ESBlock
+			for _, number := range tt.stored {
+				blocks = append(blocks, &store.ESBlock{
+					Number:    strconv.FormatUint(number, 10),
+					BlockHash: testHash("old", number).String(),
+				})
+			}
+			err := store.Repo.UpsertBlockBatch(&store.BlockBatch{Blocks: blocks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := rpc.NewServer()
+			defer server.Stop()
+			err = server.RegisterName("eth", chain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.RpcClient = rpc.DialInProc(server)
+			defer db.RpcClient.Close()
+
+			ancestor, orphaned, err := findCommonAncestor(new(big.Int).SetUint64(tt.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ancestor.Int64() != tt.wantAncestor || len(orphaned) != tt.wantOrphaned {
+				t.Errorf("ancestor = %v, orphaned = %d, want %d, %d", ancestor, len(orphaned), tt.wantAncestor, tt.wantOrphaned)
+			}
+			// 没有入库的高度不查询链上的hash
+			if len(chain.queried) != tt.wantQueried {
+				t.Errorf("queried %v, want %d heights", chain.queried, tt.wantQueried)
+			}
+		})
+	}
+}
+
+func TestHandleReorgResetsFinality(t *testing.T) {
+	log.Logger = zap.NewNop()
+	store.Repo = store.NewMemoryRepository()
+	chain := &testChain{hashes: map[uint64]common.Hash{}}
+	var blocks []*store.ESBlock
+	for number := uint64(0); number <= 5; number++ {
+		chain.hashes[number] = testHash("old", number)
+		if number >= 4 {
+			chain.hashes[number] = testHash("new", number)
+		}
+		blocks = append(blocks, &store.ESBlock{
+			Number:    strconv.FormatUint(number, 10),
+			BlockHash: testHash("old", number).String(),
+		})
+	}
+	err := store.Repo.UpsertBlockBatch(&store.BlockBatch{Blocks: blocks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer()
+	defer server.Stop()
+	err = server.RegisterName("eth", chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RpcClient = rpc.DialInProc(server)
+	defer db.RpcClient.Close()
+
+	// 孤块已经标记过safe，重新写入的4、5还需要再标记
+	finalityLoaded, nextFinalized, nextSafe = true, 2, 6
+	defer func() {
+		finalityLoaded, nextFinalized, nextSafe = false, 0, 0
+	}()
+	ancestor, _, err := handleReorg(big.NewInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ancestor.Int64() != 3 {
+		t.Fatalf("ancestor = %v, want 3", ancestor)
+	}
+	if nextSafe != 4 || nextFinalized != 2 {
+		t.Errorf("nextSafe = %d, nextFinalized = %d, want 4, 2", nextSafe, nextFinalized)
+	}
+}
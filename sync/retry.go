@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/log"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.uber.org/zap"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// SYNC_MAX_RETRIES 临时错误的最大重试次数，超过后块会记录到死信
+var syncMaxRetries = envInt("SYNC_MAX_RETRIES", 8)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// isTransient 判断错误是否可以重试：网络错误、超时、限流和服务端错误
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var storeErr *store.Error
+	if errors.As(err, &storeErr) {
+		return storeErr.Transient
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		// -32005 限流，-32000 节点内部错误(例如数据还没准备好)
+		return rpcErr.ErrorCode() == -32005 || rpcErr.ErrorCode() == -32000
+	}
+	return false
+}
+
+// backoff 第attempt次重试前等待的时间，指数增长并加上随机抖动
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 {
+		delay = retryBaseDelay << uint(attempt)
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retry 执行fn，临时错误按退避重试，返回最后一次的错误和尝试次数
+func retry(op string, fn func() error) (int, error) {
+	return retryWhen(op, isTransient, fn)
+}
+
+// retryWhen 执行fn，shouldRetry返回true的错误按退避重试，最多重试SYNC_MAX_RETRIES次
+func retryWhen(op string, shouldRetry func(error) bool, fn func() error) (int, error) {
+	attempt := 0
+	for {
+		err := fn()
+		attempt++
+		if err == nil {
+			return attempt, nil
+		}
+		if !shouldRetry(err) || attempt > syncMaxRetries {
+			return attempt, err
+		}
+		delay := backoff(attempt - 1)
+		log.Logger.Warn(op+"出错，稍后重试",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		time.Sleep(delay)
+	}
+}
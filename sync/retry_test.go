@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/store"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// rpcCodeError 节点返回的json-rpc错误
+type rpcCodeError struct {
+	code int
+}
+
+func (e rpcCodeError) Error() string {
+	return fmt.Sprintf("rpc error %d", e.code)
+}
+
+func (e rpcCodeError) ErrorCode() int {
+	return e.code
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("invalid block"), false},
+		{"store transient", &store.Error{Msg: "es", Status: 429, Transient: true}, true},
+		{"store permanent", &store.Error{Msg: "es", Status: 400}, false},
+		{"wrapped store", fmt.Errorf("write: %w", &store.Error{Msg: "es", Status: 503, Transient: true}), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"wrapped deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"net", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"http 429", rpc.HTTPError{StatusCode: 429}, true},
+		{"http 502", rpc.HTTPError{StatusCode: 502}, true},
+		{"http 404", rpc.HTTPError{StatusCode: 404}, false},
+		{"rpc rate limit", rpcCodeError{-32005}, true},
+		{"rpc internal", rpcCodeError{-32000}, true},
+		{"rpc invalid params", rpcCodeError{-32602}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{5, 32 * time.Second},
+		{6, time.Minute},
+		{15, time.Minute},
+		{16, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			// 抖动是随机的，多取几次检查范围
+			for i := 0; i < 100; i++ {
+				delay := backoff(tt.attempt)
+				if delay < tt.max/2 || delay > tt.max {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, delay, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package sync
+
+import (
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"strings"
+)
+
+// revertData 从eth_call的错误里取出revert的原始数据，没有数据时返回nil
+//
+// geth的error.data是十六进制字符串，nethermind在前面加了"Reverted "，有的节点把它放在对象的data字段里
+func revertData(err error) []byte {
+	var dataError rpc.DataError
+	if !errors.As(err, &dataError) {
+		return nil
+	}
+	data := dataError.ErrorData()
+	if object, ok := data.(map[string]interface{}); ok {
+		data = object["data"]
+	}
+	text, ok := data.(string)
+	if !ok {
+		return nil
+	}
+	text = strings.TrimPrefix(strings.TrimSpace(text), "Reverted ")
+	revert, err := hexutil.Decode(text)
+	if err != nil {
+		return nil
+	}
+	return revert
+}
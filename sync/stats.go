@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"explorer/store"
+	stdsync "sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats 同步状态，给接口展示吞吐量和队列长度
+type Stats struct {
+	Workers         int     `json:"workers"`
+	BatchSize       int     `json:"batchSize"`
+	QueueSize       int     `json:"queueSize"`
+	QueueDepth      int64   `json:"queueDepth"`
+	FetchedBlocks   uint64  `json:"fetchedBlocks"`
+	WrittenBlocks   uint64  `json:"writtenBlocks"`
+	LastBlock       uint64  `json:"lastBlock"`
+	BlocksPerSecond float64 `json:"blocksPerSecond"`
+	store.BulkStats
+}
+
+type syncStats struct {
+	queueDepth    int64
+	fetchedBlocks uint64
+
+	mu            stdsync.Mutex
+	writtenBlocks uint64
+	lastBlock     uint64
+	lastWrite     time.Time
+	// 平滑后的每秒写入块数
+	blocksPerSecond float64
+}
+
+var stats = new(syncStats)
+
+func (s *syncStats) setQueueDepth(depth int) {
+	atomic.StoreInt64(&s.queueDepth, int64(depth))
+}
+
+func (s *syncStats) fetched() {
+	atomic.AddUint64(&s.fetchedBlocks, 1)
+}
+
+func (s *syncStats) written(lastBlock uint64, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if !s.lastWrite.IsZero() {
+		elapsed := now.Sub(s.lastWrite).Seconds()
+		if elapsed > 0 {
+			current := float64(count) / elapsed
+			if s.blocksPerSecond == 0 {
+				s.blocksPerSecond = current
+			} else {
+				s.blocksPerSecond = 0.8*s.blocksPerSecond + 0.2*current
+			}
+		}
+	}
+	s.lastWrite = now
+	s.writtenBlocks += uint64(count)
+	s.lastBlock = lastBlock
+}
+
+func (s *syncStats) rate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocksPerSecond
+}
+
+// GetStats 获取当前的同步状态
+func GetStats() Stats {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return Stats{
+		Workers:         syncWorkers,
+		BatchSize:       syncBatchSize,
+		QueueSize:       syncQueueSize,
+		QueueDepth:      atomic.LoadInt64(&stats.queueDepth),
+		FetchedBlocks:   atomic.LoadUint64(&stats.fetchedBlocks),
+		WrittenBlocks:   stats.writtenBlocks,
+		LastBlock:       stats.lastBlock,
+		BlocksPerSecond: stats.blocksPerSecond,
+		BulkStats:       store.GetBulkStats(),
+	}
+}
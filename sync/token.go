@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"strconv"
+)
+
+// 转账事件的topic0，erc20和erc721的Transfer签名相同，通过indexed参数的数量区分
+var (
+	transferTopic       = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	transferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	transferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+// TransferBatch的data是ids和values两个数组
+var transferBatchArguments = func() abi.Arguments {
+	uint256Array, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return abi.Arguments{{Type: uint256Array}, {Type: uint256Array}}
+}()
+
+func topicAddress(topic common.Hash) string {
+	return common.BytesToAddress(topic.Bytes()).String()
+}
+
+// newTokenTransfer 填充转账所在交易和日志的信息
+func newTokenTransfer(esTx *store.ESTx, log *types.Log, standard string) *store.ESTokenTransfer {
+	return &store.ESTokenTransfer{
+		Id:               esTx.Hash + "-" + strconv.FormatUint(uint64(log.Index), 10),
+		Standard:         standard,
+		Token:            log.Address.String(),
+		TxHash:           esTx.Hash,
+		LogIndex:         log.Index,
+		BlockHash:        esTx.BlockHash,
+		Number:           esTx.Number,
+		Time:             esTx.Time,
+		TransactionIndex: esTx.TransactionIndex,
+	}
+}
+
+// decodeTransferLog 解析一条日志里的代币转账，不是转账时返回nil
+//
+// erc20的Transfer有3个topic，amount在data里；erc721的tokenId也是indexed，有4个topic，data为空
+// erc1155的TransferSingle和TransferBatch的topic是operator、from、to，id和value在data里
+func decodeTransferLog(esTx *store.ESTx, log *types.Log) []*store.ESTokenTransfer {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	switch {
+	case log.Topics[0] == transferTopic && len(log.Topics) == 3 && len(log.Data) == 32:
+		transfer := newTokenTransfer(esTx, log, store.TokenStandardERC20)
+		transfer.From, transfer.To = topicAddress(log.Topics[1]), topicAddress(log.Topics[2])
+		transfer.Amount = new(big.Int).SetBytes(log.Data).String()
+		return []*store.ESTokenTransfer{transfer}
+	case log.Topics[0] == transferTopic && len(log.Topics) == 4 && len(log.Data) == 0:
+		transfer := newTokenTransfer(esTx, log, store.TokenStandardERC721)
+		transfer.From, transfer.To = topicAddress(log.Topics[1]), topicAddress(log.Topics[2])
+		transfer.TokenId = log.Topics[3].Big().String()
+		transfer.Amount = "1"
+		return []*store.ESTokenTransfer{transfer}
+	case log.Topics[0] == transferSingleTopic && len(log.Topics) == 4 && len(log.Data) == 64:
+		transfer := newTokenTransfer(esTx, log, store.TokenStandardERC1155)
+		transfer.Operator = topicAddress(log.Topics[1])
+		transfer.From, transfer.To = topicAddress(log.Topics[2]), topicAddress(log.Topics[3])
+		transfer.TokenId = new(big.Int).SetBytes(log.Data[:32]).String()
+		transfer.Amount = new(big.Int).SetBytes(log.Data[32:]).String()
+		return []*store.ESTokenTransfer{transfer}
+	case log.Topics[0] == transferBatchTopic && len(log.Topics) == 4:
+		values, err := transferBatchArguments.Unpack(log.Data)
+		if err != nil || len(values) != 2 {
+			return nil
+		}
+		ids, ok := values[0].([]*big.Int)
+		if !ok {
+			return nil
+		}
+		amounts, ok := values[1].([]*big.Int)
+		if !ok || len(ids) != len(amounts) {
+			return nil
+		}
+		transfers := make([]*store.ESTokenTransfer, 0, len(ids))
+		for i := range ids {
+			transfer := newTokenTransfer(esTx, log, store.TokenStandardERC1155)
+			transfer.Id += "-" + strconv.Itoa(i)
+			transfer.BatchIndex = i
+			transfer.Operator = topicAddress(log.Topics[1])
+			transfer.From, transfer.To = topicAddress(log.Topics[2]), topicAddress(log.Topics[3])
+			transfer.TokenId = ids[i].String()
+			transfer.Amount = amounts[i].String()
+			transfers = append(transfers, transfer)
+		}
+		return transfers
+	}
+	return nil
+}
+
+// buildTokenTransfers 从交易日志里解析erc20、erc721和erc1155的转账，同时返回转账涉及的地址
+func buildTokenTransfers(esTx *store.ESTx) ([]*store.ESTokenTransfer, []string) {
+	var transfers []*store.ESTokenTransfer
+	var addresses []string
+	for _, log := range esTx.Logs {
+		for _, transfer := range decodeTransferLog(esTx, log) {
+			transfers = append(transfers, transfer)
+			// mint和burn的零地址不作为地址记录
+			for _, address := range []string{transfer.From, transfer.To} {
+				if address != emptyContractAddress {
+					addresses = append(addresses, address)
+				}
+			}
+		}
+	}
+	return transfers, addresses
+}
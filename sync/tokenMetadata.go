@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/db"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// 批量eth_call时每次请求的数量
+const probeBatchSize = 90
+
+// erc165的interfaceId
+var (
+	erc165InterfaceId  = [4]byte{0x01, 0xff, 0xc9, 0xa7}
+	invalidInterfaceId = [4]byte{0xff, 0xff, 0xff, 0xff}
+	erc721InterfaceId  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceId = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+var stringArguments = func() abi.Arguments {
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return abi.Arguments{{Type: stringType}}
+}()
+
+// 每个合约依次调用的方法，结果按这个顺序排列
+const (
+	probeErc165 = iota
+	probeInvalid
+	probeErc721
+	probeErc1155
+	probeName
+	probeSymbol
+	probeDecimals
+	probeTotalSupply
+	probeBalanceOf
+	probeCount
+)
+
+func selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+func supportsInterfaceData(interfaceId [4]byte) hexutil.Bytes {
+	data := make([]byte, 4+32)
+	copy(data, selector("supportsInterface(bytes4)"))
+	copy(data[4:], interfaceId[:])
+	return data
+}
+
+// probeCalls 探测一个合约需要的eth_call的data
+func probeCalls() []hexutil.Bytes {
+	calls := make([]hexutil.Bytes, probeCount)
+	calls[probeErc165] = supportsInterfaceData(erc165InterfaceId)
+	calls[probeInvalid] = supportsInterfaceData(invalidInterfaceId)
+	calls[probeErc721] = supportsInterfaceData(erc721InterfaceId)
+	calls[probeErc1155] = supportsInterfaceData(erc1155InterfaceId)
+	calls[probeName] = selector("name()")
+	calls[probeSymbol] = selector("symbol()")
+	calls[probeDecimals] = selector("decimals()")
+	calls[probeTotalSupply] = selector("totalSupply()")
+	// 查询零地址的余额，参数全是0
+	calls[probeBalanceOf] = append(selector("balanceOf(address)"), make([]byte, 32)...)
+	return calls
+}
+
+// getTokens 用eth_call探测新建的合约是不是代币，返回合约地址到代币信息的映射
+//
+// 支持erc165的合约按interfaceId区分erc721和erc1155，否则同时实现了totalSupply、balanceOf和decimals的当作erc20
+// 读取的是创建合约的块之后的状态，节点已经裁剪了这个块的状态时改为读取最新状态
+func getTokens(ctx context.Context, contracts []string, number *big.Int) (map[string]*store.ESToken, error) {
+	if len(contracts) == 0 {
+		return nil, nil
+	}
+	tokens, err := probeTokens(ctx, contracts, hexutil.EncodeBig(number))
+	if isMissingState(err) {
+		return probeTokens(ctx, contracts, "latest")
+	}
+	return tokens, err
+}
+
+// probeTokens 在block的状态上批量调用探测的方法，合约执行失败的方法按没有实现处理，
+// 其它错误(超时、限流等)返回给调用方，由拉取区块的重试处理
+func probeTokens(ctx context.Context, contracts []string, block string) (map[string]*store.ESToken, error) {
+	calls := probeCalls()
+	results := make([]hexutil.Bytes, len(contracts)*probeCount)
+	var elems []rpc.BatchElem
+	for i, contract := range contracts {
+		for j, data := range calls {
+			elems = append(elems, rpc.BatchElem{
+				Method: "eth_call",
+				Args: []interface{}{
+					map[string]interface{}{"to": contract, "data": data},
+					block,
+				},
+				Result: &results[i*probeCount+j],
+			})
+		}
+	}
+	for i := 0; i < len(elems); i += probeBatchSize {
+		j := i + probeBatchSize
+		if j > len(elems) {
+			j = len(elems)
+		}
+		err := db.RpcClient.BatchCallContext(ctx, elems[i:j])
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems[i:j] {
+			if elem.Error != nil && !isExecutionError(elem.Error) {
+				return nil, elem.Error
+			}
+		}
+	}
+	tokens := map[string]*store.ESToken{}
+	for i, contract := range contracts {
+		token := buildToken(results[i*probeCount : (i+1)*probeCount])
+		if token != nil {
+			tokens[contract] = token
+		}
+	}
+	return tokens, nil
+}
+
+// 节点返回的合约执行失败的错误信息，不同客户端的写法不一样
+var executionErrors = []string{"revert", "invalid opcode", "invalid jump", "out of gas", "stack underflow", "stack overflow", "write protection", "execution error"}
+
+// isExecutionError 判断eth_call的错误是不是合约执行失败，geth的revert错误码是3
+func isExecutionError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, executionError := range executionErrors {
+		if strings.Contains(msg, executionError) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMissingState 判断错误是不是节点没有这个块的状态(非归档节点已经裁剪)
+func isMissingState(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "missing trie node") || strings.Contains(msg, "state not available") || strings.Contains(msg, "historical state")
+}
+
+// buildToken 根据一个合约的调用结果判断代币标准，不是代币时返回nil
+//
+// 没有实现erc165的erc721同样有totalSupply和balanceOf，但是没有decimals，所以erc20还要求decimals返回正确的值
+func buildToken(results []hexutil.Bytes) *store.ESToken {
+	token := new(store.ESToken)
+	decimals, decimalsOk := decodeDecimals(results[probeDecimals])
+	switch {
+	case decodeBool(results[probeErc165]) && !decodeBool(results[probeInvalid]) && decodeBool(results[probeErc721]):
+		token.Standard = store.TokenStandardERC721
+	case decodeBool(results[probeErc165]) && !decodeBool(results[probeInvalid]) && decodeBool(results[probeErc1155]):
+		token.Standard = store.TokenStandardERC1155
+	case len(results[probeTotalSupply]) == 32 && len(results[probeBalanceOf]) == 32 && decimalsOk:
+		token.Standard = store.TokenStandardERC20
+		token.Decimals = &decimals
+	default:
+		return nil
+	}
+	token.Name = decodeString(results[probeName])
+	token.Symbol = decodeString(results[probeSymbol])
+	if len(results[probeTotalSupply]) == 32 {
+		token.TotalSupply = new(big.Int).SetBytes(results[probeTotalSupply]).String()
+	}
+	return token
+}
+
+// decodeDecimals 解析decimals()的返回值，不是uint8范围内的数时返回false
+func decodeDecimals(result hexutil.Bytes) (uint8, bool) {
+	if len(result) != 32 {
+		return 0, false
+	}
+	decimals := new(big.Int).SetBytes(result)
+	if !decimals.IsUint64() || decimals.Uint64() > 255 {
+		return 0, false
+	}
+	return uint8(decimals.Uint64()), true
+}
+
+func decodeBool(result hexutil.Bytes) bool {
+	return len(result) == 32 && new(big.Int).SetBytes(result).Cmp(common.Big1) == 0
+}
+
+// decodeString 解析返回的string，早期的代币(例如MKR)返回的是bytes32
+func decodeString(result hexutil.Bytes) string {
+	var value string
+	if len(result) > 32 {
+		values, err := stringArguments.Unpack(result)
+		if err == nil && len(values) == 1 {
+			value, _ = values[0].(string)
+		}
+	} else if len(result) == 32 {
+		value = string(result)
+	}
+	value = strings.TrimRight(value, "\x00")
+	if !utf8.ValidString(value) || strings.ContainsRune(value, 0) {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"explorer/db"
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"testing"
+)
+
+// probeResults 按probe的序号设置调用结果，其它的调用按revert处理
+func probeResults(results map[int]hexutil.Bytes) []hexutil.Bytes {
+	probes := make([]hexutil.Bytes, probeCount)
+	for probe, result := range results {
+		probes[probe] = result
+	}
+	return probes
+}
+
+func TestBuildToken(t *testing.T) {
+	yes, no := hexutil.Bytes(uint256Bytes(1)), hexutil.Bytes(uint256Bytes(0))
+	supply, balance := hexutil.Bytes(uint256Bytes(1000)), hexutil.Bytes(uint256Bytes(0))
+	tests := []struct {
+		name     string
+		results  map[int]hexutil.Bytes
+		standard string
+		decimals int
+	}{
+		{
+			name:     "erc20",
+			results:  map[int]hexutil.Bytes{probeTotalSupply: supply, probeBalanceOf: balance, probeDecimals: uint256Bytes(18)},
+			standard: store.TokenStandardERC20,
+			decimals: 18,
+		},
+		{
+			name:    "erc20 without decimals",
+			results: map[int]hexutil.Bytes{probeTotalSupply: supply, probeBalanceOf: balance},
+		},
+		{
+			name:    "decimals out of range",
+			results: map[int]hexutil.Bytes{probeTotalSupply: supply, probeBalanceOf: balance, probeDecimals: uint256Bytes(256)},
+		},
+		{
+			name:     "erc721",
+			results:  map[int]hexutil.Bytes{probeErc165: yes, probeInvalid: no, probeErc721: yes, probeTotalSupply: supply, probeBalanceOf: balance},
+			standard: store.TokenStandardERC721,
+			decimals: -1,
+		},
+		{
+			name:     "erc1155",
+			results:  map[int]hexutil.Bytes{probeErc165: yes, probeInvalid: no, probeErc1155: yes},
+			standard: store.TokenStandardERC1155,
+			decimals: -1,
+		},
+		{
+			// supportsInterface对任何id都返回true的合约不可信
+			name:    "supports every interface",
+			results: map[int]hexutil.Bytes{probeErc165: yes, probeInvalid: yes, probeErc721: yes},
+		},
+		{
+			name:    "not a token",
+			results: map[int]hexutil.Bytes{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := buildToken(probeResults(tt.results))
+			if tt.standard == "" {
+				if token != nil {
+					t.Fatalf("buildToken() = %+v, want nil", token)
+				}
+				return
+			}
+			if token == nil || token.Standard != tt.standard {
+				t.Fatalf("buildToken() = %+v, want %s", token, tt.standard)
+			}
+			if tt.decimals < 0 {
+				if token.Decimals != nil {
+					t.Errorf("decimals = %d, want nil", *token.Decimals)
+				}
+			} else if token.Decimals == nil || int(*token.Decimals) != tt.decimals {
+				t.Errorf("decimals = %v, want %d", token.Decimals, tt.decimals)
+			}
+		})
+	}
+}
+
+type testRpcError struct {
+	code int
+	msg  string
+}
+
+func (e *testRpcError) Error() string  { return e.msg }
+func (e *testRpcError) ErrorCode() int { return e.code }
+
+// testErc20 只实现了erc20方法的合约，其它方法revert；state之外的块返回裁剪状态的错误，failing里的方法返回failErr
+type testErc20 struct {
+	state   string
+	failing []byte
+	failErr error
+	blocks  map[string]bool
+}
+
+func (c *testErc20) Call(ctx context.Context, args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	c.blocks[block] = true
+	if block != c.state {
+		return nil, &testRpcError{-32000, "missing trie node 0x01 (path )"}
+	}
+	data, err := hexutil.Decode(args["data"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if c.failing != nil && bytes.HasPrefix(data, c.failing) {
+		return nil, c.failErr
+	}
+	switch {
+	case bytes.HasPrefix(data, selector("totalSupply()")):
+		return uint256Bytes(1000), nil
+	case bytes.HasPrefix(data, selector("balanceOf(address)")):
+		return uint256Bytes(0), nil
+	case bytes.HasPrefix(data, selector("decimals()")):
+		return uint256Bytes(18), nil
+	}
+	return nil, &testRpcError{3, "execution reverted"}
+}
+
+func TestGetTokens(t *testing.T) {
+	contract := "0x00000000000000000000000000000000000000c1"
+	tests := []struct {
+		name    string
+		state   string
+		failing []byte
+		failErr error
+		// 空表示应该返回错误
+		standard string
+	}{
+		{name: "reverts are not implemented", state: "0x5", standard: store.TokenStandardERC20},
+		{name: "old geth revert message", state: "0x5", failing: selector("name()"), failErr: &testRpcError{-32000, "execution reverted"}, standard: store.TokenStandardERC20},
+		{name: "rate limited", state: "0x5", failing: selector("decimals()"), failErr: &testRpcError{-32005, "limit exceeded"}},
+		{name: "timeout", state: "0x5", failing: selector("totalSupply()"), failErr: &testRpcError{-32000, "request timed out"}},
+		{name: "pruned state falls back to latest", state: "latest", standard: store.TokenStandardERC20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &testErc20{state: tt.state, failing: tt.failing, failErr: tt.failErr, blocks: map[string]bool{}}
+			server := rpc.NewServer()
+			defer server.Stop()
+			err := server.RegisterName("eth", caller)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.RpcClient = rpc.DialInProc(server)
+			defer db.RpcClient.Close()
+
+			tokens, err := getTokens(context.Background(), []string{contract}, big.NewInt(5))
+			if !caller.blocks["0x5"] {
+				t.Errorf("blocks = %v, want the creation block 0x5", caller.blocks)
+			}
+			if tt.standard == "" {
+				if err == nil {
+					t.Fatalf("getTokens() = %+v, want error", tokens)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token := tokens[contract]; token == nil || token.Standard != tt.standard {
+				t.Errorf("getTokens() = %+v, want %s", token, tt.standard)
+			}
+		})
+	}
+}
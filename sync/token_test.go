@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"explorer/store"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+var (
+	testToken = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	testFrom  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	testTo    = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+)
+
+func addressTopic(address common.Address) common.Hash {
+	return common.BytesToHash(address.Bytes())
+}
+
+func uint256Bytes(n int64) []byte {
+	return common.BigToHash(big.NewInt(n)).Bytes()
+}
+
+func TestDecodeTransferLog(t *testing.T) {
+	batchData, err := transferBatchArguments.Pack([]*big.Int{big.NewInt(1), big.NewInt(2)}, []*big.Int{big.NewInt(10), big.NewInt(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatchedBatch, err := transferBatchArguments.Pack([]*big.Int{big.NewInt(1)}, []*big.Int{big.NewInt(10), big.NewInt(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := common.Address{}
+	tests := []struct {
+		name string
+		log  *types.Log
+		want []store.ESTokenTransfer
+	}{
+		{
+			name: "erc20",
+			log: &types.Log{
+				Topics: []common.Hash{transferTopic, addressTopic(testFrom), addressTopic(testTo)},
+				Data:   uint256Bytes(1000),
+			},
+			want: []store.ESTokenTransfer{
+				{Id: "0xtx-3", Standard: store.TokenStandardERC20, From: testFrom.String(), To: testTo.String(), Amount: "1000"},
+			},
+		},
+		{
+			name: "erc20 mint",
+			log: &types.Log{
+				Topics: []common.Hash{transferTopic, addressTopic(zero), addressTopic(testTo)},
+				Data:   uint256Bytes(5),
+			},
+			want: []store.ESTokenTransfer{
+				{Id: "0xtx-3", Standard: store.TokenStandardERC20, From: zero.String(), To: testTo.String(), Amount: "5"},
+			},
+		},
+		{
+			name: "erc721",
+			log: &types.Log{
+				Topics: []common.Hash{transferTopic, addressTopic(testFrom), addressTopic(testTo), common.BigToHash(big.NewInt(42))},
+			},
+			want: []store.ESTokenTransfer{
+				{Id: "0xtx-3", Standard: store.TokenStandardERC721, From: testFrom.String(), To: testTo.String(), TokenId: "42", Amount: "1"},
+			},
+		},
+		{
+			name: "erc1155 single",
+			log: &types.Log{
+				Topics: []common.Hash{transferSingleTopic, addressTopic(testFrom), addressTopic(testFrom), addressTopic(testTo)},
+				Data:   append(uint256Bytes(7), uint256Bytes(3)...),
+			},
+			want: []store.ESTokenTransfer{
+				{Id: "0xtx-3", Standard: store.TokenStandardERC1155, Operator: testFrom.String(), From: testFrom.String(),
+					To: testTo.String(), TokenId: "7", Amount: "3"},
+			},
+		},
+		{
+			name: "erc1155 batch",
+			log: &types.Log{
+				Topics: []common.Hash{transferBatchTopic, addressTopic(testFrom), addressTopic(testFrom), addressTopic(testTo)},
+				Data:   batchData,
+			},
+			want: []store.ESTokenTransfer{
+				{Id: "0xtx-3-0", Standard: store.TokenStandardERC1155, Operator: testFrom.String(), From: testFrom.String(),
+					To: testTo.String(), TokenId: "1", Amount: "10"},
+				{Id: "0xtx-3-1", Standard: store.TokenStandardERC1155, Operator: testFrom.String(), From: testFrom.String(),
+					To: testTo.String(), TokenId: "2", Amount: "20", BatchIndex: 1},
+			},
+		},
+		{
+			name: "erc1155 batch length mismatch",
+			log: &types.Log{
+				Topics: []common.Hash{transferBatchTopic, addressTopic(testFrom), addressTopic(testFrom), addressTopic(testTo)},
+				Data:   mismatchedBatch,
+			},
+		},
+		{
+			name: "erc20 malformed data",
+			log: &types.Log{
+				Topics: []common.Hash{transferTopic, addressTopic(testFrom), addressTopic(testTo)},
+				Data:   uint256Bytes(1)[:31],
+			},
+		},
+		{
+			name: "other event",
+			log: &types.Log{
+				Topics: []common.Hash{common.HexToHash("0x01"), addressTopic(testFrom), addressTopic(testTo)},
+				Data:   uint256Bytes(1),
+			},
+		},
+		{
+			name: "anonymous",
+			log:  &types.Log{},
+		},
+	}
+	esTx := &store.ESTx{Hash: "0xtx", BlockHash: "0xblock", Number: "100", Time: 1700000000, TransactionIndex: 2}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.log.Address = testToken
+			tt.log.Index = 3
+			transfers := decodeTransferLog(esTx, tt.log)
+			if len(transfers) != len(tt.want) {
+				t.Fatalf("got %d transfers, want %d", len(transfers), len(tt.want))
+			}
+			for i, transfer := range transfers {
+				want := tt.want[i]
+				want.Token, want.TxHash, want.LogIndex = testToken.String(), esTx.Hash, 3
+				want.BlockHash, want.Number, want.Time, want.TransactionIndex = esTx.BlockHash, esTx.Number, esTx.Time, esTx.TransactionIndex
+				if *transfer != want {
+					t.Errorf("transfer %d = %+v, want %+v", i, *transfer, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildTokenTransfersAddresses(t *testing.T) {
+	zero := common.Address{}
+	esTx := &store.ESTx{
+		Hash: "0xtx",
+		Logs: []*types.Log{
+			{Address: testToken, Index: 0, Topics: []common.Hash{transferTopic, addressTopic(zero), addressTopic(testTo)}, Data: uint256Bytes(1)},
+			{Address: testToken, Index: 1, Topics: []common.Hash{transferTopic, addressTopic(testTo), addressTopic(testFrom)}, Data: uint256Bytes(1)},
+		},
+	}
+	transfers, addresses := buildTokenTransfers(esTx)
+	if len(transfers) != 2 {
+		t.Fatalf("got %d transfers, want 2", len(transfers))
+	}
+	want := []string{testTo.String(), testTo.String(), testFrom.String()}
+	if len(addresses) != len(want) {
+		t.Fatalf("addresses = %v, want %v", addresses, want)
+	}
+	for i := range want {
+		if addresses[i] != want[i] {
+			t.Fatalf("addresses = %v, want %v", addresses, want)
+		}
+	}
+}
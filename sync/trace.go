@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/db"
+	"explorer/log"
+	"explorer/store"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// SYNC_TRACE 内部调用的trace方式，为空时不trace
+// callTracer 用debug_traceTransaction的callTracer，geth等节点需要开启debug接口
+// parity 用trace_block，erigon、nethermind等节点需要开启trace接口
+var syncTrace = os.Getenv("SYNC_TRACE")
+
+// 批量请求debug_traceTransaction时每次请求的数量
+const traceBatchSize = 20
+
+// 节点不支持trace方法时置为1，之后不再trace
+var traceUnsupported int32
+
+// callFrame callTracer返回的调用树
+type callFrame struct {
+	Type    string         `json:"type"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Value   *hexutil.Big   `json:"value"`
+	Gas     hexutil.Uint64 `json:"gas"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Error   string         `json:"error"`
+	Calls   []*callFrame   `json:"calls"`
+}
+
+// parityTrace trace_block返回的一条调用，traceAddress为空的是交易本身
+type parityTrace struct {
+	Type   string `json:"type"`
+	Action struct {
+		CallType       string         `json:"callType"`
+		From           string         `json:"from"`
+		To             string         `json:"to"`
+		Value          *hexutil.Big   `json:"value"`
+		Gas            hexutil.Uint64 `json:"gas"`
+		Address        string         `json:"address"`
+		RefundAddress  string         `json:"refundAddress"`
+		Balance        *hexutil.Big   `json:"balance"`
+		CreationMethod string         `json:"creationMethod"`
+	} `json:"action"`
+	Result *struct {
+		GasUsed hexutil.Uint64 `json:"gasUsed"`
+		Address string         `json:"address"`
+	} `json:"result"`
+	Error               string `json:"error"`
+	TraceAddress        []int  `json:"traceAddress"`
+	TransactionHash     string `json:"transactionHash"`
+	TransactionPosition *int   `json:"transactionPosition"`
+}
+
+func bigString(value *hexutil.Big) string {
+	if value == nil {
+		return "0"
+	}
+	return value.ToInt().String()
+}
+
+// checksumAddress 和ESTx一样保存校验和格式的地址，空地址保持为空
+func checksumAddress(address string) string {
+	if address == "" {
+		return ""
+	}
+	return common.HexToAddress(address).String()
+}
+
+// getInternalTxs trace block里所有的交易，返回内部调用以及新出现的地址和内部创建的合约
+func getInternalTxs(ctx context.Context, block *rpcBlock, esTxs []*store.ESTx) ([]*store.ESInternalTx, []string, []string, error) {
+	if syncTrace == "" || len(esTxs) == 0 || atomic.LoadInt32(&traceUnsupported) == 1 {
+		return nil, nil, nil, nil
+	}
+	var internalTxs []*store.ESInternalTx
+	var err error
+	switch syncTrace {
+	case "callTracer":
+		internalTxs, err = traceCalls(ctx, esTxs)
+	case "parity":
+		internalTxs, err = traceBlock(ctx, block, esTxs)
+	default:
+		return nil, nil, nil, errors.New("不支持的SYNC_TRACE:" + syncTrace)
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		atomic.StoreInt32(&traceUnsupported, 1)
+		log.Logger.Warn("节点不支持trace，不再同步内部调用")
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var addresses []string
+	var contracts []string
+	for _, internalTx := range internalTxs {
+		if internalTx.IsCreate() {
+			contracts = append(contracts, internalTx.To)
+			continue
+		}
+		// 只记录有转账的地址，避免把所有被调用的合约都当作普通地址写入
+		if internalTx.Value != "0" && internalTx.Error == "" {
+			addresses = append(addresses, internalTx.From)
+			if internalTx.To != "" {
+				addresses = append(addresses, internalTx.To)
+			}
+		}
+	}
+	return internalTxs, addresses, contracts, nil
+}
+
+// newInternalTx 填充内部调用所在交易的信息
+func newInternalTx(esTx *store.ESTx, index int, traceAddress []int) *store.ESInternalTx {
+	return &store.ESInternalTx{
+		Id:               esTx.Hash + "-" + strconv.Itoa(index),
+		TxHash:           esTx.Hash,
+		BlockHash:        esTx.BlockHash,
+		Number:           esTx.Number,
+		Time:             esTx.Time,
+		TransactionIndex: esTx.TransactionIndex,
+		Index:            index,
+		TraceAddress:     traceAddress,
+		Depth:            len(traceAddress),
+	}
+}
+
+// traceCalls 用批量json-rpc请求debug_traceTransaction
+func traceCalls(ctx context.Context, esTxs []*store.ESTx) ([]*store.ESInternalTx, error) {
+	frames := make([]*callFrame, len(esTxs))
+	config := map[string]interface{}{"tracer": "callTracer"}
+	for i := 0; i < len(esTxs); i += traceBatchSize {
+		j := i + traceBatchSize
+		if j > len(esTxs) {
+			j = len(esTxs)
+		}
+		elems := make([]rpc.BatchElem, 0, j-i)
+		for k := i; k < j; k++ {
+			elems = append(elems, rpc.BatchElem{
+				Method: "debug_traceTransaction",
+				Args:   []interface{}{esTxs[k].Hash, config},
+				Result: &frames[k],
+			})
+		}
+		err := db.RpcClient.BatchCallContext(ctx, elems)
+		if err != nil {
+			return nil, err
+		}
+		for _, elem := range elems {
+			if elem.Error != nil {
+				return nil, elem.Error
+			}
+		}
+	}
+	var internalTxs []*store.ESInternalTx
+	for i, frame := range frames {
+		if frame == nil {
+			return nil, errors.New("trace不存在:" + esTxs[i].Hash)
+		}
+		index := 0
+		internalTxs = flattenCalls(esTxs[i], frame.Calls, nil, frame.Error, &index, internalTxs)
+	}
+	return internalTxs, nil
+}
+
+// flattenCalls 按调用顺序展开调用树，parentError是父调用的错误，父调用失败时子调用也被回滚
+func flattenCalls(esTx *store.ESTx, calls []*callFrame, parent []int, parentError string, index *int, internalTxs []*store.ESInternalTx) []*store.ESInternalTx {
+	for i, call := range calls {
+		traceAddress := append(append([]int{}, parent...), i)
+		*index++
+		internalTx := newInternalTx(esTx, *index, traceAddress)
+		internalTx.Type = strings.ToUpper(call.Type)
+		internalTx.From = checksumAddress(call.From)
+		internalTx.To = checksumAddress(call.To)
+		internalTx.Value = bigString(call.Value)
+		internalTx.Gas = strconv.FormatUint(uint64(call.Gas), 10)
+		internalTx.GasUsed = strconv.FormatUint(uint64(call.GasUsed), 10)
+		internalTx.Error = call.Error
+		if internalTx.Error == "" {
+			internalTx.Error = parentError
+		}
+		internalTxs = append(internalTxs, internalTx)
+		internalTxs = flattenCalls(esTx, call.Calls, traceAddress, internalTx.Error, index, internalTxs)
+	}
+	return internalTxs
+}
+
+// traceBlock 用trace_block一次获取整个块的调用，结果已经按交易和调用顺序排列
+func traceBlock(ctx context.Context, block *rpcBlock, esTxs []*store.ESTx) ([]*store.ESInternalTx, error) {
+	var traces []*parityTrace
+	err := db.RpcClient.CallContext(ctx, &traces, "trace_block", hexutil.EncodeBig(block.header.Number))
+	if err != nil {
+		return nil, err
+	}
+	var internalTxs []*store.ESInternalTx
+	indexes := make([]int, len(esTxs))
+	// 每个交易里失败的调用，key是traceAddress，父调用总是排在子调用前面
+	failed := make([]map[string]string, len(esTxs))
+	for _, trace := range traces {
+		// reward等不属于交易的记录没有transactionPosition
+		if trace.TransactionPosition == nil {
+			continue
+		}
+		position := *trace.TransactionPosition
+		if position < 0 || position >= len(esTxs) {
+			return nil, errors.New("trace和tx不对应:" + trace.TransactionHash)
+		}
+		callError := trace.Error
+		if callError == "" && len(trace.TraceAddress) > 0 {
+			callError = failed[position][traceKey(trace.TraceAddress[:len(trace.TraceAddress)-1])]
+		}
+		if callError != "" {
+			if failed[position] == nil {
+				failed[position] = map[string]string{}
+			}
+			failed[position][traceKey(trace.TraceAddress)] = callError
+		}
+		// traceAddress为空的是交易本身
+		if len(trace.TraceAddress) == 0 {
+			continue
+		}
+		indexes[position]++
+		internalTx := newInternalTx(esTxs[position], indexes[position], trace.TraceAddress)
+		action := trace.Action
+		switch trace.Type {
+		case "call":
+			internalTx.Type = strings.ToUpper(action.CallType)
+			internalTx.From, internalTx.To, internalTx.Value = action.From, action.To, bigString(action.Value)
+		case "create":
+			internalTx.Type = "CREATE"
+			if action.CreationMethod == "create2" {
+				internalTx.Type = "CREATE2"
+			}
+			internalTx.From, internalTx.Value = action.From, bigString(action.Value)
+			if trace.Result != nil {
+				internalTx.To = trace.Result.Address
+			}
+		case "suicide":
+			internalTx.Type = "SELFDESTRUCT"
+			internalTx.From, internalTx.To, internalTx.Value = action.Address, action.RefundAddress, bigString(action.Balance)
+		default:
+			internalTx.Type = strings.ToUpper(trace.Type)
+			internalTx.From, internalTx.To, internalTx.Value = action.From, action.To, bigString(action.Value)
+		}
+		internalTx.Gas = strconv.FormatUint(uint64(action.Gas), 10)
+		internalTx.GasUsed = "0"
+		if trace.Result != nil {
+			internalTx.GasUsed = strconv.FormatUint(uint64(trace.Result.GasUsed), 10)
+		}
+		internalTx.Error = callError
+		internalTx.From = checksumAddress(internalTx.From)
+		internalTx.To = checksumAddress(internalTx.To)
+		internalTxs = append(internalTxs, internalTx)
+	}
+	return internalTxs, nil
+}
+
+func traceKey(traceAddress []int) string {
+	return fmt.Sprint(traceAddress)
+}
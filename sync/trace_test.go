@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"explorer/db"
+	"explorer/store"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testTraces 固定返回的trace_block结果
+type testTraces struct {
+	traces []map[string]interface{}
+}
+
+func (t *testTraces) Block(ctx context.Context, number string) ([]map[string]interface{}, error) {
+	return t.traces, nil
+}
+
+func testTrace(traceAddress []int, callError string) map[string]interface{} {
+	trace := map[string]interface{}{
+		"type":                "call",
+		"action":              map[string]interface{}{"callType": "call", "from": "0x01", "to": "0x02", "value": "0x0", "gas": "0x0"},
+		"traceAddress":        traceAddress,
+		"transactionPosition": 0,
+	}
+	if callError != "" {
+		trace["error"] = callError
+	}
+	return trace
+}
+
+// internalTxErrors 按调用顺序排列的错误
+func internalTxErrors(internalTxs []*store.ESInternalTx) []string {
+	errs := make([]string, 0, len(internalTxs))
+	for _, internalTx := range internalTxs {
+		errs = append(errs, internalTx.Error)
+	}
+	return errs
+}
+
+func assertErrors(t *testing.T, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("errors = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("errors = %q, want %q", got, want)
+			return
+		}
+	}
+}
+
+func TestFlattenCallsParentError(t *testing.T) {
+	esTx := &store.ESTx{Hash: "0xt1"}
+	// 0 成功，0.0 revert，0.0.0 成功但被父调用回滚，1 成功
+	calls := []*callFrame{
+		{Type: "call", Calls: []*callFrame{
+			{Type: "call", Error: "execution reverted", Calls: []*callFrame{{Type: "create"}}},
+		}},
+		{Type: "call"},
+	}
+	index := 0
+	internalTxs := flattenCalls(esTx, calls, nil, "", &index, nil)
+	assertErrors(t, internalTxErrors(internalTxs), []string{"", "execution reverted", "execution reverted", ""})
+	if internalTxs[2].IsCreate() {
+		t.Errorf("create under a reverted call should not count as a new contract")
+	}
+
+	// 交易本身失败时所有的内部调用都被回滚
+	index = 0
+	internalTxs = flattenCalls(esTx, calls, nil, "out of gas", &index, nil)
+	assertErrors(t, internalTxErrors(internalTxs), []string{"out of gas", "execution reverted", "execution reverted", "out of gas"})
+}
+
+func TestTraceBlockParentError(t *testing.T) {
+	traces := &testTraces{traces: []map[string]interface{}{
+		testTrace([]int{}, ""),
+		testTrace([]int{0}, ""),
+		testTrace([]int{0, 0}, "Reverted"),
+		testTrace([]int{0, 0, 0}, ""),
+		testTrace([]int{0, 1}, ""),
+		testTrace([]int{1}, ""),
+	}}
+	server := rpc.NewServer()
+	defer server.Stop()
+	err := server.RegisterName("trace", traces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RpcClient = rpc.DialInProc(server)
+	defer db.RpcClient.Close()
+
+	block := &rpcBlock{header: &types.Header{Number: big.NewInt(1)}}
+	internalTxs, err := traceBlock(context.Background(), block, []*store.ESTx{{Hash: "0xt1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertErrors(t, internalTxErrors(internalTxs), []string{"", "Reverted", "Reverted", "", ""})
+
+	// 交易本身失败
+	traces.traces[0] = testTrace([]int{}, "Out of gas")
+	internalTxs, err = traceBlock(context.Background(), block, []*store.ESTx{{Hash: "0xt1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertErrors(t, internalTxErrors(internalTxs), []string{"Out of gas", "Reverted", "Reverted", "Out of gas", "Out of gas"})
+}
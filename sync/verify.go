@@ -0,0 +1,352 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"explorer/log"
+	"explorer/store"
+	"go.uber.org/zap"
+	"math/big"
+	"strconv"
+	stdsync "sync"
+	"time"
+)
+
+// 每次校验的高度数量
+const verifyWindow = 1000
+
+// SYNC_VERIFY_INTERVAL 后台校验的间隔秒数
+var syncVerifyInterval = envInt("SYNC_VERIFY_INTERVAL", 600)
+
+// VerifyResult 一次校验的结果
+type VerifyResult struct {
+	From       uint64   `json:"from"`
+	To         uint64   `json:"to"`
+	Missing    []uint64 `json:"missing"`
+	Mismatched []uint64 `json:"mismatched"`
+	Repaired   int      `json:"repaired"`
+	Running    bool     `json:"running"`
+	Error      string   `json:"error"`
+	Time       uint64   `json:"timestamp"`
+}
+
+// StartVerify返回的错误，校验正在进行时是ErrVerifyRunning，范围不对时是ErrVerifyRange或ErrNoCheckpoint
+var (
+	ErrVerifyRunning = errors.New("校验正在进行")
+	ErrVerifyRange   = errors.New("from不能大于to")
+	ErrNoCheckpoint  = errors.New("还没有同步进度")
+)
+
+var (
+	verifyMu     stdsync.Mutex
+	resultMu     stdsync.Mutex
+	verifyResult VerifyResult
+)
+
+// 后台校验下一个需要检查的高度，随同步进度保存，启动时从同步进度里恢复
+var (
+	verifiedMu     stdsync.Mutex
+	verifiedLoaded bool
+	verifiedTo     uint64
+)
+
+// loadVerified 第一次读取同步进度时恢复后台校验的进度，旧版本的同步进度里没有时从头校验
+func loadVerified(checkpoint *store.ESCheckpoint) error {
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	if verifiedLoaded {
+		return nil
+	}
+	if checkpoint != nil && checkpoint.VerifiedTo != "" {
+		number, err := strconv.ParseUint(checkpoint.VerifiedTo, 10, 64)
+		if err != nil {
+			return err
+		}
+		verifiedTo = number
+	}
+	verifiedLoaded = true
+	return nil
+}
+
+// getVerified 后台校验的进度，还没有从同步进度里恢复时返回false
+func getVerified() (uint64, bool) {
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	return verifiedTo, verifiedLoaded
+}
+
+// setVerified 校验完成后推进进度，下次保存同步进度时写入
+func setVerified(number uint64) {
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	if number > verifiedTo {
+		verifiedTo = number
+	}
+}
+
+// clampVerified 进度不超过limit，重组回滚后重新校验回滚的高度，返回当前的进度
+func clampVerified(limit uint64) (uint64, bool) {
+	verifiedMu.Lock()
+	defer verifiedMu.Unlock()
+	if verifiedTo > limit {
+		verifiedTo = limit
+	}
+	return verifiedTo, verifiedLoaded
+}
+
+// verifyLoop 后台定时校验，从保存的进度开始检查，之后只检查新同步的块
+func verifyLoop() {
+	for {
+		time.Sleep(time.Duration(syncVerifyInterval) * time.Second)
+		from, ok := getVerified()
+		if !ok {
+			continue
+		}
+		checkpoint, err := getCheckpoint()
+		if err != nil || checkpoint == nil {
+			continue
+		}
+		to, err := strconv.ParseUint(checkpoint.Number, 10, 64)
+		if err != nil || to < from {
+			continue
+		}
+		if !verifyMu.TryLock() {
+			continue
+		}
+		result := verify(from, to)
+		verifyMu.Unlock()
+		if result.Error == "" {
+			setVerified(to + 1)
+		}
+	}
+}
+
+// StartVerify 手动触发校验[from, to]，to为0时校验到同步进度
+func StartVerify(from uint64, to uint64) error {
+	if to == 0 {
+		checkpoint, err := getCheckpoint()
+		if err != nil {
+			return err
+		}
+		if checkpoint == nil {
+			return ErrNoCheckpoint
+		}
+		to, err = strconv.ParseUint(checkpoint.Number, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	if from > to {
+		return ErrVerifyRange
+	}
+	if !verifyMu.TryLock() {
+		return ErrVerifyRunning
+	}
+	go func() {
+		defer verifyMu.Unlock()
+		verify(from, to)
+	}()
+	return nil
+}
+
+// GetVerifyResult 获取最近一次校验的结果
+func GetVerifyResult() VerifyResult {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	return verifyResult
+}
+
+func setVerifyResult(result VerifyResult) {
+	resultMu.Lock()
+	defer resultMu.Unlock()
+	verifyResult = result
+}
+
+// verify 找出[from, to]里缺失的块和tx数量不一致的块，并重新同步
+func verify(from uint64, to uint64) VerifyResult {
+	result := VerifyResult{
+		From:       from,
+		To:         to,
+		Missing:    []uint64{},
+		Mismatched: []uint64{},
+		Running:    true,
+		Time:       uint64(time.Now().Unix()),
+	}
+	setVerifyResult(result)
+	err := func() error {
+		for start := from; start <= to; start += verifyWindow {
+			end := start + verifyWindow - 1
+			if end > to {
+				end = to
+			}
+			missing, mismatched, err := checkWindow(start, end)
+			if err != nil {
+				return err
+			}
+			result.Missing = append(result.Missing, missing...)
+			result.Mismatched = append(result.Mismatched, mismatched...)
+			numbers := append(append([]uint64{}, missing...), mismatched...)
+			if len(numbers) > 0 {
+				log.Logger.Warn("发现缺失的块",
+					zap.Uint64s("missing", missing),
+					zap.Uint64s("mismatched", mismatched),
+				)
+			}
+			err = resyncBlocks(numbers)
+			if err != nil {
+				return err
+			}
+			result.Repaired += len(numbers)
+			setVerifyResult(result)
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Logger.Error("校验区块出错")
+		log.Logger.Error(err.Error())
+		result.Error = err.Error()
+	}
+	result.Running = false
+	setVerifyResult(result)
+	return result
+}
+
+// checkWindow 检查[start, end]的块是否存在，以及tx数量是否和block的txns一致
+func checkWindow(start uint64, end uint64) ([]uint64, []uint64, error) {
+	txns, txCount, err := store.Repo.BlockTxCounts(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	var missing []uint64
+	var mismatched []uint64
+	for number := start; number <= end; number++ {
+		count, ok := txns[number]
+		if !ok {
+			missing = append(missing, number)
+			continue
+		}
+		if count != txCount[number] {
+			mismatched = append(mismatched, number)
+		}
+	}
+	return missing, mismatched, nil
+}
+
+// resyncBlocks 重新同步指定高度的块，不修改同步进度
+func resyncBlocks(numbers []uint64) error {
+	var batch []*syncBlock
+	for _, number := range numbers {
+		sb := fetchBlockWithRetry(context.Background(), number)
+		if sb.err != nil {
+			return sb.err
+		}
+		batch = append(batch, sb)
+		if len(batch) >= syncBatchSize {
+			err := resyncBatch(batch)
+			if err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	return resyncBatch(batch)
+}
+
+// resyncBatch 写入补齐的块。拉取之后链可能已经重组，持有写入锁后再确认每个块还在链上，
+// 不在链上的块跳过，由之后的同步或校验补齐
+func resyncBatch(batch []*syncBlock) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	batch, err := canonicalBlocks(batch)
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+	_, err = retry("补齐区块", func() error {
+		return writeBlocks(batch)
+	})
+	if err != nil {
+		return err
+	}
+	numbers := make([]uint64, 0, len(batch))
+	for _, sb := range batch {
+		numbers = append(numbers, sb.number)
+	}
+	return deleteDeadLetters(numbers)
+}
+
+// canonicalBlocks 过滤掉hash和链上当前同一高度的块不一致的块
+func canonicalBlocks(batch []*syncBlock) ([]*syncBlock, error) {
+	canonical := make([]*syncBlock, 0, len(batch))
+	for _, sb := range batch {
+		hash, err := getBlockHash(context.Background(), new(big.Int).SetUint64(sb.number))
+		if err != nil {
+			return nil, err
+		}
+		if hash.String() != sb.esBlock.BlockHash {
+			log.Logger.Warn("补齐的块已经不在链上，跳过",
+				zap.Uint64("block", sb.number),
+				zap.String("hash", sb.esBlock.BlockHash),
+			)
+			continue
+		}
+		canonical = append(canonical, sb)
+	}
+	return canonical, nil
+}
+
+// Reindex 从链上重新拉取[from, to]的块写入当前配置的索引，不修改同步进度，用于迁移
+func Reindex(from uint64, to uint64) error {
+	head, err := getRpcLastBlockNumber()
+	if err != nil {
+		return err
+	}
+	setCurrentMarks(getFinalityMarks(head.Uint64()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ordered, release := startPipeline(ctx, from, to+1)
+	var batch []*syncBlock
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := retry("重建索引", func() error {
+			return writeBlocks(batch)
+		})
+		if err != nil {
+			return err
+		}
+		log.Logger.Info("重建索引进度", zap.Uint64("block", batch[len(batch)-1].number), zap.Uint64("to", to))
+		batch = nil
+		return nil
+	}
+	for sb := range ordered {
+		release()
+		if sb.err != nil {
+			return sb.err
+		}
+		batch = append(batch, sb)
+		if len(batch) >= syncBatchSize {
+			err := write()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return write()
+}
+
+// GetCheckpointNumber 获取同步进度的高度，没有同步过时返回false
+func GetCheckpointNumber() (uint64, bool, error) {
+	checkpoint, err := getCheckpoint()
+	if err != nil || checkpoint == nil {
+		return 0, false, err
+	}
+	number, err := strconv.ParseUint(checkpoint.Number, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return number, true, nil
+}
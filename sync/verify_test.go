@@ -0,0 +1,13 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStartVerifyRange(t *testing.T) {
+	err := StartVerify(5, 3)
+	if !errors.Is(err, ErrVerifyRange) {
+		t.Fatalf("StartVerify(5, 3) = %v, want %v", err, ErrVerifyRange)
+	}
+}